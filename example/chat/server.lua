@@ -1,5 +1,5 @@
 local websocket = require "websocket"
-local rpc = require "rpc"
+local pubsub = require "pubsub"
 local env = require "env"
 local fs = require "fs"
 local http = require "http"
@@ -52,7 +52,7 @@ end
 function close_conn(conn)
     connections[conn.id] = nil
     conn:close()
-    rpc.broadcast("leave", {
+    pubsub.publish("leave", {
         node = env.node,
         worker_id = env.worker_id,
         id = conn.id,
@@ -70,7 +70,7 @@ function handle_conn(conn)
         end
         local m = json_decode(body)
         if m.type == "message" then
-            rpc.broadcast("message", {
+            pubsub.publish("message", {
                 node = env.node,
                 worker_id = env.worker_id,
                 id = conn.id,
@@ -104,7 +104,7 @@ end)
 function handler(conn)
     conn.id = uuid()
     connections[conn.id] = conn
-    rpc.broadcast("join", {
+    pubsub.publish("join", {
         node = env.node,
         worker_id = env.worker_id,
         id = conn.id,
@@ -127,26 +127,20 @@ tcpServer:start(function(err)
     print("tcp server started")
 end)
 
-rpc.register("join", function(message, reply)
+pubsub.subscribe("join", function(message)
     for id, conn in pairs(connections) do
         conn:write_frame("user " .. message.id .." joined from " .. message.worker_id .. "@" .. message.node, function(err) handle_error(conn, err) end)
     end
-    reply()
 end)
 
-rpc.register("leave", function(message, reply)
+pubsub.subscribe("leave", function(message)
     for id, conn in pairs(connections) do
         conn:write_frame("user " .. message.id .." left from " .. message.worker_id .. "@" .. message.node, function(err) handle_error(conn, err) end)
     end
-    reply()
 end)
 
-rpc.register("message", function(message, reply)
+pubsub.subscribe("message", function(message)
     for id, conn in pairs(connections) do
         conn:write_frame("user " .. message.id .." from " .. message.worker_id .. "@" .. message.node .. "  said: " .. message.message, function(err) handle_error(conn, err) end)
     end
-    reply()
 end)
-
-rpc.start()
-print("rpc server started")
@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/joesonw/drlee/pkg/server"
 	"github.com/joesonw/drlee/proto"
 	"google.golang.org/grpc"
 
@@ -21,7 +22,9 @@ func NewDebugCommand() *DebugCommand {
 	return &DebugCommand{}
 }
 
+//nolint:funlen
 func (d *DebugCommand) Build(ctx context.Context) *cobra.Command {
+	var pCA, pCert, pKey, pServerName *string
 	cmd := &cobra.Command{
 		Use:   "debug",
 		Short: "debug over rpc port",
@@ -31,7 +34,21 @@ func (d *DebugCommand) Build(ctx context.Context) *cobra.Command {
 				os.Exit(1)
 			}
 
-			cc, err := grpc.Dial(args[0], grpc.WithInsecure())
+			dialOption := grpc.WithInsecure()
+			if *pCA != "" {
+				certs, err := server.NewCertificates(server.TLSConfig{
+					CAFile:   *pCA,
+					CertFile: *pCert,
+					KeyFile:  *pKey,
+				})
+				if err != nil {
+					println("unable to load tls certificates: " + err.Error())
+					os.Exit(1)
+				}
+				dialOption = grpc.WithTransportCredentials(certs.ClientCredentials(*pServerName))
+			}
+
+			cc, err := grpc.Dial(args[0], dialOption)
 			if err != nil {
 				println("unable to connect to remote rpc: " + err.Error())
 				os.Exit(1)
@@ -97,9 +114,234 @@ func (d *DebugCommand) Build(ctx context.Context) *cobra.Command {
 				},
 				Help: "call lua rpc method directly",
 			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "breakers",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "breakers",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show circuit breaker state of peer nodes",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "raft",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "raft",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show raft leader, log indexes and voters",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "inbox",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "inbox",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show depth and in-flight requests of each inbox class",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "outbox",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "outbox",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show pending, sent, retried and dead replies to each node",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "jobs",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "jobs",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show waiting, scheduled and leased jobs of each queue, along with workers and nodes processing it",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "failed-jobs",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "failed-jobs",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "list jobs failed on every attempt, they can be replayed like dead letters",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "actors",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "actors",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "show actors active on node and messages waiting for them by kind",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "workflows",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "workflows",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "list workflow instances started on node, along with their status and current step",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "workflow",
+				Func: func(ctx *ishell.Context) {
+					if len(ctx.Args) < 1 {
+						shell.Println("workflow <id>")
+						return
+					}
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "workflow",
+						Body: []byte(ctx.Args[0]),
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "inspect a workflow instance, including input and results of its steps",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "resume",
+				Func: func(ctx *ishell.Context) {
+					if len(ctx.Args) < 1 {
+						shell.Println("resume <id>")
+						return
+					}
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "resume",
+						Body: []byte(ctx.Args[0]),
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "retry compensations of a failed workflow instance",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "dead-letters",
+				Func: func(ctx *ishell.Context) {
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "dead-letters",
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "list dead letters, requests and replies failed to be handled or delivered",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "dead-letter",
+				Func: func(ctx *ishell.Context) {
+					if len(ctx.Args) < 1 {
+						shell.Println("dead-letter <id>")
+						return
+					}
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "dead-letter",
+						Body: []byte(ctx.Args[0]),
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "inspect a dead letter",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "replay",
+				Func: func(ctx *ishell.Context) {
+					if len(ctx.Args) < 1 {
+						shell.Println("replay <id|all>")
+						return
+					}
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "replay",
+						Body: []byte(ctx.Args[0]),
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "replay dead letters, requests are put back into inbox, replies into outbox and jobs into their queues",
+			})
+			shell.AddCmd(&ishell.Cmd{
+				Name: "purge",
+				Func: func(ctx *ishell.Context) {
+					if len(ctx.Args) < 1 {
+						shell.Println("purge <id|all>")
+						return
+					}
+					res, err := rpc.RPCDebug(context.TODO(), &proto.DebugRequest{
+						Name: "purge",
+						Body: []byte(ctx.Args[0]),
+					})
+					if err != nil {
+						shell.Println("remote: " + err.Error())
+						return
+					}
+					shell.Println(string(res.Body))
+				},
+				Help: "remove dead letters",
+			})
 			shell.Run()
 			os.Exit(0)
 		},
 	}
+	pCA = cmd.Flags().String("tls-ca", "", "CA to verify rpc port with, connects over tls if given")
+	pCert = cmd.Flags().String("tls-cert", "", "client certificate")
+	pKey = cmd.Flags().String("tls-key", "", "client certificate key")
+	pServerName = cmd.Flags().String("tls-server-name", "", "name the rpc port certificate is expected to be issued for, e.g. node name")
 	return cmd
 }
@@ -52,6 +52,9 @@ func (s *ServerCommand) Build(ctx context.Context) *cobra.Command {
 			if err = yaml.Unmarshal(bytes, config); err != nil {
 				logger.Fatal("unable to parse config", zap.Error(err))
 			}
+			if err = config.Validate(); err != nil {
+				logger.Fatal("invalid config", zap.Error(err))
+			}
 
 			var plugins []plugin.Interface
 			for _, pluginConfig := range config.Plugins {
@@ -107,12 +110,31 @@ func (s *ServerCommand) Build(ctx context.Context) *cobra.Command {
 				logger.Fatal("unable to create dir: "+config.Queue.Dir+" for queue", zap.Error(err))
 			}
 
-			inbox := diskqueue.New("inbox", config.Queue.Dir, config.Queue.MaxBytesPerFile, 1, config.Queue.MaxMsgSize, config.Queue.SyncEvery, config.Queue.SyncTimeout, diskqueuLogFunc)
+			newQueue := func(name string) diskqueue.Interface {
+				return diskqueue.New(name, config.Queue.Dir, config.Queue.MaxBytesPerFile, 1, config.Queue.MaxMsgSize, config.Queue.SyncEvery, config.Queue.SyncTimeout, diskqueuLogFunc)
+			}
 			outbox := diskqueue.New("outbox", config.Queue.Dir, config.Queue.MaxBytesPerFile, 1, config.Queue.MaxMsgSize, config.Queue.SyncEvery, config.Queue.SyncTimeout, diskqueuLogFunc)
+			deadLetters := diskqueue.New("dead-letters", config.Queue.Dir, config.Queue.MaxBytesPerFile, 1, config.Queue.MaxMsgSize, config.Queue.SyncEvery, config.Queue.SyncTimeout, diskqueuLogFunc)
+
+			var certs *server.Certificates
+			var grpcOptions []grpc.ServerOption
+			if config.RPC.TLS.IsEnabled() {
+				certs, err = server.NewCertificates(config.RPC.TLS)
+				if err != nil {
+					logger.Fatal("unable to load tls certificates", zap.Error(err))
+				}
+				certs.Watch(logger)
+				grpcOptions = append(grpcOptions, grpc.Creds(certs.ServerCredentials()))
+				if config.RPC.TLS.IsMutual() {
+					grpcOptions = append(grpcOptions,
+						grpc.UnaryInterceptor(certs.UnaryServerInterceptor()),
+						grpc.StreamInterceptor(certs.StreamServerInterceptor()))
+				}
+			}
 
 			var members *memberlist.Memberlist
 
-			srv := server.New(config, func() *memberlist.Memberlist { return members }, inbox, outbox, logger, plugins)
+			srv := server.New(config, func() *memberlist.Memberlist { return members }, newQueue, outbox, deadLetters, logger, plugins, certs)
 			memberlistConfig := memberlist.DefaultLANConfig()
 			memberlistConfig.Name = config.NodeName
 			memberlistConfig.BindAddr = config.Gossip.Addr
@@ -129,7 +151,7 @@ func (s *ServerCommand) Build(ctx context.Context) *cobra.Command {
 			// memberlistConfig.Alive = srv
 			memberlistConfig.Logger = zap.NewStdLog(logger)
 
-			grpcServer := grpc.NewServer()
+			grpcServer := grpc.NewServer(grpcOptions...)
 			proto.RegisterRPCServer(grpcServer, srv)
 			lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.RPC.Addr, config.RPC.Port))
 			if err != nil {
@@ -0,0 +1,299 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/core/helpers/params"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Message to an actor, messages of the same actor are handed to the same worker one at a time
+type Message struct {
+	ID         string
+	Kind       string
+	ActorID    string
+	Body       []byte
+	Codec      string
+	NodeName   string
+	IsLoopBack bool
+	// IsAsk caller waits for reply
+	IsAsk bool
+	// Deactivate actor is idle or owned by another node now, worker drops its state
+	Deactivate bool
+}
+
+type Env struct {
+	Define func(kind string)
+	// Send returns once message is accepted by node owning actor
+	Send func(ctx context.Context, kind, id string, body []byte) error
+	Ask  func(ctx context.Context, kind, id string, body []byte, timeout time.Duration) ([]byte, error)
+	// Reply sends reply of ask back to caller
+	Reply func(msg *Message, body []byte, err error)
+	// Done message is handled, the next one of actor can be handed to worker
+	Done     func(msg *Message)
+	ReadChan func() <-chan *Message
+}
+
+type actorKind struct {
+	handler *lua.LFunction
+	load    *lua.LFunction
+	save    *lua.LFunction
+}
+
+type lActor struct {
+	env   *Env
+	ec    *core.ExecutionContext
+	kinds map[string]*actorKind
+	// actors activated on worker by kind and id, they are only touched from lua
+	actors map[string]*lua.LTable
+	once   *sync.Once
+}
+
+func checkActor(L *lua.LState) *lActor {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lActor); ok {
+		return u
+	}
+
+	L.RaiseError("expected actor")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"define": lDefine,
+	"send":   lSend,
+	"ask":    lAsk,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lActor{
+		env:    env,
+		ec:     ec,
+		kinds:  map[string]*actorKind{},
+		actors: map[string]*lua.LTable{},
+		once:   &sync.Once{},
+	}
+	utils.RegisterLuaModule(L, "actor", funcs, ud)
+}
+
+func actorKey(kind, id string) string {
+	return kind + "\x00" + id
+}
+
+// start hands messages to actors they are sent to
+func (uv *lActor) start() {
+	uv.once.Do(func() {
+		ch := uv.env.ReadChan()
+		go func() {
+			for msg := range ch {
+				uv.handle(msg)
+			}
+		}()
+	})
+}
+
+// handle activates actor of message if it's not active on worker, its state is loaded first if kind has load hook
+func (uv *lActor) handle(msg *Message) {
+	uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+		key := actorKey(msg.Kind, msg.ActorID)
+		if msg.Deactivate {
+			delete(uv.actors, key)
+			return nil
+		}
+		kind, ok := uv.kinds[msg.Kind]
+		if !ok {
+			uv.finish(msg, nil, fmt.Errorf("actor \"%s\" is not defined", msg.Kind))
+			return nil
+		}
+		if self, ok := uv.actors[key]; ok {
+			uv.receive(L, kind, self, msg)
+			return nil
+		}
+
+		self := L.NewTable()
+		self.RawSetString("kind", lua.LString(msg.Kind))
+		self.RawSetString("id", lua.LString(msg.ActorID))
+		self.RawSetString("state", L.NewTable())
+		if kind.load == nil {
+			uv.actors[key] = self
+			uv.receive(L, kind, self, msg)
+			return nil
+		}
+		once := &sync.Once{}
+		cb := L.NewFunction(func(L *lua.LState) int {
+			once.Do(func() {
+				if err := L.Get(1); err != lua.LNil {
+					uv.finish(msg, nil, fmt.Errorf("unable to load actor \"%s\": %s", msg.ActorID, err.String()))
+					return
+				}
+				if state := L.Get(2); state != lua.LNil {
+					self.RawSetString("state", state)
+				}
+				uv.actors[key] = self
+				uv.receive(L, kind, self, msg)
+			})
+			return 0
+		})
+		if err := utils.CallLuaFunction(L, kind.load, lua.LString(msg.ActorID), cb); err != nil {
+			once.Do(func() {
+				uv.finish(msg, nil, err)
+			})
+		}
+		return nil
+	}))
+}
+
+// receive calls handler of actor with message, it's handled once handler calls reply or raises an error. State of
+// actor is saved before replying if kind has save hook, actor is deactivated if it's failed to be saved.
+func (uv *lActor) receive(L *lua.LState, kind *actorKind, self *lua.LTable, msg *Message) {
+	v, err := codec.Decode(L, msg.Codec, msg.Body)
+	if err != nil {
+		uv.finish(msg, nil, fmt.Errorf("unable to decode message of actor \"%s\": %w", msg.Kind, err))
+		return
+	}
+
+	once := &sync.Once{}
+	done := func(L *lua.LState, body []byte, err error) {
+		once.Do(func() {
+			if kind.save == nil {
+				uv.finish(msg, body, err)
+				return
+			}
+			saved := &sync.Once{}
+			cb := L.NewFunction(func(L *lua.LState) int {
+				saved.Do(func() {
+					if e := L.Get(1); e != lua.LNil {
+						delete(uv.actors, actorKey(msg.Kind, msg.ActorID))
+						uv.finish(msg, nil, fmt.Errorf("unable to save actor \"%s\": %s", msg.ActorID, e.String()))
+						return
+					}
+					uv.finish(msg, body, err)
+				})
+				return 0
+			})
+			if e := utils.CallLuaFunction(L, kind.save, lua.LString(msg.ActorID), self.RawGetString("state"), cb); e != nil {
+				saved.Do(func() {
+					delete(uv.actors, actorKey(msg.Kind, msg.ActorID))
+					uv.finish(msg, nil, e)
+				})
+			}
+		})
+	}
+	reply := L.NewFunction(func(L *lua.LState) int {
+		if err := L.Get(1); err != lua.LNil {
+			done(L, nil, errors.New(err.String()))
+			return 0
+		}
+		var body []byte
+		var err error
+		if msg.IsAsk {
+			body, err = codec.Encode(msg.Codec, L.Get(2))
+		}
+		done(L, body, err)
+		return 0
+	})
+	if err := utils.CallLuaFunction(L, kind.handler, self, v, reply); err != nil {
+		done(L, nil, err)
+	}
+}
+
+// finish replies asks and lets the next message of actor in
+func (uv *lActor) finish(msg *Message, body []byte, err error) {
+	if msg.IsAsk {
+		uv.env.Reply(msg, body, err)
+	}
+	uv.env.Done(msg)
+}
+
+// lDefine actor.define(kind, handler, options?), handler is called with actor, message and reply. Options may have
+// load(id, cb) and save(id, state, cb) hooks to persist state of actors.
+func lDefine(L *lua.LState) int {
+	uv := checkActor(L)
+	name := L.CheckString(1)
+	kind := &actorKind{
+		handler: L.CheckFunction(2),
+	}
+	if tb := L.OptTable(3, nil); tb != nil {
+		if fn, ok := tb.RawGetString("load").(*lua.LFunction); ok {
+			kind.load = fn
+		}
+		if fn, ok := tb.RawGetString("save").(*lua.LFunction); ok {
+			kind.save = fn
+		}
+	}
+	uv.kinds[name] = kind
+	uv.start()
+	uv.env.Define(name)
+	return 0
+}
+
+// lSend actor.send(kind, id, message, cb?), cb is called once message is accepted by node owning actor
+func lSend(L *lua.LState) int {
+	uv := checkActor(L)
+	kind := params.String()
+	id := params.String()
+	message := params.Any()
+	cb := params.Check(L, 1, 3, "actor.send(kind, id, message, cb?)", kind, id, message)
+
+	body, err := codec.Encode("", message.Value())
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		if err := uv.env.Send(ctx, kind.String(), id.String(), body); err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb, lua.LNil))
+		return nil
+	}))
+	return 0
+}
+
+// lAsk actor.ask(kind, id, message, options?, cb), cb is called with reply of actor
+func lAsk(L *lua.LState) int {
+	uv := checkActor(L)
+	kind := params.String()
+	id := params.String()
+	message := params.Any()
+	options := params.Table()
+	cb := params.Check(L, 1, 3, "actor.ask(kind, id, message, options?, cb)", kind, id, message, options)
+
+	var timeout time.Duration
+	if tb := options.Table(); tb != nil {
+		if val, ok := tb.RawGetString("timeout").(lua.LNumber); ok {
+			timeout = time.Duration(val) * time.Millisecond
+		}
+	}
+	body, err := codec.Encode("", message.Value())
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		result, err := uv.env.Ask(ctx, kind.String(), id.String(), body, timeout)
+		uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			if err != nil {
+				return utils.CallLuaFunction(L, cb, utils.LError(err))
+			}
+			v, err := codec.Decode(L, "", result)
+			if err != nil {
+				return utils.CallLuaFunction(L, cb, utils.LError(err))
+			}
+			return utils.CallLuaFunction(L, cb, lua.LNil, v)
+		}))
+		return nil
+	}))
+	return 0
+}
@@ -0,0 +1,145 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/actor")
+}
+
+var _ = Describe("Actor", func() {
+	It("should keep state of actor", func() {
+		var defined []string
+		var done []string
+		replies := map[string]string{}
+		read := make(chan *Message, 4)
+		test.Async(`
+			local actor = require "actor"
+			actor.define("counter", function(self, message, reply)
+				self.state.count = (self.state.count or 0) + message.add
+				reply(nil, self.state.count)
+				if self.state.count == 3 then
+					resolve()
+				end
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Define: func(kind string) {
+						defined = append(defined, kind)
+					},
+					Reply: func(msg *Message, body []byte, err error) {
+						Expect(err).To(BeNil())
+						replies[msg.ID] = string(body)
+					},
+					Done: func(msg *Message) {
+						done = append(done, msg.ID)
+					},
+					ReadChan: func() <-chan *Message {
+						read <- &Message{ID: "1", Kind: "counter", ActorID: "a", Body: []byte(`{"add":1}`), IsAsk: true}
+						read <- &Message{ID: "2", Kind: "counter", ActorID: "b", Body: []byte(`{"add":5}`)}
+						read <- &Message{ID: "3", Kind: "counter", ActorID: "a", Body: []byte(`{"add":2}`), IsAsk: true}
+						return read
+					},
+				})
+			})
+		Expect(defined).To(Equal([]string{"counter"}))
+		Expect(done).To(Equal([]string{"1", "2", "3"}))
+		Expect(replies).To(Equal(map[string]string{"1": "1", "3": "3"}))
+	})
+
+	It("should load and save state", func() {
+		var saved []string
+		var errs []error
+		read := make(chan *Message, 4)
+		test.Async(`
+			local actor = require "actor"
+			local store = { a = { count = 10 } }
+			actor.define("counter", function(self, message, reply)
+				if message.fail then
+					error("boom")
+				end
+				self.state.count = self.state.count + 1
+				reply()
+			end, {
+				load = function(id, cb)
+					cb(nil, store[id])
+				end,
+				save = function(id, state, cb)
+					store[id] = state
+					cb(nil)
+					if state.count == 12 then
+						resolve()
+					end
+				end,
+			})
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Define: func(kind string) {},
+					Reply: func(msg *Message, body []byte, err error) {
+						errs = append(errs, err)
+					},
+					Done: func(msg *Message) {
+						saved = append(saved, msg.ID)
+					},
+					ReadChan: func() <-chan *Message {
+						read <- &Message{ID: "1", Kind: "counter", ActorID: "a", Body: []byte(`{}`)}
+						read <- &Message{ID: "2", Kind: "counter", ActorID: "a", Body: []byte(`{"fail":true}`), IsAsk: true}
+						read <- &Message{Kind: "counter", ActorID: "a", Deactivate: true}
+						read <- &Message{ID: "3", Kind: "counter", ActorID: "a", Body: []byte(`{}`)}
+						return read
+					},
+				})
+			})
+		Expect(saved).To(Equal([]string{"1", "2", "3"}))
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Error()).To(ContainSubstring("boom"))
+	})
+
+	It("should send and ask", func() {
+		test.Async(`
+			local actor = require "actor"
+			actor.send("room", "lobby", { text = "hi" }, function(err)
+				assert(err == nil, "err")
+				actor.ask("room", "lobby", { text = "who" }, { timeout = 1000 }, function(err, result)
+					assert(err == nil, "err")
+					assert(result.members == 2, "result")
+					actor.ask("room", "gone", {}, function(err, result)
+						assert(err == "no such room", "err")
+						resolve()
+					end)
+				end)
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Send: func(ctx context.Context, kind, id string, body []byte) error {
+						Expect(kind).To(Equal("room"))
+						Expect(id).To(Equal("lobby"))
+						Expect(string(body)).To(MatchJSON(`{"text":"hi"}`))
+						return nil
+					},
+					Ask: func(ctx context.Context, kind, id string, body []byte, timeout time.Duration) ([]byte, error) {
+						if id == "gone" {
+							Expect(timeout).To(BeZero())
+							return nil, errors.New("no such room")
+						}
+						Expect(timeout).To(Equal(time.Second))
+						return []byte(`{"members":2}`), nil
+					},
+				})
+			})
+	})
+})
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type Node struct {
+	Name    string
+	Addr    string
+	Labels  map[string]string
+	IsLocal bool
+}
+
+type lCluster struct {
+	nodes func() []*Node
+}
+
+func checkCluster(L *lua.LState) *lCluster {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lCluster); ok {
+		return u
+	}
+
+	L.RaiseError("expected cluster")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"nodes": lNodes,
+}
+
+func Open(L *lua.LState, nodes func() []*Node) {
+	ud := L.NewUserData()
+	ud.Value = &lCluster{
+		nodes: nodes,
+	}
+	utils.RegisterLuaModule(L, "cluster", funcs, ud)
+}
+
+func nodeTable(L *lua.LState, node *Node) *lua.LTable {
+	labels := L.NewTable()
+	for key, value := range node.Labels {
+		labels.RawSetString(key, lua.LString(value))
+	}
+	tb := L.NewTable()
+	tb.RawSetString("name", lua.LString(node.Name))
+	tb.RawSetString("address", lua.LString(node.Addr))
+	tb.RawSetString("labels", labels)
+	tb.RawSetString("is_local", lua.LBool(node.IsLocal))
+	return tb
+}
+
+// lNodes returns alive nodes, optionally only those having every label of selector
+func lNodes(L *lua.LState) int {
+	uv := checkCluster(L)
+	selector := L.OptTable(1, nil)
+	result := L.NewTable()
+	for _, node := range uv.nodes() {
+		if selector != nil && !matchSelector(node, selector) {
+			continue
+		}
+		result.Append(nodeTable(L, node))
+	}
+	L.Push(result)
+	return 1
+}
+
+func matchSelector(node *Node, selector *lua.LTable) bool {
+	matched := true
+	selector.ForEach(func(key, value lua.LValue) {
+		if v, ok := node.Labels[key.String()]; !ok || v != lua.LVAsString(value) {
+			matched = false
+		}
+	})
+	return matched
+}
@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/cluster")
+}
+
+var _ = Describe("Cluster", func() {
+	It("should list nodes", func() {
+		test.Sync(`
+			local cluster = require "cluster"
+			local nodes = cluster.nodes()
+			assert(table.getn(nodes) == 2, "nodes")
+			assert(nodes[1].name == "a", "name")
+			assert(nodes[1].address == "127.0.0.1:7946", "address")
+			assert(nodes[1].is_local, "is_local")
+			assert(nodes[1].labels.zone == "eu", "labels")
+
+			local workers = cluster.nodes({ role = "worker" })
+			assert(table.getn(workers) == 1, "selected nodes")
+			assert(workers[1].name == "b", "selected name")
+			`, func(L *lua.LState) {
+			Open(L, func() []*Node {
+				return []*Node{{
+					Name:    "a",
+					Addr:    "127.0.0.1:7946",
+					Labels:  map[string]string{"zone": "eu"},
+					IsLocal: true,
+				}, {
+					Name:   "b",
+					Addr:   "127.0.0.2:7946",
+					Labels: map[string]string{"zone": "us", "role": "worker"},
+				}}
+			})
+		})
+	})
+})
@@ -0,0 +1,331 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/joesonw/drlee/pkg/core/json"
+	"github.com/vmihailenco/msgpack/v5"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	JSON        = "json"
+	MessagePack = "msgpack"
+	CBOR        = "cbor"
+	Raw         = "raw"
+)
+
+var (
+	ErrNested       = errors.New("unable to encode recursively nested tables")
+	ErrInvalidKeys  = errors.New("unable to encode table keys other than strings and numbers")
+	ErrRawNotString = errors.New("raw codec only encodes strings")
+)
+
+// Codec encodes lua values into payload of rpc messages
+type Codec interface {
+	Name() string
+	Encode(value lua.LValue) ([]byte, error)
+	Decode(L *lua.LState, data []byte) (lua.LValue, error)
+}
+
+var (
+	codecs = map[string]Codec{}
+	mu     = &sync.RWMutex{}
+)
+
+//nolint:gochecknoinits
+func init() {
+	Register(jsonCodec{})
+	Register(msgpackCodec{})
+	Register(cborCodec{})
+	Register(rawCodec{})
+}
+
+// Register makes codec available by its name, an existing one with the same name is replaced
+func Register(codec Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// Get returns codec by name, empty name is json
+func Get(name string) (Codec, error) {
+	if name == "" {
+		name = JSON
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("codec \"%s\" is not found", name)
+	}
+	return codec, nil
+}
+
+// Encode encodes value with codec of name
+func Encode(name string, value lua.LValue) ([]byte, error) {
+	codec, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(value)
+}
+
+// Decode decodes data with codec of name
+func Decode(L *lua.LState, name string, data []byte) (lua.LValue, error) {
+	codec, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Decode(L, data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return JSON }
+
+func (jsonCodec) Encode(value lua.LValue) ([]byte, error) {
+	return json.Encode(value)
+}
+
+func (jsonCodec) Decode(L *lua.LState, data []byte) (lua.LValue, error) {
+	return json.Decode(L, data)
+}
+
+// rawCodec passes strings through as opaque bytes
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return Raw }
+
+func (rawCodec) Encode(value lua.LValue) ([]byte, error) {
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LString:
+		return []byte(v), nil
+	}
+	return nil, ErrRawNotString
+}
+
+func (rawCodec) Decode(L *lua.LState, data []byte) (lua.LValue, error) {
+	return lua.LString(data), nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return MessagePack }
+
+func (msgpackCodec) Encode(value lua.LValue) ([]byte, error) {
+	v, err := ToGo(value)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(L *lua.LState, data []byte) (lua.LValue, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.UseLooseInterfaceDecoding(true)
+	dec.SetMapDecoder(func(dec *msgpack.Decoder) (interface{}, error) {
+		return dec.DecodeUntypedMap()
+	})
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		return nil, err
+	}
+	return FromGo(L, v), nil
+}
+
+var cborEncMode, _ = cbor.CanonicalEncOptions().EncMode()
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return CBOR }
+
+func (cborCodec) Encode(value lua.LValue) ([]byte, error) {
+	v, err := ToGo(value)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncMode.Marshal(v)
+}
+
+func (cborCodec) Decode(L *lua.LState, data []byte) (lua.LValue, error) {
+	var v interface{}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return FromGo(L, v), nil
+}
+
+// ToGo converts lua value for binary codecs. Integral numbers become integers, strings that are not valid utf-8
+// become binary, tables with keys 1..n become arrays and other tables become maps (empty table is an empty array).
+func ToGo(value lua.LValue) (interface{}, error) {
+	return toGo(value, map[*lua.LTable]bool{})
+}
+
+//nolint:gocyclo
+func toGo(value lua.LValue, visited map[*lua.LTable]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 {
+			return int64(f), nil
+		}
+		return f, nil
+	case lua.LString:
+		if utf8.ValidString(string(v)) {
+			return string(v), nil
+		}
+		return []byte(v), nil
+	case *lua.LUserData:
+		if s, ok := v.Value.(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+		return nil, fmt.Errorf("unable to encode %s", v.Type().String())
+	case *lua.LTable:
+		if visited[v] {
+			return nil, ErrNested
+		}
+		visited[v] = true
+		defer delete(visited, v)
+
+		if n := v.Len(); n > 0 && isArray(v, n) {
+			arr := make([]interface{}, n)
+			for i := 1; i <= n; i++ {
+				item, err := toGo(v.RawGetInt(i), visited)
+				if err != nil {
+					return nil, err
+				}
+				arr[i-1] = item
+			}
+			return arr, nil
+		}
+
+		var err error
+		m := map[interface{}]interface{}{}
+		v.ForEach(func(key, item lua.LValue) {
+			if err != nil {
+				return
+			}
+			var k, val interface{}
+			switch key.(type) {
+			case lua.LString, lua.LNumber:
+				k, _ = toGo(key, visited)
+			default:
+				err = ErrInvalidKeys
+				return
+			}
+			val, err = toGo(item, visited)
+			m[k] = val
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(m) == 0 {
+			return []interface{}{}, nil
+		}
+		return stringKeyed(m), nil
+	}
+	return nil, fmt.Errorf("unable to encode %s", value.Type().String())
+}
+
+// stringKeyed converts map having only string keys, so that it's encoded the same way as objects of other languages
+func stringKeyed(m map[interface{}]interface{}) interface{} {
+	converted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		s, ok := key.(string)
+		if !ok {
+			return m
+		}
+		converted[s] = value
+	}
+	return converted
+}
+
+// isArray whether table only has keys 1..n
+func isArray(tb *lua.LTable, n int) bool {
+	count := 0
+	tb.ForEach(func(key, _ lua.LValue) {
+		count++
+	})
+	return count == n
+}
+
+// FromGo converts decoded value of binary codecs, binary is converted to string
+//nolint:gocyclo
+func FromGo(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int8:
+		return lua.LNumber(v)
+	case int16:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint:
+		return lua.LNumber(v)
+	case uint8:
+		return lua.LNumber(v)
+	case uint16:
+		return lua.LNumber(v)
+	case uint32:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case time.Time:
+		return lua.LNumber(v.UnixNano() / 1000000)
+	case []interface{}:
+		arr := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			arr.Append(FromGo(L, item))
+		}
+		return arr
+	case map[string]interface{}:
+		tb := L.CreateTable(0, len(v))
+		for key, item := range v {
+			tb.RawSetH(lua.LString(key), FromGo(L, item))
+		}
+		return tb
+	case map[interface{}]interface{}:
+		tb := L.CreateTable(0, len(v))
+		for key, item := range v {
+			tb.RawSet(FromGo(L, key), FromGo(L, item))
+		}
+		return tb
+	}
+	return lua.LNil
+}
@@ -0,0 +1,74 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/codec")
+}
+
+func roundTrip(name string) {
+	test.Sync(`
+		local value = {
+			name = "thumbnail",
+			size = 3,
+			ratio = 0.5,
+			ok = true,
+			data = "\0\1\2\255",
+			tags = { "a", "b" },
+			sparse = { [1] = "x", [3] = "y" },
+		}
+		local decoded = round_trip(value)
+		assert(decoded.name == "thumbnail", "string")
+		assert(decoded.size == 3, "integer")
+		assert(decoded.ratio == 0.5, "float")
+		assert(decoded.ok == true, "boolean")
+		assert(decoded.data == "\0\1\2\255", "binary")
+		assert(decoded.tags[2] == "b", "array")
+		assert(decoded.sparse[3] == "y", "sparse array")
+		`, func(L *lua.LState) {
+		L.SetGlobal("round_trip", L.NewFunction(func(L *lua.LState) int {
+			b, err := Encode(name, L.Get(1))
+			Expect(err).To(BeNil())
+			v, err := Decode(L, name, b)
+			Expect(err).To(BeNil())
+			L.Push(v)
+			return 1
+		}))
+	})
+}
+
+var _ = Describe("Codec", func() {
+	It("should round trip msgpack", func() {
+		roundTrip(MessagePack)
+	})
+
+	It("should round trip cbor", func() {
+		roundTrip(CBOR)
+	})
+
+	It("should pass raw bytes through", func() {
+		b, err := Encode(Raw, lua.LString("\x00\xff"))
+		Expect(err).To(BeNil())
+		Expect(b).To(Equal([]byte{0, 0xff}))
+
+		_, err = Encode(Raw, lua.LNumber(1))
+		Expect(err).To(Equal(ErrRawNotString))
+	})
+
+	It("should default to json", func() {
+		b, err := Encode("", lua.LString("hello"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal(`"hello"`))
+
+		_, err = Get("unknown")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,144 @@
+package consensus
+
+import (
+	"context"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type Env struct {
+	// Apply applies command to state replicated by raft, it returns once the command is committed and applied
+	Apply func(ctx context.Context, cmd *Command) (*Result, error)
+}
+
+type lConsensus struct {
+	env *Env
+	ec  *core.ExecutionContext
+}
+
+func checkConsensus(L *lua.LState) *lConsensus {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lConsensus); ok {
+		return u
+	}
+
+	L.RaiseError("expected consensus")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"get":    lGet,
+	"put":    lPut,
+	"delete": lDelete,
+	"cas":    lCAS,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lConsensus{
+		env: env,
+		ec:  ec,
+	}
+	utils.RegisterLuaModule(L, "consensus", funcs, ud)
+}
+
+// encodeOpt encodes value at n, nil is kept as nil
+func encodeOpt(L *lua.LState, n int) []byte {
+	value := L.Get(n)
+	if value == lua.LNil {
+		return nil
+	}
+	b, err := codec.Encode(codec.JSON, value)
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return b
+}
+
+// apply applies cmd and calls back with error followed by result of fn
+func (uv *lConsensus) apply(cmd *Command, cb lua.LValue, fn func(L *lua.LState, res *Result) ([]lua.LValue, error)) {
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		res, err := uv.env.Apply(ctx, cmd)
+		if err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			values, err := fn(L, res)
+			if err != nil {
+				return utils.CallLuaFunction(L, cb, utils.LError(err))
+			}
+			return utils.CallLuaFunction(L, cb, append([]lua.LValue{lua.LNil}, values...)...)
+		}))
+		return nil
+	}))
+}
+
+func decodeValue(L *lua.LState, res *Result) (lua.LValue, error) {
+	if !res.Exists {
+		return lua.LNil, nil
+	}
+	return codec.Decode(L, codec.JSON, res.Value)
+}
+
+// lGet reads key linearizably, value is nil if it doesn't exist
+func lGet(L *lua.LState) int {
+	uv := checkConsensus(L)
+	cmd := &Command{
+		Op:  OpGet,
+		Key: L.CheckString(1),
+	}
+	uv.apply(cmd, L.CheckFunction(2), func(L *lua.LState, res *Result) ([]lua.LValue, error) {
+		value, err := decodeValue(L, res)
+		return []lua.LValue{value}, err
+	})
+	return 0
+}
+
+func lPut(L *lua.LState) int {
+	uv := checkConsensus(L)
+	cmd := &Command{
+		Op:    OpPut,
+		Key:   L.CheckString(1),
+		Value: encodeOpt(L, 2),
+	}
+	if cmd.Value == nil {
+		L.ArgError(2, "value expected, use delete instead")
+	}
+	uv.apply(cmd, L.Get(3), func(*lua.LState, *Result) ([]lua.LValue, error) {
+		return nil, nil
+	})
+	return 0
+}
+
+func lDelete(L *lua.LState) int {
+	uv := checkConsensus(L)
+	cmd := &Command{
+		Op:  OpDelete,
+		Key: L.CheckString(1),
+	}
+	uv.apply(cmd, L.Get(2), func(*lua.LState, *Result) ([]lua.LValue, error) {
+		return nil, nil
+	})
+	return 0
+}
+
+// lCAS sets key to value if its current value equals to expected, nil expected means key doesn't exist and nil
+// value deletes key. cb receives whether it's swapped and the current value.
+func lCAS(L *lua.LState) int {
+	uv := checkConsensus(L)
+	cmd := &Command{
+		Op:       OpCAS,
+		Key:      L.CheckString(1),
+		Expected: encodeOpt(L, 2),
+		Value:    encodeOpt(L, 3),
+	}
+	uv.apply(cmd, L.Get(4), func(L *lua.LState, res *Result) ([]lua.LValue, error) {
+		value, err := decodeValue(L, res)
+		return []lua.LValue{lua.LBool(res.Swapped), value}, err
+	})
+	return 0
+}
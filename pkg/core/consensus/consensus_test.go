@@ -0,0 +1,118 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/consensus")
+}
+
+var _ = Describe("Consensus", func() {
+	It("should compare and swap", func() {
+		state := NewState()
+		res, err := state.Apply(&Command{Op: OpCAS, Key: "a", Value: []byte(`1`)})
+		Expect(err).To(BeNil())
+		Expect(res.Swapped).To(BeTrue())
+
+		res, err = state.Apply(&Command{Op: OpCAS, Key: "a", Value: []byte(`3`), Expected: []byte(`2`)})
+		Expect(err).To(BeNil())
+		Expect(res.Swapped).To(BeFalse())
+		Expect(res.Value).To(Equal([]byte(`1`)))
+
+		res, err = state.Apply(&Command{Op: OpCAS, Key: "a", Expected: []byte(`1`)})
+		Expect(err).To(BeNil())
+		Expect(res.Swapped).To(BeTrue())
+		res, _ = state.Apply(&Command{Op: OpGet, Key: "a"})
+		Expect(res.Exists).To(BeFalse())
+	})
+
+	It("should list entries by prefix", func() {
+		state := NewState()
+		_, _ = state.Apply(&Command{Op: OpPut, Key: "a/1", Value: []byte(`1`)})
+		_, _ = state.Apply(&Command{Op: OpPut, Key: "a/2", Value: []byte(`2`)})
+		_, _ = state.Apply(&Command{Op: OpPut, Key: "b/1", Value: []byte(`3`)})
+		Expect(state.Entries("a/")).To(Equal(map[string][]byte{"a/1": []byte(`1`), "a/2": []byte(`2`)}))
+	})
+
+	It("should hand over expired leases", func() {
+		state := NewState()
+		res, _ := state.Apply(&Command{Op: OpAcquire, Key: "l", Holder: "a", Node: "n1", TTL: 100, Now: 1000})
+		Expect(res.Swapped).To(BeTrue())
+		Expect(res.Lease.Token).To(Equal(uint64(1)))
+
+		res, _ = state.Apply(&Command{Op: OpAcquire, Key: "l", Holder: "b", Node: "n2", TTL: 100, Now: 1050})
+		Expect(res.Swapped).To(BeFalse())
+		Expect(res.Lease.Holder).To(Equal("a"))
+
+		res, _ = state.Apply(&Command{Op: OpRenew, Key: "l", Holder: "a", TTL: 100, Now: 1080})
+		Expect(res.Swapped).To(BeTrue())
+		Expect(res.Lease.ExpiresAt).To(Equal(int64(1180)))
+
+		res, _ = state.Apply(&Command{Op: OpAcquire, Key: "l", Holder: "b", Node: "n2", TTL: 100, Now: 1200})
+		Expect(res.Swapped).To(BeTrue())
+		Expect(res.Lease.Token).To(Equal(uint64(2)))
+		res, _ = state.Apply(&Command{Op: OpRenew, Key: "l", Holder: "a", TTL: 100, Now: 1210})
+		Expect(res.Swapped).To(BeFalse())
+
+		res, _ = state.Apply(&Command{Op: OpReleaseNode, Node: "n2"})
+		Expect(res.Swapped).To(BeTrue())
+		res, _ = state.Apply(&Command{Op: OpAcquire, Key: "l", Holder: "a", Node: "n1", TTL: 100, Now: 1220})
+		Expect(res.Swapped).To(BeTrue())
+		Expect(res.Lease.Token).To(Equal(uint64(3)))
+	})
+
+	It("should restore from snapshot", func() {
+		state := NewState()
+		_, _ = state.Apply(&Command{Op: OpPut, Key: "a", Value: []byte(`"b"`)})
+		buf := &bytes.Buffer{}
+		Expect(state.Clone().Encode(buf)).To(BeNil())
+
+		restored := NewState()
+		Expect(restored.Decode(buf)).To(BeNil())
+		res, _ := restored.Apply(&Command{Op: OpGet, Key: "a"})
+		Expect(res.Value).To(Equal([]byte(`"b"`)))
+	})
+
+	It("should get, put and cas from lua", func() {
+		state := NewState()
+		test.Async(`
+			local consensus = require "consensus"
+			consensus.put("counter", 1, function(err)
+				assert(err == nil, "put")
+				consensus.cas("counter", 1, 2, function(err, swapped, value)
+					assert(err == nil, "cas")
+					assert(swapped, "swapped")
+					assert(value == 2, "swapped value")
+					consensus.cas("counter", 1, 3, function(err, swapped, value)
+						assert(not swapped, "not swapped")
+						assert(value == 2, "current value")
+						consensus.delete("counter", function(err)
+							consensus.get("counter", function(err, value)
+								assert(err == nil, "get")
+								assert(value == nil, "deleted")
+								resolve()
+							end)
+						end)
+					end)
+				end)
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Apply: func(ctx context.Context, cmd *Command) (*Result, error) {
+						return state.Apply(cmd)
+					},
+				})
+			})
+	})
+})
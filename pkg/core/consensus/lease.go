@@ -0,0 +1,67 @@
+package consensus
+
+// Lease exclusive ownership of a name until it expires, Token increases every time the lease changes hands so that
+// it can be used to fence off stale holders
+type Lease struct {
+	Holder    string `json:"holder"`
+	Node      string `json:"node"`
+	ExpiresAt int64  `json:"expires_at"`
+	Token     uint64 `json:"token"`
+}
+
+func (l *Lease) isExpired(now int64) bool {
+	return l.ExpiresAt <= now
+}
+
+// acquire takes lease if it's free, expired or already held by the same holder (which renews it)
+func (s *State) acquire(cmd *Command) *Result {
+	lease, ok := s.leases[cmd.Key]
+	if ok && !lease.isExpired(cmd.Now) && lease.Holder != cmd.Holder {
+		copied := *lease
+		return &Result{Lease: &copied}
+	}
+	if !ok || lease.Holder != cmd.Holder || lease.isExpired(cmd.Now) {
+		s.tokens[cmd.Key]++
+		lease = &Lease{
+			Holder: cmd.Holder,
+			Node:   cmd.Node,
+			Token:  s.tokens[cmd.Key],
+		}
+		s.leases[cmd.Key] = lease
+	}
+	lease.ExpiresAt = cmd.Now + cmd.TTL
+	copied := *lease
+	return &Result{Lease: &copied, Swapped: true}
+}
+
+// renew extends lease only if it's still held by holder
+func (s *State) renew(cmd *Command) *Result {
+	lease, ok := s.leases[cmd.Key]
+	if !ok || lease.Holder != cmd.Holder || lease.isExpired(cmd.Now) {
+		return &Result{}
+	}
+	lease.ExpiresAt = cmd.Now + cmd.TTL
+	copied := *lease
+	return &Result{Lease: &copied, Swapped: true}
+}
+
+func (s *State) release(cmd *Command) *Result {
+	lease, ok := s.leases[cmd.Key]
+	if !ok || lease.Holder != cmd.Holder {
+		return &Result{}
+	}
+	delete(s.leases, cmd.Key)
+	return &Result{Swapped: true}
+}
+
+// releaseNode releases every lease held on node, it's issued once node leaves the cluster
+func (s *State) releaseNode(cmd *Command) *Result {
+	released := false
+	for name, lease := range s.leases {
+		if lease.Node == cmd.Node {
+			delete(s.leases, name)
+			released = true
+		}
+	}
+	return &Result{Swapped: released}
+}
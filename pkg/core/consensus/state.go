@@ -0,0 +1,176 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+type Op string
+
+const (
+	OpGet    Op = "get"
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+	OpCAS    Op = "cas"
+
+	OpAcquire     Op = "acquire"
+	OpRenew       Op = "renew"
+	OpRelease     Op = "release"
+	OpReleaseNode Op = "release_node"
+)
+
+// Command operation applied to replicated state through raft log, values are json encoded
+type Command struct {
+	Op    Op     `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	// Expected value of cas, nil expects key not to exist
+	Expected []byte `json:"expected,omitempty"`
+
+	// Holder and Node of lease operations, Node is where holder runs
+	Holder string `json:"holder,omitempty"`
+	Node   string `json:"node,omitempty"`
+	// TTL of lease in milliseconds
+	TTL int64 `json:"ttl,omitempty"`
+	// Now unix milliseconds set by the leader, so that every replica expires leases the same way
+	Now int64 `json:"now,omitempty"`
+}
+
+type Result struct {
+	Value  []byte `json:"value,omitempty"`
+	Exists bool   `json:"exists,omitempty"`
+	// Swapped whether cas or lease operation took effect
+	Swapped bool   `json:"swapped,omitempty"`
+	Lease   *Lease `json:"lease,omitempty"`
+}
+
+// State replicated key/value state, every replica applies the same commands in the same order
+type State struct {
+	mu      *sync.RWMutex
+	entries map[string][]byte
+	leases  map[string]*Lease
+	tokens  map[string]uint64
+}
+
+func NewState() *State {
+	return &State{
+		mu:      &sync.RWMutex{},
+		entries: map[string][]byte{},
+		leases:  map[string]*Lease{},
+		tokens:  map[string]uint64{},
+	}
+}
+
+func (s *State) Apply(cmd *Command) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.entries[cmd.Key]
+	switch cmd.Op {
+	case OpGet:
+		return &Result{Value: current, Exists: exists}, nil
+	case OpPut:
+		s.entries[cmd.Key] = cmd.Value
+		return &Result{}, nil
+	case OpDelete:
+		delete(s.entries, cmd.Key)
+		return &Result{Exists: exists}, nil
+	case OpCAS:
+		if cmd.Expected == nil {
+			if exists {
+				return &Result{Value: current, Exists: true}, nil
+			}
+		} else if !exists || !bytes.Equal(current, cmd.Expected) {
+			return &Result{Value: current, Exists: exists}, nil
+		}
+		if cmd.Value == nil {
+			delete(s.entries, cmd.Key)
+		} else {
+			s.entries[cmd.Key] = cmd.Value
+		}
+		return &Result{Value: cmd.Value, Exists: cmd.Value != nil, Swapped: true}, nil
+	case OpAcquire:
+		return s.acquire(cmd), nil
+	case OpRenew:
+		return s.renew(cmd), nil
+	case OpRelease:
+		return s.release(cmd), nil
+	case OpReleaseNode:
+		return s.releaseNode(cmd), nil
+	}
+	return nil, fmt.Errorf("unknown consensus op \"%s\"", cmd.Op)
+}
+
+// Entries copies entries of keys starting with prefix, it reads local replica so it may lag behind the leader
+func (s *State) Entries(prefix string) map[string][]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := map[string][]byte{}
+	for key, value := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			entries[key] = value
+		}
+	}
+	return entries
+}
+
+type snapshot struct {
+	Entries map[string][]byte `json:"entries"`
+	Leases  map[string]*Lease `json:"leases"`
+	Tokens  map[string]uint64 `json:"tokens"`
+}
+
+// Encode writes every entry and lease as json
+func (s *State) Encode(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.NewEncoder(w).Encode(&snapshot{
+		Entries: s.entries,
+		Leases:  s.leases,
+		Tokens:  s.tokens,
+	})
+}
+
+// Decode replaces every entry and lease with those written by Encode
+func (s *State) Decode(r io.Reader) error {
+	snap := &snapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string][]byte{}
+	s.leases = map[string]*Lease{}
+	s.tokens = map[string]uint64{}
+	for key, value := range snap.Entries {
+		s.entries[key] = value
+	}
+	for name, lease := range snap.Leases {
+		s.leases[name] = lease
+	}
+	for name, token := range snap.Tokens {
+		s.tokens[name] = token
+	}
+	return nil
+}
+
+// Clone copies state, so that it can be written while state is being changed
+func (s *State) Clone() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clone := NewState()
+	for key, value := range s.entries {
+		clone.entries[key] = value
+	}
+	for name, lease := range s.leases {
+		copied := *lease
+		clone.leases[name] = &copied
+	}
+	for name, token := range s.tokens {
+		clone.tokens[name] = token
+	}
+	return clone
+}
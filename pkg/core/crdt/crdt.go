@@ -0,0 +1,238 @@
+package crdt
+
+import (
+	"github.com/joesonw/drlee/pkg/core/object"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type Env struct {
+	NodeName string
+	// Update applies update to crdt of name and replicates it to peers
+	Update func(name string, kind Kind, update func(item CRDT)) error
+	View   func(name string, kind Kind, view func(item CRDT)) error
+}
+
+type lCRDT struct {
+	env *Env
+}
+
+type lHandle struct {
+	uv   *lCRDT
+	name string
+	kind Kind
+}
+
+func checkCRDT(L *lua.LState) *lCRDT {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lCRDT); ok {
+		return u
+	}
+
+	L.RaiseError("expected crdt")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"gcounter": lNewHandle(KindGCounter, gCounterFuncs),
+	"counter":  lNewHandle(KindPNCounter, pnCounterFuncs),
+	"set":      lNewHandle(KindORSet, orSetFuncs),
+	"max":      lNewHandle(KindMaxRegister, maxRegisterFuncs),
+}
+
+func Open(L *lua.LState, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lCRDT{
+		env: env,
+	}
+	utils.RegisterLuaModule(L, "crdt", funcs, ud)
+}
+
+func lNewHandle(kind Kind, handleFuncs map[string]lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		uv := checkCRDT(L)
+		h := &lHandle{
+			uv:   uv,
+			name: L.CheckString(1),
+			kind: kind,
+		}
+		// fails early if name is taken by another kind
+		if err := uv.env.View(h.name, kind, func(CRDT) {}); err != nil {
+			L.RaiseError(err.Error())
+			return 0
+		}
+		L.Push(object.NewReadOnly(L, handleFuncs, map[string]lua.LValue{
+			"name": lua.LString(h.name),
+		}, h).Value())
+		return 1
+	}
+}
+
+func checkHandle(L *lua.LState) *lHandle {
+	h, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return h.(*lHandle)
+}
+
+func (h *lHandle) update(L *lua.LState, update func(item CRDT)) {
+	if err := h.uv.env.Update(h.name, h.kind, update); err != nil {
+		L.RaiseError(err.Error())
+	}
+}
+
+func (h *lHandle) view(L *lua.LState, view func(item CRDT)) {
+	if err := h.uv.env.View(h.name, h.kind, view); err != nil {
+		L.RaiseError(err.Error())
+	}
+}
+
+// checkAmount optional non-negative amount at n, defaults to 1
+func checkAmount(L *lua.LState, n int) uint64 {
+	amount := L.OptNumber(n, 1)
+	if amount < 0 {
+		L.ArgError(n, "amount must not be negative")
+	}
+	return uint64(amount)
+}
+
+var gCounterFuncs = map[string]lua.LGFunction{
+	"increment": lCounterIncrement,
+	"value":     lCounterValue,
+}
+
+var pnCounterFuncs = map[string]lua.LGFunction{
+	"increment": lCounterIncrement,
+	"decrement": lCounterDecrement,
+	"value":     lCounterValue,
+}
+
+func lCounterIncrement(L *lua.LState) int {
+	h := checkHandle(L)
+	amount := checkAmount(L, 2)
+	nodeName := h.uv.env.NodeName
+	h.update(L, func(item CRDT) {
+		switch c := item.(type) {
+		case *GCounter:
+			c.Increment(nodeName, amount)
+		case *PNCounter:
+			c.Increment(nodeName, amount)
+		}
+	})
+	return 0
+}
+
+func lCounterDecrement(L *lua.LState) int {
+	h := checkHandle(L)
+	amount := checkAmount(L, 2)
+	nodeName := h.uv.env.NodeName
+	h.update(L, func(item CRDT) {
+		item.(*PNCounter).Decrement(nodeName, amount)
+	})
+	return 0
+}
+
+func lCounterValue(L *lua.LState) int {
+	h := checkHandle(L)
+	var value lua.LNumber
+	h.view(L, func(item CRDT) {
+		switch c := item.(type) {
+		case *GCounter:
+			value = lua.LNumber(c.Value())
+		case *PNCounter:
+			value = lua.LNumber(c.Value())
+		}
+	})
+	L.Push(value)
+	return 1
+}
+
+var orSetFuncs = map[string]lua.LGFunction{
+	"add":      lSetAdd,
+	"remove":   lSetRemove,
+	"contains": lSetContains,
+	"values":   lSetValues,
+	"size":     lSetSize,
+}
+
+func lSetAdd(L *lua.LState) int {
+	h := checkHandle(L)
+	element := L.CheckString(2)
+	nodeName := h.uv.env.NodeName
+	h.update(L, func(item CRDT) {
+		item.(*ORSet).Add(nodeName, element)
+	})
+	return 0
+}
+
+func lSetRemove(L *lua.LState) int {
+	h := checkHandle(L)
+	element := L.CheckString(2)
+	h.update(L, func(item CRDT) {
+		item.(*ORSet).Remove(element)
+	})
+	return 0
+}
+
+func lSetContains(L *lua.LState) int {
+	h := checkHandle(L)
+	element := L.CheckString(2)
+	var contains bool
+	h.view(L, func(item CRDT) {
+		contains = item.(*ORSet).Contains(element)
+	})
+	L.Push(lua.LBool(contains))
+	return 1
+}
+
+func lSetValues(L *lua.LState) int {
+	h := checkHandle(L)
+	var values []string
+	h.view(L, func(item CRDT) {
+		values = item.(*ORSet).Values()
+	})
+	result := L.CreateTable(len(values), 0)
+	for _, value := range values {
+		result.Append(lua.LString(value))
+	}
+	L.Push(result)
+	return 1
+}
+
+func lSetSize(L *lua.LState) int {
+	h := checkHandle(L)
+	var size int
+	h.view(L, func(item CRDT) {
+		size = len(item.(*ORSet).Entries)
+	})
+	L.Push(lua.LNumber(size))
+	return 1
+}
+
+var maxRegisterFuncs = map[string]lua.LGFunction{
+	"set":   lMaxSet,
+	"value": lMaxValue,
+}
+
+func lMaxSet(L *lua.LState) int {
+	h := checkHandle(L)
+	value := L.CheckNumber(2)
+	h.update(L, func(item CRDT) {
+		item.(*MaxRegister).Set(float64(value))
+	})
+	return 0
+}
+
+// lMaxValue returns nil if it's never set
+func lMaxValue(L *lua.LState) int {
+	h := checkHandle(L)
+	var value lua.LValue = lua.LNil
+	h.view(L, func(item CRDT) {
+		if r := item.(*MaxRegister); r.IsSet {
+			value = lua.LNumber(r.Value)
+		}
+	})
+	L.Push(value)
+	return 1
+}
@@ -0,0 +1,165 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/crdt")
+}
+
+func newEnv(nodeName string, store *Store) *Env {
+	return &Env{
+		NodeName: nodeName,
+		Update: func(name string, kind Kind, update func(item CRDT)) error {
+			_, err := store.Update(name, kind, nodeName, update)
+			return err
+		},
+		View: store.View,
+	}
+}
+
+// replicate merges every state of from into to
+func replicate(from, to *Store) {
+	states, err := from.Snapshot()
+	Expect(err).To(BeNil())
+	for _, state := range states {
+		_, err := to.Merge(state)
+		Expect(err).To(BeNil())
+	}
+}
+
+var _ = Describe("CRDT", func() {
+	It("should converge counters", func() {
+		a := NewPNCounter()
+		b := NewPNCounter()
+		a.Increment("a", 3)
+		b.Increment("b", 2)
+		b.Decrement("b", 1)
+		Expect(a.Merge(b)).To(BeTrue())
+		Expect(b.Merge(a)).To(BeTrue())
+		Expect(a.Merge(b)).To(BeFalse())
+		Expect(a.Value()).To(Equal(int64(4)))
+		Expect(b.Value()).To(Equal(int64(4)))
+	})
+
+	It("should let concurrent add win over remove", func() {
+		a := NewORSet()
+		b := NewORSet()
+		a.Add("a", "x")
+		b.Merge(a)
+		b.Remove("x")
+		a.Add("a", "x")
+		a.Add("a", "y")
+		a.Merge(b)
+		b.Merge(a)
+		Expect(a.Values()).To(Equal([]string{"x", "y"}))
+		Expect(b.Values()).To(Equal([]string{"x", "y"}))
+
+		b.Remove("x")
+		a.Merge(b)
+		Expect(a.Values()).To(Equal([]string{"y"}))
+	})
+
+	It("should gossip counters with slot of updating node only", func() {
+		store := NewStore()
+		for _, node := range []string{"a", "b", "c"} {
+			_, err := store.Update("hits", KindPNCounter, node, func(item CRDT) {
+				item.(*PNCounter).Increment(node, 2)
+			})
+			Expect(err).To(BeNil())
+		}
+		state, err := store.Update("hits", KindPNCounter, "b", func(item CRDT) {
+			item.(*PNCounter).Decrement("b", 1)
+		})
+		Expect(err).To(BeNil())
+		Expect(string(state.Data)).To(MatchJSON(`{"p":{"counts":{"b":2}},"n":{"counts":{"b":1}}}`))
+
+		other := NewStore()
+		_, err = other.Update("hits", KindPNCounter, "a", func(item CRDT) {
+			item.(*PNCounter).Increment("a", 2)
+		})
+		Expect(err).To(BeNil())
+		Expect(other.Merge(state)).To(BeTrue())
+		Expect(other.View("hits", KindPNCounter, func(item CRDT) {
+			Expect(item.(*PNCounter).Value()).To(Equal(int64(3)))
+		})).To(Succeed())
+
+		state, err = store.Update("online", KindORSet, "a", func(item CRDT) {
+			item.(*ORSet).Add("a", "x")
+		})
+		Expect(err).To(BeNil())
+		Expect(string(state.Data)).To(MatchJSON(`{"clock":{"a":1},"entries":{"x":{"a":1}}}`))
+	})
+
+	It("should keep max value", func() {
+		a := &MaxRegister{}
+		b := &MaxRegister{}
+		a.Set(3)
+		b.Set(5)
+		Expect(a.Merge(b)).To(BeTrue())
+		Expect(b.Merge(a)).To(BeFalse())
+		Expect(a.Value).To(Equal(float64(5)))
+	})
+
+	It("should update from lua", func() {
+		a := NewStore()
+		b := NewStore()
+		test.Sync(`
+			local crdt = require "crdt"
+			local online = crdt.counter("online")
+			online:increment()
+			online:increment(2)
+			online:decrement()
+			assert(online:value() == 2, "counter")
+
+			local visits = crdt.gcounter("visits")
+			visits:increment()
+			assert(visits:value() == 1, "gcounter")
+
+			local presence = crdt.set("presence")
+			presence:add("alice")
+			presence:add("bob")
+			presence:remove("alice")
+			assert(presence:contains("bob"), "contains")
+			assert(not presence:contains("alice"), "removed")
+			assert(presence:size() == 1, "size")
+			assert(presence:values()[1] == "bob", "values")
+
+			local highest = crdt.max("highest")
+			assert(highest:value() == nil, "unset")
+			highest:set(3)
+			highest:set(1)
+			assert(highest:value() == 3, "max")
+
+			local ok = pcall(crdt.set, "online")
+			assert(not ok, "kind conflict")
+			`, func(L *lua.LState) {
+			Open(L, newEnv("a", a))
+		})
+		test.Sync(`
+			local crdt = require "crdt"
+			crdt.counter("online"):increment(5)
+			crdt.set("presence"):add("carol")
+			`, func(L *lua.LState) {
+			Open(L, newEnv("b", b))
+		})
+
+		replicate(a, b)
+		replicate(b, a)
+		for _, store := range []*Store{a, b} {
+			Expect(store.View("online", KindPNCounter, func(item CRDT) {
+				Expect(item.(*PNCounter).Value()).To(Equal(int64(7)))
+			})).To(BeNil())
+			Expect(store.View("presence", KindORSet, func(item CRDT) {
+				Expect(item.(*ORSet).Values()).To(Equal([]string{"bob", "carol"}))
+			})).To(BeNil())
+		}
+	})
+})
@@ -0,0 +1,116 @@
+package crdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// State json encoded state of a named crdt, it's how crdts are replicated and persisted
+type State struct {
+	Name string          `json:"name"`
+	Kind Kind            `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Store named crdts of a node
+type Store struct {
+	mu    *sync.RWMutex
+	items map[string]CRDT
+}
+
+func NewStore() *Store {
+	return &Store{
+		mu:    &sync.RWMutex{},
+		items: map[string]CRDT{},
+	}
+}
+
+func (s *Store) get(name string, kind Kind, create bool) (CRDT, error) {
+	item, ok := s.items[name]
+	if !ok {
+		if !create {
+			return New(kind)
+		}
+		var err error
+		item, err = New(kind)
+		if err != nil {
+			return nil, err
+		}
+		s.items[name] = item
+	}
+	if item.Kind() != kind {
+		return nil, fmt.Errorf("crdt \"%s\" is a %s, not %s", name, item.Kind(), kind)
+	}
+	return item, nil
+}
+
+// Update applies update made by node to crdt of name, it's created if missing. Returns delta of the update, see Delta
+func (s *Store) Update(name string, kind Kind, node string, update func(item CRDT)) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := s.get(name, kind, true)
+	if err != nil {
+		return nil, err
+	}
+	update(item)
+	data, err := json.Marshal(Delta(item, node))
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Name: name,
+		Kind: kind,
+		Data: data,
+	}, nil
+}
+
+// View calls view with crdt of name, an empty one is given if missing
+func (s *Store) View(name string, kind Kind, view func(item CRDT)) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, err := s.get(name, kind, false)
+	if err != nil {
+		return err
+	}
+	view(item)
+	return nil
+}
+
+// Merge merges state received from peers or disk, returns whether local state is changed
+func (s *Store) Merge(state *State) (bool, error) {
+	other, err := Decode(state.Kind, state.Data)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[state.Name]
+	if !ok {
+		s.items[state.Name] = other
+		return true, nil
+	}
+	if item.Kind() != state.Kind {
+		return false, fmt.Errorf("crdt \"%s\" is a %s, not %s", state.Name, item.Kind(), state.Kind)
+	}
+	return item.Merge(other), nil
+}
+
+// Snapshot states of every crdt
+func (s *Store) Snapshot() ([]*State, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	states := make([]*State, 0, len(s.items))
+	for name, item := range s.items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, &State{
+			Name: name,
+			Kind: item.Kind(),
+			Data: data,
+		})
+	}
+	return states, nil
+}
@@ -0,0 +1,276 @@
+package crdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+type Kind string
+
+const (
+	KindGCounter    Kind = "gcounter"
+	KindPNCounter   Kind = "pncounter"
+	KindORSet       Kind = "orset"
+	KindMaxRegister Kind = "max"
+)
+
+// CRDT state based convergent data type
+type CRDT interface {
+	Kind() Kind
+	// Merge merges state of the same kind, returns whether local state is changed
+	Merge(other CRDT) bool
+}
+
+func New(kind Kind) (CRDT, error) {
+	switch kind {
+	case KindGCounter:
+		return NewGCounter(), nil
+	case KindPNCounter:
+		return NewPNCounter(), nil
+	case KindORSet:
+		return NewORSet(), nil
+	case KindMaxRegister:
+		return &MaxRegister{}, nil
+	}
+	return nil, fmt.Errorf("crdt kind \"%s\" is not supported", kind)
+}
+
+// Decode decodes json encoded state of kind
+func Decode(kind Kind, data []byte) (CRDT, error) {
+	item, err := New(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Delta part of item a change by node is gossiped with. Counters only need the slot of node, others are whole.
+func Delta(item CRDT, node string) CRDT {
+	switch c := item.(type) {
+	case *GCounter:
+		return c.delta(node)
+	case *PNCounter:
+		return &PNCounter{
+			P: c.P.delta(node),
+			N: c.N.delta(node),
+		}
+	}
+	return item
+}
+
+// GCounter grow-only counter, each node increments its own slot
+type GCounter struct {
+	Counts map[string]uint64 `json:"counts"`
+}
+
+func NewGCounter() *GCounter {
+	return &GCounter{Counts: map[string]uint64{}}
+}
+
+func (c *GCounter) Kind() Kind { return KindGCounter }
+
+func (c *GCounter) Increment(node string, n uint64) {
+	if c.Counts == nil {
+		c.Counts = map[string]uint64{}
+	}
+	c.Counts[node] += n
+}
+
+func (c *GCounter) delta(node string) *GCounter {
+	delta := NewGCounter()
+	if n, ok := c.Counts[node]; ok {
+		delta.Counts[node] = n
+	}
+	return delta
+}
+
+func (c *GCounter) Value() uint64 {
+	var sum uint64
+	for _, n := range c.Counts {
+		sum += n
+	}
+	return sum
+}
+
+func (c *GCounter) Merge(other CRDT) bool {
+	o, ok := other.(*GCounter)
+	if !ok {
+		return false
+	}
+	if c.Counts == nil {
+		c.Counts = map[string]uint64{}
+	}
+	changed := false
+	for node, n := range o.Counts {
+		if n > c.Counts[node] {
+			c.Counts[node] = n
+			changed = true
+		}
+	}
+	return changed
+}
+
+// PNCounter counter supports both increment and decrement
+type PNCounter struct {
+	P *GCounter `json:"p"`
+	N *GCounter `json:"n"`
+}
+
+func NewPNCounter() *PNCounter {
+	return &PNCounter{
+		P: NewGCounter(),
+		N: NewGCounter(),
+	}
+}
+
+func (c *PNCounter) Kind() Kind { return KindPNCounter }
+
+func (c *PNCounter) Increment(node string, n uint64) {
+	c.P.Increment(node, n)
+}
+
+func (c *PNCounter) Decrement(node string, n uint64) {
+	c.N.Increment(node, n)
+}
+
+func (c *PNCounter) Value() int64 {
+	return int64(c.P.Value()) - int64(c.N.Value())
+}
+
+func (c *PNCounter) Merge(other CRDT) bool {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return false
+	}
+	p := c.P.Merge(o.P)
+	n := c.N.Merge(o.N)
+	return p || n
+}
+
+// ORSet observed-remove set (add wins), every add is tagged with a dot of adding node, concurrent adds survive a
+// remove that hasn't observed them. Removed elements leave no tombstones, the version vector tells them apart from
+// adds not yet seen.
+type ORSet struct {
+	Clock   map[string]uint64            `json:"clock"`
+	Entries map[string]map[string]uint64 `json:"entries"`
+}
+
+func NewORSet() *ORSet {
+	return &ORSet{
+		Clock:   map[string]uint64{},
+		Entries: map[string]map[string]uint64{},
+	}
+}
+
+func (s *ORSet) Kind() Kind { return KindORSet }
+
+func (s *ORSet) init() {
+	if s.Clock == nil {
+		s.Clock = map[string]uint64{}
+	}
+	if s.Entries == nil {
+		s.Entries = map[string]map[string]uint64{}
+	}
+}
+
+func (s *ORSet) Add(node, element string) {
+	s.init()
+	s.Clock[node]++
+	s.Entries[element] = map[string]uint64{node: s.Clock[node]}
+}
+
+func (s *ORSet) Remove(element string) {
+	delete(s.Entries, element)
+}
+
+func (s *ORSet) Contains(element string) bool {
+	_, ok := s.Entries[element]
+	return ok
+}
+
+// Values sorted elements
+func (s *ORSet) Values() []string {
+	values := make([]string, 0, len(s.Entries))
+	for element := range s.Entries {
+		values = append(values, element)
+	}
+	sort.Strings(values)
+	return values
+}
+
+//nolint:gocyclo
+func (s *ORSet) Merge(other CRDT) bool {
+	o, ok := other.(*ORSet)
+	if !ok {
+		return false
+	}
+	s.init()
+	changed := false
+
+	for element, dots := range s.Entries {
+		otherDots := o.Entries[element]
+		for node, counter := range dots {
+			// dropped if other has seen the dot but doesn't have it anymore
+			if otherDots[node] != counter && counter <= o.Clock[node] {
+				delete(dots, node)
+				changed = true
+			}
+		}
+		if len(dots) == 0 {
+			delete(s.Entries, element)
+		}
+	}
+
+	for element, otherDots := range o.Entries {
+		dots := s.Entries[element]
+		for node, counter := range otherDots {
+			if dots[node] == counter || counter <= s.Clock[node] {
+				continue
+			}
+			if dots == nil {
+				dots = map[string]uint64{}
+				s.Entries[element] = dots
+			}
+			dots[node] = counter
+			changed = true
+		}
+	}
+
+	for node, counter := range o.Clock {
+		if counter > s.Clock[node] {
+			s.Clock[node] = counter
+			changed = true
+		}
+	}
+	return changed
+}
+
+// MaxRegister keeps the greatest value ever set
+type MaxRegister struct {
+	Value float64 `json:"value"`
+	IsSet bool    `json:"is_set"`
+}
+
+func (r *MaxRegister) Kind() Kind { return KindMaxRegister }
+
+// Set returns whether value is greater than the current one
+func (r *MaxRegister) Set(value float64) bool {
+	if r.IsSet && value <= r.Value {
+		return false
+	}
+	r.Value = value
+	r.IsSet = true
+	return true
+}
+
+func (r *MaxRegister) Merge(other CRDT) bool {
+	o, ok := other.(*MaxRegister)
+	if !ok || !o.IsSet {
+		return false
+	}
+	return r.Set(o.Value)
+}
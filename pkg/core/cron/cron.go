@@ -0,0 +1,201 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/object"
+	coreTime "github.com/joesonw/drlee/pkg/core/time"
+	"github.com/joesonw/drlee/pkg/utils"
+	"github.com/robfig/cron/v3"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Mode where a job runs on every tick
+type Mode string
+
+const (
+	// ModeWorker runs on every worker of every node
+	ModeWorker Mode = "worker"
+	// ModeNode runs on one worker of every node
+	ModeNode Mode = "node"
+	// ModeCluster runs on one worker of the cluster
+	ModeCluster Mode = "cluster"
+)
+
+type Env struct {
+	// IsOwner whether job of name should run on current worker at this tick, it's asked on every tick so that
+	// ownership fails over as membership changes
+	IsOwner func(name string, mode Mode) bool
+}
+
+type lCron struct {
+	env  *Env
+	ec   *core.ExecutionContext
+	mu   *sync.Mutex
+	jobs map[string]*lJob
+}
+
+type lJob struct {
+	uv       *lCron
+	name     string
+	mode     Mode
+	schedule cron.Schedule
+	handler  *lua.LFunction
+	stop     chan struct{}
+	stopOnce *sync.Once
+	resource core.Resource
+}
+
+func checkCron(L *lua.LState) *lCron {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lCron); ok {
+		return u
+	}
+
+	L.RaiseError("expected cron")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"schedule": lSchedule,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lCron{
+		env:  env,
+		ec:   ec,
+		mu:   &sync.Mutex{},
+		jobs: map[string]*lJob{},
+	}
+	utils.RegisterLuaModule(L, "cron", funcs, ud)
+}
+
+// Parse parses standard cron expression (or descriptors like @daily), it's evaluated in timezone if it's not empty
+func Parse(expr, timezone string) (cron.Schedule, error) {
+	if timezone != "" && !strings.HasPrefix(expr, "CRON_TZ=") && !strings.HasPrefix(expr, "TZ=") {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+		expr = fmt.Sprintf("CRON_TZ=%s %s", timezone, expr)
+	}
+	return cron.ParseStandard(expr)
+}
+
+// lSchedule cron.schedule(name, expr, handler, options?), name identifies job across workers and nodes
+func lSchedule(L *lua.LState) int {
+	uv := checkCron(L)
+	name := L.CheckString(1)
+	expr := L.CheckString(2)
+	handler := L.CheckFunction(3)
+	mode := ModeCluster
+	timezone := ""
+	if options := L.OptTable(4, nil); options != nil {
+		if v := options.RawGetString("mode"); v != lua.LNil {
+			mode = Mode(lua.LVAsString(v))
+		}
+		if v := options.RawGetString("timezone"); v != lua.LNil {
+			timezone = lua.LVAsString(v)
+		}
+	}
+	switch mode {
+	case ModeWorker, ModeNode, ModeCluster:
+	default:
+		L.ArgError(4, fmt.Sprintf("unknown mode \"%s\"", mode))
+	}
+	schedule, err := Parse(expr, timezone)
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+
+	job := &lJob{
+		uv:       uv,
+		name:     name,
+		mode:     mode,
+		schedule: schedule,
+		handler:  handler,
+		stop:     make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}
+	uv.mu.Lock()
+	_, exists := uv.jobs[name]
+	if !exists {
+		uv.jobs[name] = job
+	}
+	uv.mu.Unlock()
+	if exists {
+		L.RaiseError("cron job \"%s\" is already scheduled", name)
+	}
+	job.resource = core.NewResource(fmt.Sprintf("cron job \"%s\"", name), job.close)
+	uv.ec.Guard(job.resource)
+	go job.run()
+
+	L.Push(object.NewReadOnly(L, jobFuncs, map[string]lua.LValue{
+		"name": lua.LString(name),
+		"mode": lua.LString(mode),
+	}, job).Value())
+	return 1
+}
+
+func (job *lJob) run() {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-job.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !job.uv.env.IsOwner(job.name, job.mode) {
+			continue
+		}
+		job.uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			return utils.CallLuaFunction(L, job.handler, coreTime.New(L, next).Value())
+		}))
+	}
+}
+
+func (job *lJob) close() {
+	job.stopOnce.Do(func() {
+		close(job.stop)
+		job.uv.mu.Lock()
+		delete(job.uv.jobs, job.name)
+		job.uv.mu.Unlock()
+	})
+}
+
+var jobFuncs = map[string]lua.LGFunction{
+	"next": lJobNext,
+	"stop": lJobStop,
+}
+
+func checkJob(L *lua.LState) *lJob {
+	job, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return job.(*lJob)
+}
+
+// lJobNext time of next tick, regardless of whether it runs on current worker
+func lJobNext(L *lua.LState) int {
+	job := checkJob(L)
+	L.Push(coreTime.New(L, job.schedule.Next(time.Now())).Value())
+	return 1
+}
+
+func lJobStop(L *lua.LState) int {
+	job := checkJob(L)
+	job.resource.Cancel()
+	job.close()
+	return 0
+}
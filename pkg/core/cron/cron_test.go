@@ -0,0 +1,60 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/atomic"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/cron")
+}
+
+var _ = Describe("Cron", func() {
+	It("should evaluate in timezone", func() {
+		schedule, err := Parse("0 2 * * *", "Asia/Tokyo")
+		Expect(err).To(BeNil())
+		tokyo, _ := time.LoadLocation("Asia/Tokyo")
+		next := schedule.Next(time.Date(2020, 1, 1, 3, 0, 0, 0, tokyo))
+		Expect(next.Equal(time.Date(2020, 1, 2, 2, 0, 0, 0, tokyo))).To(BeTrue())
+
+		_, err = Parse("0 2 * * *", "Nowhere/Unknown")
+		Expect(err).NotTo(BeNil())
+		_, err = Parse("0 25 * * *", "")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("should run only if owned", func() {
+		asked := atomic.NewInt32(0)
+		test.Async(`
+			local cron = require "cron"
+			cron.schedule("skipped", "@every 1s", function()
+				error("should not run")
+			end, { mode = "node" })
+			local job
+			job = cron.schedule("owned", "@every 1s", function(t)
+				assert(t.milliunix > 0, "tick time")
+				job:stop()
+				resolve()
+			end)
+			assert(not pcall(cron.schedule, "owned", "@every 1s", function() end), "duplicated")
+			assert(not pcall(cron.schedule, "invalid", "@every 1s", function() end, { mode = "unknown" }), "unknown mode")
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					IsOwner: func(name string, mode Mode) bool {
+						asked.Inc()
+						return name == "owned" && mode == ModeCluster
+					},
+				})
+			})
+		Expect(asked.Load()).To(BeNumerically(">=", 1))
+	})
+})
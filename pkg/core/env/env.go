@@ -12,6 +12,7 @@ type Env struct {
 	WorkerID int
 	WorkDir  string
 	Args     []string
+	Labels   map[string]string
 }
 
 func Open(L *lua.LState, ec *core.ExecutionContext, env Env) {
@@ -19,11 +20,16 @@ func Open(L *lua.LState, ec *core.ExecutionContext, env Env) {
 	for _, arg := range env.Args {
 		args.Append(lua.LString(arg))
 	}
+	labels := L.NewTable()
+	for key, value := range env.Labels {
+		labels.RawSetString(key, lua.LString(value))
+	}
 	obj := object.NewReadOnly(L, map[string]lua.LGFunction{}, map[string]lua.LValue{
 		"node":       lua.LString(env.NodeName),
 		"worker_id":  lua.LNumber(env.WorkerID),
 		"worker_dir": lua.LString(env.WorkDir),
 		"args":       args,
+		"labels":     labels,
 	}, &env)
 	utils.RegisterLuaModuleObject(L, "env", obj.Value())
 }
@@ -21,11 +21,13 @@ var _ = Describe("Env", func() {
 			assert(env.node == "node", "node")
 			assert(env.worker_id == 2, "worker_id")
 			assert(env.worker_dir == "/", "worker_dir")
+			assert(env.labels.zone == "eu", "labels")
 			`, func(L *lua.LState) {
 			Open(L, nil, Env{
 				NodeName: "node",
 				WorkerID: 2,
 				WorkDir:  "/",
+				Labels:   map[string]string{"zone": "eu"},
 			})
 		})
 	})
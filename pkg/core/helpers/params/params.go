@@ -11,6 +11,7 @@ type Type interface {
 	setValue(value lua.LValue)
 }
 
+// AnyType accepts values of any type, Type only names it in error messages
 type AnyType struct {
 	value lua.LValue
 }
@@ -192,7 +193,7 @@ func Check(L *lua.LState, startIndex, requiredLength int, msg string, types ...T
 	for i := 0; i < n; i++ {
 		idx := startIndex + i
 		val := L.Get(idx)
-		if val.Type() != types[i].Type() {
+		if _, isAny := types[i].(*AnyType); !isAny && val.Type() != types[i].Type() {
 			L.RaiseError(fmt.Sprintf("bad arguments for %s: argument %d should be of type %s, but have %s", msg, idx, types[i].Type().String(), val.Type().String()))
 		} else {
 			types[i].setValue(val)
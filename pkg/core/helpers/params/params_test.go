@@ -0,0 +1,41 @@
+package params
+
+import (
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/helpers/params")
+}
+
+var _ = Describe("Params", func() {
+	It("should accept any type for any", func() {
+		var values []lua.LValue
+		test.Sync(`
+			check("a", 1)
+			check("a", { 1 })
+			check("a", true, function() end)
+			assert(not pcall(check, 1, 1), "string expected")
+			assert(not pcall(check), "required")
+			`, func(L *lua.LState) {
+			L.SetGlobal("check", L.NewFunction(func(L *lua.LState) int {
+				name := String()
+				value := Any()
+				Check(L, 1, 2, "check(name, value, cb?)", name, value)
+				Expect(name.String()).To(Equal("a"))
+				values = append(values, value.Value())
+				return 0
+			}))
+		})
+		Expect(values).To(HaveLen(3))
+		Expect(values[0]).To(Equal(lua.LNumber(1)))
+		Expect(values[1].Type()).To(Equal(lua.LTTable))
+		Expect(values[2]).To(Equal(lua.LTrue))
+	})
+})
@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/core/helpers/params"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type Job struct {
+	ID      string
+	Queue   string
+	Payload []byte
+	Codec   string
+	// Retries times job is retried after failing, negative uses default of node
+	Retries int
+	// Backoff wait before the first retry, it doubles every retry. Zero uses default of node
+	Backoff time.Duration
+	// DeliverAt job is handed to processors from then on, zero means immediately
+	DeliverAt time.Time
+	// Attempt deliveries of job so far, 1 for the first one
+	Attempt    int
+	NodeName   string
+	EnqueuedAt time.Time
+	// Lease identifies a delivery of job, acks of previous deliveries are ignored
+	Lease string
+	// Error last error job failed with
+	Error string
+}
+
+type Env struct {
+	// Enqueue persists job and assigns its ID, it returns once job is accepted
+	Enqueue func(ctx context.Context, job *Job) error
+	// Process hands jobs of queue to worker, at most concurrency of them at the same time
+	Process func(queue string, concurrency int)
+	// Ack removes job handled
+	Ack func(job *Job)
+	// Fail retries job after backoff, or moves it to failed jobs once retries are exhausted
+	Fail     func(job *Job, err error)
+	ReadChan func() <-chan *Job
+}
+
+type lJobs struct {
+	env      *Env
+	ec       *core.ExecutionContext
+	mu       *sync.Mutex
+	handlers map[string]*lua.LFunction
+	once     *sync.Once
+}
+
+func checkJobs(L *lua.LState) *lJobs {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lJobs); ok {
+		return u
+	}
+
+	L.RaiseError("expected jobs")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"enqueue": lEnqueue,
+	"process": lProcess,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lJobs{
+		env:      env,
+		ec:       ec,
+		mu:       &sync.Mutex{},
+		handlers: map[string]*lua.LFunction{},
+		once:     &sync.Once{},
+	}
+	utils.RegisterLuaModule(L, "jobs", funcs, ud)
+}
+
+// start hands jobs to handlers of their queues
+func (uv *lJobs) start() {
+	uv.once.Do(func() {
+		ch := uv.env.ReadChan()
+		go func() {
+			for job := range ch {
+				uv.handle(job)
+			}
+		}()
+	})
+}
+
+// handle calls handler of job's queue, job is acked once handler calls done without error. It fails if handler
+// calls done with error or raises one.
+func (uv *lJobs) handle(job *Job) {
+	uv.mu.Lock()
+	handler, ok := uv.handlers[job.Queue]
+	uv.mu.Unlock()
+	if !ok {
+		uv.env.Fail(job, fmt.Errorf("queue \"%s\" is not processed", job.Queue))
+		return
+	}
+
+	once := &sync.Once{}
+	finish := func(err error) {
+		once.Do(func() {
+			if err != nil {
+				uv.env.Fail(job, err)
+				return
+			}
+			uv.env.Ack(job)
+		})
+	}
+	uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+		v, err := codec.Decode(L, job.Codec, job.Payload)
+		if err != nil {
+			finish(fmt.Errorf("unable to decode payload of job: %w", err))
+			return nil
+		}
+		done := L.NewFunction(func(L *lua.LState) int {
+			if err := L.Get(1); err != lua.LNil {
+				finish(errors.New(err.String()))
+				return 0
+			}
+			finish(nil)
+			return 0
+		})
+		if err := utils.CallLuaFunction(L, handler, v, done, jobValue(L, job)); err != nil {
+			finish(err)
+		}
+		return nil
+	}))
+}
+
+func jobValue(L *lua.LState, job *Job) lua.LValue {
+	tb := L.NewTable()
+	tb.RawSetString("id", lua.LString(job.ID))
+	tb.RawSetString("queue", lua.LString(job.Queue))
+	tb.RawSetString("attempt", lua.LNumber(job.Attempt))
+	tb.RawSetString("retries", lua.LNumber(job.Retries))
+	tb.RawSetString("node", lua.LString(job.NodeName))
+	tb.RawSetString("enqueued_at", lua.LNumber(job.EnqueuedAt.UnixNano()/int64(time.Millisecond)))
+	if job.Error != "" {
+		tb.RawSetString("error", lua.LString(job.Error))
+	}
+	return tb
+}
+
+// lEnqueue jobs.enqueue(queue, payload, options?, cb?), cb is called with id of job once it's persisted
+func lEnqueue(L *lua.LState) int {
+	uv := checkJobs(L)
+	queue := params.String()
+	payload := params.Any()
+	options := params.Table()
+	cb := params.Check(L, 1, 2, "jobs.enqueue(queue, payload, options?, cb?)", queue, payload, options)
+
+	job := &Job{
+		Queue:   queue.String(),
+		Retries: -1,
+	}
+	if tb := options.Table(); tb != nil {
+		if val := tb.RawGetString("codec"); val != lua.LNil {
+			job.Codec = lua.LVAsString(val)
+		}
+		if val, ok := tb.RawGetString("retries").(lua.LNumber); ok {
+			job.Retries = int(val)
+		}
+		if val, ok := tb.RawGetString("backoff").(lua.LNumber); ok {
+			job.Backoff = time.Duration(val) * time.Millisecond
+		}
+		if val, ok := tb.RawGetString("delay").(lua.LNumber); ok && val > 0 {
+			job.DeliverAt = time.Now().Add(time.Duration(val) * time.Millisecond)
+		}
+	}
+	body, err := codec.Encode(job.Codec, payload.Value())
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+	job.Payload = body
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		if err := uv.env.Enqueue(ctx, job); err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb, lua.LNil, lua.LString(job.ID)))
+		return nil
+	}))
+	return 0
+}
+
+// lProcess jobs.process(queue, concurrency, handler), handler is called with payload, done and job. A previous
+// handler of the same queue is replaced.
+func lProcess(L *lua.LState) int {
+	uv := checkJobs(L)
+	queue := L.CheckString(1)
+	concurrency := L.CheckInt(2)
+	handler := L.CheckFunction(3)
+	if concurrency < 1 {
+		L.ArgError(2, "concurrency must be at least 1")
+	}
+	uv.mu.Lock()
+	uv.handlers[queue] = handler
+	uv.mu.Unlock()
+	uv.start()
+	uv.env.Process(queue, concurrency)
+	return 0
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/jobs")
+}
+
+var _ = Describe("Jobs", func() {
+	It("should enqueue and ack", func() {
+		var enqueued, acked *Job
+		var processed []string
+		read := make(chan *Job, 1)
+		test.Async(`
+			local jobs = require "jobs"
+			jobs.process("email", 2, function(payload, done, job)
+				assert(payload.to == "a@b.c", "payload")
+				assert(job.id == "1", "id")
+				assert(job.attempt == 1, "attempt")
+				done()
+				resolve()
+			end)
+			jobs.enqueue("email", { to = "a@b.c" }, { retries = 5, backoff = 2000, delay = 60000 }, function(err, id)
+				assert(err == nil, "err")
+				assert(id == "1", "id")
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Enqueue: func(ctx context.Context, job *Job) error {
+						enqueued = job
+						job.ID = "1"
+						job.Attempt = 1
+						read <- job
+						return nil
+					},
+					Process: func(queue string, concurrency int) {
+						processed = append(processed, queue)
+						Expect(concurrency).To(Equal(2))
+					},
+					Ack: func(job *Job) {
+						acked = job
+					},
+					ReadChan: func() <-chan *Job {
+						return read
+					},
+				})
+			})
+		Expect(processed).To(Equal([]string{"email"}))
+		Expect(enqueued.Retries).To(Equal(5))
+		Expect(enqueued.Backoff.Milliseconds()).To(Equal(int64(2000)))
+		Expect(enqueued.DeliverAt.IsZero()).To(BeFalse())
+		Expect(acked).To(Equal(enqueued))
+	})
+
+	It("should fail with error", func() {
+		var failed []string
+		read := make(chan *Job, 2)
+		test.Async(`
+			local jobs = require "jobs"
+			jobs.process("raise", 1, function(payload, done, job)
+				error("boom")
+			end)
+			jobs.process("done", 1, function(payload, done, job)
+				done("bad")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Process: func(queue string, concurrency int) {},
+					Fail: func(job *Job, err error) {
+						failed = append(failed, job.Queue)
+						if job.Queue == "raise" {
+							Expect(err.Error()).To(ContainSubstring("boom"))
+							read <- &Job{Queue: "done", Payload: []byte("1")}
+						} else {
+							Expect(err.Error()).To(Equal("bad"))
+						}
+					},
+					ReadChan: func() <-chan *Job {
+						read <- &Job{Queue: "raise", Payload: []byte("1")}
+						return read
+					},
+				})
+			})
+		Expect(failed).To(Equal([]string{"raise", "done"}))
+	})
+})
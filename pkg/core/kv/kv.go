@@ -0,0 +1,181 @@
+package kv
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Entry change of a key, Value is json encoded
+type Entry struct {
+	Key       string
+	Value     []byte
+	IsDeleted bool
+}
+
+type Env struct {
+	Get    func(key string) ([]byte, bool)
+	Set    func(key string, value []byte) error
+	Delete func(key string) error
+	// Keys returns sorted keys having prefix
+	Keys func(prefix string) []string
+	// ReadChan receives every change of the store, either local or replicated from peers
+	ReadChan func() <-chan *Entry
+}
+
+type watcher struct {
+	prefix  string
+	handler *lua.LFunction
+}
+
+type lKV struct {
+	env      *Env
+	ec       *core.ExecutionContext
+	mu       *sync.Mutex
+	watchers map[int]*watcher
+	nextID   int
+}
+
+func checkKV(L *lua.LState) *lKV {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lKV); ok {
+		return u
+	}
+
+	L.RaiseError("expected kv")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"get":    lGet,
+	"set":    lSet,
+	"delete": lDelete,
+	"keys":   lKeys,
+	"watch":  lWatch,
+}
+
+// Open registers "cluster.kv" module, it's also available as field "kv" of cluster module if that is opened beforehand
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	uv := &lKV{
+		env:      env,
+		ec:       ec,
+		mu:       &sync.Mutex{},
+		watchers: map[int]*watcher{},
+	}
+	ud := L.NewUserData()
+	ud.Value = uv
+	utils.RegisterLuaModule(L, "cluster.kv", funcs, ud)
+	uv.start()
+}
+
+// start notifies watchers of changes, changes without watchers are dropped
+func (uv *lKV) start() {
+	ch := uv.env.ReadChan()
+	go func() {
+		for entry := range ch {
+			uv.handle(entry)
+		}
+	}()
+}
+
+func (uv *lKV) handle(entry *Entry) {
+	var handlers []*lua.LFunction
+	uv.mu.Lock()
+	for _, w := range uv.watchers {
+		if strings.HasPrefix(entry.Key, w.prefix) {
+			handlers = append(handlers, w.handler)
+		}
+	}
+	uv.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler := handler
+		uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			var value lua.LValue = lua.LNil
+			if !entry.IsDeleted {
+				var err error
+				value, err = codec.Decode(L, codec.JSON, entry.Value)
+				if err != nil {
+					return err
+				}
+			}
+			return utils.CallLuaFunction(L, handler, lua.LString(entry.Key), value)
+		}))
+	}
+}
+
+// lGet returns value of key, nil if it doesn't exist
+func lGet(L *lua.LState) int {
+	uv := checkKV(L)
+	b, ok := uv.env.Get(L.CheckString(1))
+	if !ok {
+		L.Push(lua.LNil)
+		return 1
+	}
+	value, err := codec.Decode(L, codec.JSON, b)
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+	L.Push(value)
+	return 1
+}
+
+func lSet(L *lua.LState) int {
+	uv := checkKV(L)
+	key := L.CheckString(1)
+	b, err := codec.Encode(codec.JSON, L.CheckAny(2))
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+	if err := uv.env.Set(key, b); err != nil {
+		L.RaiseError(err.Error())
+	}
+	return 0
+}
+
+func lDelete(L *lua.LState) int {
+	uv := checkKV(L)
+	if err := uv.env.Delete(L.CheckString(1)); err != nil {
+		L.RaiseError(err.Error())
+	}
+	return 0
+}
+
+func lKeys(L *lua.LState) int {
+	uv := checkKV(L)
+	result := L.NewTable()
+	for _, key := range uv.env.Keys(L.OptString(1, "")) {
+		result.Append(lua.LString(key))
+	}
+	L.Push(result)
+	return 1
+}
+
+// lWatch calls handler on changes of keys having prefix, returns a function to stop watching
+func lWatch(L *lua.LState) int {
+	uv := checkKV(L)
+	prefix := L.CheckString(1)
+	handler := L.CheckFunction(2)
+	uv.mu.Lock()
+	id := uv.nextID
+	uv.nextID++
+	uv.watchers[id] = &watcher{
+		prefix:  prefix,
+		handler: handler,
+	}
+	uv.mu.Unlock()
+
+	L.Push(L.NewFunction(func(L *lua.LState) int {
+		uv.mu.Lock()
+		delete(uv.watchers, id)
+		uv.mu.Unlock()
+		return 0
+	}))
+	return 1
+}
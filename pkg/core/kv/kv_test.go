@@ -0,0 +1,114 @@
+package kv
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/cluster"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/kv")
+}
+
+func newMemoryEnv() *Env {
+	entries := map[string][]byte{}
+	changes := make(chan *Entry, 16)
+	return &Env{
+		Get: func(key string) ([]byte, bool) {
+			b, ok := entries[key]
+			return b, ok
+		},
+		Set: func(key string, value []byte) error {
+			entries[key] = value
+			changes <- &Entry{Key: key, Value: value}
+			return nil
+		},
+		Delete: func(key string) error {
+			delete(entries, key)
+			changes <- &Entry{Key: key, IsDeleted: true}
+			return nil
+		},
+		Keys: func(prefix string) []string {
+			var keys []string
+			for key := range entries {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			return keys
+		},
+		ReadChan: func() <-chan *Entry {
+			return changes
+		},
+	}
+}
+
+var _ = Describe("KV", func() {
+	It("should get, set and delete", func() {
+		test.Async(`
+			local kv = require "cluster.kv"
+			assert(kv.get("flags/a") == nil, "missing")
+			kv.set("flags/a", { enabled = true })
+			kv.set("flags/b", 1)
+			kv.set("other", "x")
+			assert(kv.get("flags/a").enabled == true, "get table")
+			assert(kv.get("flags/b") == 1, "get number")
+			local keys = kv.keys("flags/")
+			assert(table.getn(keys) == 2, "keys")
+			assert(keys[1] == "flags/a", "first key")
+			kv.delete("flags/a")
+			assert(kv.get("flags/a") == nil, "deleted")
+			resolve()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, newMemoryEnv())
+			})
+	})
+
+	It("should watch changes of prefix", func() {
+		test.Async(`
+			local kv = require "cluster.kv"
+			local changes = {}
+			local stop
+			stop = kv.watch("flags/", function(key, value)
+				table.insert(changes, { key = key, value = value })
+				if table.getn(changes) == 2 then
+					assert(changes[1].key == "flags/a", "set key")
+					assert(changes[1].value == "on", "set value")
+					assert(changes[2].key == "flags/a", "delete key")
+					assert(changes[2].value == nil, "delete value")
+					stop()
+					resolve()
+				end
+			end)
+			kv.set("other", "ignored")
+			kv.set("flags/a", "on")
+			kv.delete("flags/a")
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, newMemoryEnv())
+			})
+	})
+
+	It("should be a field of cluster module", func() {
+		test.Async(`
+			local cluster = require "cluster"
+			cluster.kv.set("a", "b")
+			assert(cluster.kv.get("a") == "b", "get")
+			resolve()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				cluster.Open(L, func() []*cluster.Node { return nil })
+				Open(L, ec, newMemoryEnv())
+			})
+	})
+})
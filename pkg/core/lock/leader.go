@@ -0,0 +1,145 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/consensus"
+	"github.com/joesonw/drlee/pkg/core/object"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// lElection campaigns for lease of name, it renews the lease every third of ttl once elected. Leadership is revoked
+// locally as soon as renewal is rejected or the lease could have expired, so that there is never a moment two
+// holders both believe they are elected.
+type lElection struct {
+	uv        *lLock
+	name      string
+	holder    string
+	ttl       time.Duration
+	onElected *lua.LFunction
+	onRevoked *lua.LFunction
+	stop      chan struct{}
+	stopOnce  *sync.Once
+	resource  core.Resource
+}
+
+// lElect leader.elect(name, on_elected, on_revoked, options?), on_elected receives fencing token of the lease
+func lElect(L *lua.LState) int {
+	uv := checkLock(L)
+	e := &lElection{
+		uv:        uv,
+		name:      L.CheckString(1),
+		holder:    uv.holder(),
+		ttl:       defaultLeaderTTL,
+		onElected: L.CheckFunction(2),
+		onRevoked: L.OptFunction(3, nil),
+		stop:      make(chan struct{}),
+		stopOnce:  &sync.Once{},
+	}
+	if options := L.OptTable(4, nil); options != nil {
+		if ttl := options.RawGetString("ttl"); ttl != lua.LNil {
+			if n, ok := ttl.(lua.LNumber); !ok || n <= 0 {
+				L.ArgError(4, "ttl must be positive")
+			}
+			e.ttl = time.Duration(lua.LVAsNumber(ttl)) * time.Millisecond
+		}
+	}
+	e.resource = core.NewResource(fmt.Sprintf("leader election \"%s\"", e.name), e.resign)
+	uv.ec.Guard(e.resource)
+	go e.run()
+
+	L.Push(object.NewReadOnly(L, electionFuncs, map[string]lua.LValue{
+		"name": lua.LString(e.name),
+	}, e).Value())
+	return 1
+}
+
+func (e *lElection) apply(op consensus.Op) (*consensus.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+	defer cancel()
+	return e.uv.apply(ctx, op, e.name, e.holder, e.ttl)
+}
+
+func (e *lElection) isStopped() bool {
+	select {
+	case <-e.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run campaigns until stopped, lease is released afterwards in case it's acquired while being stopped
+func (e *lElection) run() {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	defer e.uv.releaseLater(e.name, e.holder)
+	isElected := false
+	var deadline time.Time
+	for {
+		start := time.Now()
+		if !isElected {
+			res, err := e.apply(consensus.OpAcquire)
+			if err == nil && res.Swapped && !e.isStopped() {
+				isElected = true
+				deadline = start.Add(e.ttl)
+				e.uv.ec.Call(core.Lua(e.onElected, lua.LNumber(res.Lease.Token)))
+			}
+		} else {
+			res, err := e.apply(consensus.OpRenew)
+			if err == nil && res.Swapped {
+				deadline = start.Add(e.ttl)
+			} else if err == nil || time.Now().After(deadline) {
+				isElected = false
+				e.revoke()
+			}
+		}
+
+		// wakes up at deadline as well, in case renewals keep failing
+		var expired <-chan time.Time
+		if isElected {
+			expired = time.After(time.Until(deadline))
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-expired:
+			isElected = false
+			e.revoke()
+		}
+	}
+}
+
+func (e *lElection) revoke() {
+	if e.onRevoked != nil && !e.isStopped() {
+		e.uv.ec.Call(core.Lua(e.onRevoked))
+	}
+}
+
+// resign stops campaigning, lease is released once campaign returns
+func (e *lElection) resign() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
+
+var electionFuncs = map[string]lua.LGFunction{
+	"resign": lElectionResign,
+}
+
+// lElectionResign gives up leadership, on_revoked is not called
+func lElectionResign(L *lua.LState) int {
+	h, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	e := h.(*lElection)
+	e.resource.Cancel()
+	e.resign()
+	return 0
+}
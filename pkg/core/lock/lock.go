@@ -0,0 +1,214 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/consensus"
+	"github.com/joesonw/drlee/pkg/core/object"
+	"github.com/joesonw/drlee/pkg/utils"
+	uuid "github.com/satori/go.uuid"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultReleaseTimeout = time.Second * 5
+	defaultLeaderTTL      = time.Second * 10
+)
+
+type Env struct {
+	NodeName string
+	WorkerID int
+	// Apply applies lease command through consensus, see consensus.Env
+	Apply func(ctx context.Context, cmd *consensus.Command) (*consensus.Result, error)
+}
+
+type lLock struct {
+	env *Env
+	ec  *core.ExecutionContext
+	// prefix of holders, unique for every worker run
+	prefix string
+	nextID *atomic.Uint64
+}
+
+func checkLock(L *lua.LState) *lLock {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lLock); ok {
+		return u
+	}
+
+	L.RaiseError("expected lock")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"acquire": lAcquire,
+}
+
+var leaderFuncs = map[string]lua.LGFunction{
+	"elect": lElect,
+}
+
+// Open registers "lock" and "leader" modules, leases are guarded by ec so that they are released on reload
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lLock{
+		env:    env,
+		ec:     ec,
+		prefix: fmt.Sprintf("%s/%d/%s", env.NodeName, env.WorkerID, uuid.NewV4().String()),
+		nextID: atomic.NewUint64(0),
+	}
+	utils.RegisterLuaModule(L, "lock", funcs, ud)
+	utils.RegisterLuaModule(L, "leader", leaderFuncs, ud)
+}
+
+// holder unique holder, every acquisition is a different holder so that locks are not reentrant
+func (uv *lLock) holder() string {
+	return fmt.Sprintf("%s/%d", uv.prefix, uv.nextID.Inc())
+}
+
+func (uv *lLock) apply(ctx context.Context, op consensus.Op, name, holder string, ttl time.Duration) (*consensus.Result, error) {
+	return uv.env.Apply(ctx, &consensus.Command{
+		Op:     op,
+		Key:    name,
+		Holder: holder,
+		Node:   uv.env.NodeName,
+		TTL:    ttl.Milliseconds(),
+	})
+}
+
+// releaseLater releases lease without waiting, it's used once worker is closing
+func (uv *lLock) releaseLater(name, holder string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultReleaseTimeout)
+		defer cancel()
+		_, _ = uv.apply(ctx, consensus.OpRelease, name, holder, 0)
+	}()
+}
+
+func checkTTL(L *lua.LState, n int) time.Duration {
+	ttl := L.CheckNumber(n)
+	if ttl <= 0 {
+		L.ArgError(n, "ttl must be positive")
+	}
+	return time.Duration(ttl) * time.Millisecond
+}
+
+type lHeld struct {
+	uv       *lLock
+	name     string
+	holder   string
+	ttl      time.Duration
+	mu       *sync.Mutex
+	resource core.Resource
+	released bool
+}
+
+// lAcquire tries to acquire lock of name for ttl milliseconds, cb receives nil if it's held by someone else
+func lAcquire(L *lua.LState) int {
+	uv := checkLock(L)
+	name := L.CheckString(1)
+	ttl := checkTTL(L, 2)
+	cb := L.CheckFunction(3)
+	held := &lHeld{
+		uv:     uv,
+		name:   name,
+		holder: uv.holder(),
+		ttl:    ttl,
+		mu:     &sync.Mutex{},
+	}
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		res, err := uv.apply(ctx, consensus.OpAcquire, name, held.holder, ttl)
+		if err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		if !res.Swapped {
+			uv.ec.Call(core.Lua(cb, lua.LNil, lua.LNil))
+			return nil
+		}
+		held.resource = core.NewResource(fmt.Sprintf("lock \"%s\"", name), func() {
+			held.mu.Lock()
+			defer held.mu.Unlock()
+			if !held.released {
+				held.released = true
+				uv.releaseLater(name, held.holder)
+			}
+		})
+		uv.ec.Guard(held.resource)
+		uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			obj := object.NewReadOnly(L, heldFuncs, map[string]lua.LValue{
+				"name":  lua.LString(name),
+				"token": lua.LNumber(res.Lease.Token),
+			}, held)
+			return utils.CallLuaFunction(L, cb, lua.LNil, obj.Value())
+		}))
+		return nil
+	}))
+	return 0
+}
+
+var heldFuncs = map[string]lua.LGFunction{
+	"renew":   lHeldRenew,
+	"release": lHeldRelease,
+}
+
+func checkHeld(L *lua.LState) *lHeld {
+	h, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return h.(*lHeld)
+}
+
+// lHeldRenew extends lease by ttl (defaults to the one acquired with), cb receives false if it's lost already
+func lHeldRenew(L *lua.LState) int {
+	held := checkHeld(L)
+	ttl := held.ttl
+	cb := L.Get(2)
+	if L.Get(2).Type() == lua.LTNumber {
+		ttl = checkTTL(L, 2)
+		cb = L.Get(3)
+	}
+	uv := held.uv
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		res, err := uv.apply(ctx, consensus.OpRenew, held.name, held.holder, ttl)
+		if err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb, lua.LNil, lua.LBool(res.Swapped)))
+		return nil
+	}))
+	return 0
+}
+
+func lHeldRelease(L *lua.LState) int {
+	held := checkHeld(L)
+	cb := L.Get(2)
+	held.mu.Lock()
+	released := held.released
+	held.released = true
+	held.mu.Unlock()
+	if released {
+		L.RaiseError("lock \"%s\" is already released", held.name)
+		return 0
+	}
+	held.resource.Cancel()
+
+	uv := held.uv
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		if _, err := uv.apply(ctx, consensus.OpRelease, held.name, held.holder, 0); err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb))
+		return nil
+	}))
+	return 0
+}
@@ -0,0 +1,126 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/consensus"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/lock")
+}
+
+func newEnv(state *consensus.State) *Env {
+	return &Env{
+		NodeName: "node",
+		WorkerID: 1,
+		Apply: func(ctx context.Context, cmd *consensus.Command) (*consensus.Result, error) {
+			cmd.Now = time.Now().UnixNano() / int64(time.Millisecond)
+			return state.Apply(cmd)
+		},
+	}
+}
+
+func isHeld(state *consensus.State, name string) bool {
+	res, err := state.Apply(&consensus.Command{
+		Op:     consensus.OpAcquire,
+		Key:    name,
+		Holder: "other",
+		TTL:    1,
+		Now:    time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	Expect(err).To(BeNil())
+	if res.Swapped {
+		_, _ = state.Apply(&consensus.Command{Op: consensus.OpRelease, Key: name, Holder: "other"})
+	}
+	return !res.Swapped
+}
+
+var _ = Describe("Lock", func() {
+	It("should acquire and release", func() {
+		state := consensus.NewState()
+		test.Async(`
+			local lock = require "lock"
+			lock.acquire("a", 10000, function(err, l)
+				assert(err == nil, "acquire")
+				assert(l.token == 1, "token")
+				lock.acquire("a", 10000, function(err, l2)
+					assert(l2 == nil, "held")
+					l:renew(function(err, ok)
+						assert(ok, "renewed")
+						l:release(function(err)
+							assert(err == nil, "release")
+							lock.acquire("a", 10000, function(err, l3)
+								assert(l3.token == 2, "next token")
+								resolve()
+							end)
+						end)
+					end)
+				end)
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, newEnv(state))
+			})
+		Eventually(func() bool {
+			return isHeld(state, "a")
+		}).Should(BeFalse())
+	})
+
+	It("should elect leader", func() {
+		state := consensus.NewState()
+		test.Async(`
+			local leader = require "leader"
+			local first
+			first = leader.elect("l", function(token)
+				assert(token == 1, "first token")
+				leader.elect("l", function(token)
+					assert(token == 2, "second token")
+					resolve()
+				end, nil, { ttl = 300 })
+				first:resign()
+			end, function()
+				error("should not be revoked")
+			end, { ttl = 300 })
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, newEnv(state))
+			})
+		Eventually(func() bool {
+			return isHeld(state, "l")
+		}).Should(BeFalse())
+	})
+
+	It("should revoke leadership once lease is taken over", func() {
+		state := consensus.NewState()
+		test.Async(`
+			local leader = require "leader"
+			leader.elect("l", function(token)
+			end, function()
+				resolve()
+			end, { ttl = 300 })
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, newEnv(state))
+				go func() {
+					time.Sleep(time.Millisecond * 50)
+					_, _ = state.Apply(&consensus.Command{Op: consensus.OpReleaseNode, Node: "node"})
+					_, _ = state.Apply(&consensus.Command{
+						Op:     consensus.OpAcquire,
+						Key:    "l",
+						Holder: "other",
+						TTL:    10000,
+						Now:    time.Now().UnixNano() / int64(time.Millisecond),
+					})
+				}()
+			})
+	})
+})
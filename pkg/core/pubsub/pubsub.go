@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/core/helpers/params"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+type Message struct {
+	Topic    string
+	Body     []byte
+	Codec    string
+	NodeName string
+}
+
+type Env struct {
+	Subscribe   func(topic string)
+	Unsubscribe func(topic string)
+	// Publish hands message over for delivery to every subscribed worker in cluster, it doesn't wait for delivery
+	Publish  func(ctx context.Context, msg *Message) error
+	ReadChan func() <-chan *Message
+}
+
+type lPubSub struct {
+	env      *Env
+	ec       *core.ExecutionContext
+	mu       *sync.Mutex
+	handlers map[string]*lua.LFunction
+	once     *sync.Once
+}
+
+func checkPubSub(L *lua.LState) *lPubSub {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lPubSub); ok {
+		return u
+	}
+
+	L.RaiseError("expected pubsub")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"subscribe":   lSubscribe,
+	"unsubscribe": lUnsubscribe,
+	"publish":     lPublish,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lPubSub{
+		env:      env,
+		ec:       ec,
+		mu:       &sync.Mutex{},
+		handlers: map[string]*lua.LFunction{},
+		once:     &sync.Once{},
+	}
+	utils.RegisterLuaModule(L, "pubsub", funcs, ud)
+}
+
+// start delivers messages to handlers, messages of topics without handler are dropped
+func (uv *lPubSub) start() {
+	uv.once.Do(func() {
+		ch := uv.env.ReadChan()
+		go func() {
+			for msg := range ch {
+				uv.handle(msg)
+			}
+		}()
+	})
+}
+
+func (uv *lPubSub) handle(msg *Message) {
+	uv.mu.Lock()
+	handler, ok := uv.handlers[msg.Topic]
+	uv.mu.Unlock()
+	if !ok {
+		return
+	}
+	uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+		v, err := codec.Decode(L, msg.Codec, msg.Body)
+		if err != nil {
+			return err
+		}
+		return utils.CallLuaFunction(L, handler, v, lua.LString(msg.Topic), lua.LString(msg.NodeName))
+	}))
+}
+
+// lSubscribe subscribes worker to topic, a previous handler of the same topic is replaced
+func lSubscribe(L *lua.LState) int {
+	uv := checkPubSub(L)
+	topic := L.CheckString(1)
+	handler := L.CheckFunction(2)
+	uv.mu.Lock()
+	_, exists := uv.handlers[topic]
+	uv.handlers[topic] = handler
+	uv.mu.Unlock()
+	if !exists {
+		uv.env.Subscribe(topic)
+	}
+	uv.start()
+	return 0
+}
+
+func lUnsubscribe(L *lua.LState) int {
+	uv := checkPubSub(L)
+	topic := L.CheckString(1)
+	uv.mu.Lock()
+	_, exists := uv.handlers[topic]
+	delete(uv.handlers, topic)
+	uv.mu.Unlock()
+	if exists {
+		uv.env.Unsubscribe(topic)
+	}
+	return 0
+}
+
+func lPublish(L *lua.LState) int {
+	uv := checkPubSub(L)
+	topic := params.String()
+	message := params.Any()
+	options := params.Table()
+	cb := params.Check(L, 1, 2, "pubsub.publish(topic, message, options?, cb?)", topic, message, options)
+
+	var codecName string
+	if tb := options.Table(); tb != nil {
+		if val := tb.RawGetString("codec"); val != lua.LNil {
+			codecName = lua.LVAsString(val)
+		}
+	}
+	body, err := codec.Encode(codecName, message.Value())
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+
+	msg := &Message{
+		Topic: topic.String(),
+		Body:  body,
+		Codec: codecName,
+	}
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		if err := uv.env.Publish(ctx, msg); err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb))
+		return nil
+	}))
+	return 0
+}
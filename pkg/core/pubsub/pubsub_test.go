@@ -0,0 +1,57 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/pubsub")
+}
+
+var _ = Describe("PubSub", func() {
+	It("should publish to subscribers", func() {
+		var subscribed, unsubscribed []string
+		read := make(chan *Message, 1)
+		test.Async(`
+			local pubsub = require "pubsub"
+			pubsub.subscribe("room", function(message, topic, node)
+				assert(message.text == "hello", "message")
+				assert(topic == "room", "topic")
+				assert(node == "a", "node")
+				pubsub.unsubscribe("room")
+				resolve()
+			end)
+			pubsub.publish("room", { text = "hello" }, function(err)
+				assert(err == nil, "err")
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Subscribe: func(topic string) {
+						subscribed = append(subscribed, topic)
+					},
+					Unsubscribe: func(topic string) {
+						unsubscribed = append(unsubscribed, topic)
+					},
+					Publish: func(ctx context.Context, msg *Message) error {
+						msg.NodeName = "a"
+						read <- msg
+						return nil
+					},
+					ReadChan: func() <-chan *Message {
+						return read
+					},
+				})
+			})
+		Expect(subscribed).To(Equal([]string{"room"}))
+		Expect(unsubscribed).To(Equal([]string{"room"}))
+	})
+})
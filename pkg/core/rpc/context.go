@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"sync"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/object"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// lContext handler side view of a request, signals when caller cancels it
+type lContext struct {
+	uv        *lRPC
+	req       *Request
+	mu        *sync.Mutex
+	callbacks []lua.LValue
+	finished  chan struct{}
+	once      *sync.Once
+}
+
+func newContext(uv *lRPC, req *Request) *lContext {
+	c := &lContext{
+		uv:       uv,
+		req:      req,
+		mu:       &sync.Mutex{},
+		finished: make(chan struct{}),
+		once:     &sync.Once{},
+	}
+	if req.Done != nil {
+		go c.watch()
+	}
+	return c
+}
+
+func (c *lContext) watch() {
+	select {
+	case <-c.finished:
+	case <-c.req.Done:
+		c.mu.Lock()
+		callbacks := c.callbacks
+		c.callbacks = nil
+		c.mu.Unlock()
+		for _, cb := range callbacks {
+			c.uv.ec.Call(core.Lua(cb))
+		}
+	}
+}
+
+// finish stops watching for cancellation, called once handler replied
+func (c *lContext) finish() {
+	c.once.Do(func() {
+		close(c.finished)
+	})
+}
+
+func (c *lContext) isCancelled() bool {
+	if c.req.Done == nil {
+		return false
+	}
+	select {
+	case <-c.req.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *lContext) ObjectGet(key lua.LValue) (lua.LValue, bool) {
+	switch key.String() {
+	case "cancelled":
+		return lua.LBool(c.isCancelled()), true
+	case "id":
+		return lua.LString(c.req.ID), true
+	}
+	return lua.LNil, false
+}
+
+func (c *lContext) value(L *lua.LState) lua.LValue {
+	return object.NewReadOnly(L, contextFuncs, map[string]lua.LValue{}, c).Value()
+}
+
+func checkContext(L *lua.LState) *lContext {
+	c, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return c.(*lContext)
+}
+
+var contextFuncs = map[string]lua.LGFunction{
+	"on_cancel": lContextOnCancel,
+}
+
+// lContextOnCancel registers fn to be called once caller cancels the request, it's called right away if already cancelled
+func lContextOnCancel(L *lua.LState) int {
+	c := checkContext(L)
+	fn := L.CheckFunction(2)
+	c.mu.Lock()
+	if c.isCancelled() {
+		c.mu.Unlock()
+		c.uv.ec.Call(core.Lua(fn))
+		return 0
+	}
+	c.callbacks = append(c.callbacks, fn)
+	c.mu.Unlock()
+	return 0
+}
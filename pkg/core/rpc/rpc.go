@@ -4,18 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
 	"github.com/joesonw/drlee/pkg/core/helpers/params"
-	"github.com/joesonw/drlee/pkg/core/json"
 	"github.com/joesonw/drlee/pkg/utils"
 	lua "github.com/yuin/gopher-lua"
 )
 
 type Response struct {
-	Body  []byte
-	Error error
+	Body     []byte
+	Error    error
+	IsEnd    bool
+	NodeName string
 }
 
 type Request struct {
@@ -25,79 +28,163 @@ type Request struct {
 	Name       string
 	Body       []byte
 	ExpiresAt  time.Time
+	Key        string
+	Retry      *RetryPolicy
+	IsStream   bool
+	Broadcast  *BroadcastOptions
+	// Labels only nodes having all these labels are called
+	Labels map[string]string
+	// Prefer label keys, nodes sharing the same values with local node are preferred
+	Prefer []string
+	// Codec name of codec Body and its reply are encoded with, json if empty
+	Codec string
+	// DeliverAt request is handed to worker of target node not before this time, zero means immediately
+	DeliverAt time.Time
+	// Priority requests of higher priority are handed to workers of target node first
+	Priority Priority
+	// IdempotencyKey calls of the same method and key are handled once by target node, duplicates get the same reply
+	IdempotencyKey string
+	// IsOneWay caller doesn't wait for reply, target node never sends one
+	IsOneWay bool
+	// Done is closed once caller cancels the request, nil if it can't be cancelled
+	Done <-chan struct{}
+}
+
+// Priority of a call in inbox of target node
+type Priority int32
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// RetryErrors error classes retry policy can be on
+var RetryErrors = map[string]bool{
+	"unknown":            true,
+	"deadline_exceeded":  true,
+	"resource_exhausted": true,
+	"aborted":            true,
+	"internal":           true,
+	"unavailable":        true,
+}
+
+// RetryPolicy retry policy of a call, zero values fallback to server defaults
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	On         []string
+}
+
+// BroadcastOptions narrows down target nodes of a broadcast and when it completes
+type BroadcastOptions struct {
+	// Nodes only these nodes are targeted, all nodes offering the service if empty
+	Nodes []string
+	// First completes once this many responses succeeded
+	First int
+	// Quorum completes once a majority of responses succeeded
+	Quorum bool
+}
+
+// RegisterOptions options of a registered method
+type RegisterOptions struct {
+	// Codec default codec of calls to the method, callers can still override it per call
+	Codec string
 }
 
 type Env struct {
-	Register  func(name string)
+	Register  func(name string, opts *RegisterOptions)
 	Call      func(ctx context.Context, req *Request, cb func(*Response))
 	Broadcast func(ctx context.Context, req *Request, cb func([]*Response))
 	Reply     func(id, nodeName string, isLoopBack bool, res *Response)
 	ReadChan  func() <-chan *Request
 	Start     func()
+	// Stream calls cb once per chunk in order, cb blocks until the chunk is consumed. The last chunk is marked IsEnd.
+	Stream func(ctx context.Context, req *Request, cb func(*Response))
+	// ReplyStream sends a chunk of streaming reply, blocks until it's accepted by caller
+	ReplyStream func(req *Request, seq int64, res *Response) error
+	// Codec returns codec registered with method in cluster, empty if unknown
+	Codec func(name string) string
+	// Failed is called once handler failed with err and it's replied, optional
+	Failed func(req *Request, err error)
 }
 
 type lRPC struct {
-	env      *Env
-	ec       *core.ExecutionContext
-	handlers map[string]*lua.LFunction
+	env            *Env
+	ec             *core.ExecutionContext
+	handlers       map[string]*lua.LFunction
+	streamHandlers map[string]*lua.LFunction
 }
 
 func (uv *lRPC) handle(req *Request) {
 	if req == nil {
 		return
 	}
+	if req.IsStream {
+		uv.handleStream(req)
+		return
+	}
 	handler, ok := uv.handlers[req.Name]
 	if !ok {
-		uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{
-			Error: fmt.Errorf("method \"%s\" is not found", req.Name),
-		})
+		uv.replyError(req, fmt.Errorf("method \"%s\" is not found", req.Name))
 		return
 	}
+	ctx := newContext(uv, req)
 	uv.ec.Call(core.Scoped(func(L *lua.LState) error {
-		v, err := json.Decode(L, req.Body)
+		v, err := codec.Decode(L, req.Codec, req.Body)
 		if err != nil {
-			uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{
-				Error: fmt.Errorf("method \"%s\" is not found", req.Name),
-			})
+			ctx.finish()
+			uv.replyError(req, fmt.Errorf("unable to decode message of method \"%s\": %w", req.Name, err))
 			return nil
 		}
 
 		err = utils.CallLuaFunction(L, handler, v, L.NewFunction(func(L *lua.LState) int {
-			if exp := req.ExpiresAt; !exp.IsZero() && exp.Before(time.Now()) {
-				L.RaiseError(fmt.Sprintf("req \"%s\" is already timedout", req.ID))
-				return 0
-			}
+			ctx.finish()
+			// late reply is still made, so that request is released and duplicates get the reply
+			isExpired := !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now())
 			err := L.Get(1)
 			if err != nil && err != lua.LNil {
-				uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{Error: errors.New(err.String())})
-				return 0
-			}
-			val := L.Get(2)
-			b, e := json.Encode(val)
-			if e != nil {
-				L.RaiseError(e.Error())
-				uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{Error: e})
+				uv.replyError(req, errors.New(err.String()))
 			} else {
-				uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{Body: b})
+				val := L.Get(2)
+				b, e := codec.Encode(req.Codec, val)
+				if e != nil {
+					L.RaiseError(e.Error())
+					uv.replyError(req, e)
+				} else {
+					uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{Body: b})
+				}
+			}
+			if isExpired {
+				L.RaiseError(fmt.Sprintf("req \"%s\" is already timedout", req.ID))
 			}
 			return 0
-		}))
+		}), ctx.value(L))
 		if err != nil {
-			uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{
-				Error: err,
-			})
+			ctx.finish()
+			uv.replyError(req, err)
 			return nil
 		}
 		return nil
 	}))
 }
 
+// replyError replies err and reports it as failed
+func (uv *lRPC) replyError(req *Request, err error) {
+	uv.env.Reply(req.ID, req.NodeName, req.IsLoopBack, &Response{Error: err})
+	if uv.env.Failed != nil {
+		uv.env.Failed(req, err)
+	}
+}
+
 func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
 	ud := L.NewUserData()
 	ud.Value = &lRPC{
-		env:      env,
-		ec:       ec,
-		handlers: map[string]*lua.LFunction{},
+		env:            env,
+		ec:             ec,
+		handlers:       map[string]*lua.LFunction{},
+		streamHandlers: map[string]*lua.LFunction{},
 	}
 	utils.RegisterLuaModule(L, "rpc", funcs, ud)
 }
@@ -113,10 +200,12 @@ func checkRPC(L *lua.LState) *lRPC {
 }
 
 var funcs = map[string]lua.LGFunction{
-	"start":     lStart,
-	"register":  lRegister,
-	"call":      lCall,
-	"broadcast": lBroadcast,
+	"start":           lStart,
+	"register":        lRegister,
+	"register_stream": lRegisterStream,
+	"call":            lCall,
+	"stream":          lStream,
+	"broadcast":       lBroadcast,
 }
 
 func lStart(L *lua.LState) int {
@@ -135,11 +224,25 @@ func lRegister(L *lua.LState) int {
 	uv := checkRPC(L)
 	name := L.CheckString(1)
 	handler := L.CheckFunction(2)
-	uv.env.Register(name)
+	uv.env.Register(name, checkRegisterOptions(L, 3))
 	uv.handlers[name] = handler
 	return 0
 }
 
+// checkRegisterOptions reads { codec } from registration options at n
+func checkRegisterOptions(L *lua.LState, n int) *RegisterOptions {
+	opts := &RegisterOptions{}
+	if tb := L.OptTable(n, nil); tb != nil {
+		if val := tb.RawGetString("codec"); val != lua.LNil {
+			opts.Codec = lua.LVAsString(val)
+			if _, err := codec.Get(opts.Codec); err != nil {
+				L.ArgError(n, err.Error())
+			}
+		}
+	}
+	return opts
+}
+
 func lCall(L *lua.LState) int {
 	uv := checkRPC(L)
 
@@ -151,7 +254,7 @@ func lCall(L *lua.LState) int {
 					return utils.CallLuaFunction(L, cb, utils.LError(res.Error))
 				}
 
-				val, err := json.Decode(L, res.Body)
+				val, err := codec.Decode(L, req.Codec, res.Body)
 				if err != nil {
 					return utils.CallLuaFunction(L, cb, utils.LError(err))
 				}
@@ -175,12 +278,15 @@ func lBroadcast(L *lua.LState) int {
 					if res.Error != nil {
 						tb.RawSetString("error", utils.LError(res.Error))
 					} else {
-						val, err := json.Decode(L, res.Body)
+						val, err := codec.Decode(L, req.Codec, res.Body)
 						if err != nil {
 							return utils.CallLuaFunction(L, cb, utils.LError(err))
 						}
 						tb.RawSetString("body", val)
 					}
+					if res.NodeName != "" {
+						tb.RawSetString("node", lua.LString(res.NodeName))
+					}
 					result.Append(tb)
 				}
 				return utils.CallLuaFunction(L, cb, lua.LNil, result)
@@ -196,30 +302,166 @@ func auxCall(L *lua.LState, funcName string, f func(ctx context.Context, cancel
 	options := params.Table()
 	cb := params.Check(L, 1, 2, funcName, name, message, options)
 
-	body, err := json.Encode(message.Value())
+	var codecName string
+	if tb := options.Table(); tb != nil {
+		if val := tb.RawGetString("codec"); val != lua.LNil {
+			codecName = lua.LVAsString(val)
+		}
+	}
+	if codecName == "" && uv.env.Codec != nil {
+		codecName = uv.env.Codec(name.String())
+	}
+	body, err := codec.Encode(codecName, message.Value())
 	if err != nil {
 		L.RaiseError(err.Error())
 		return 0
 	}
+	var priority Priority
+	var retry *RetryPolicy
+	if tb := options.Table(); tb != nil {
+		if priority, err = parsePriority(tb.RawGetString("priority")); err != nil {
+			L.RaiseError(err.Error())
+			return 0
+		}
+		if retry, err = parseRetryPolicy(tb.RawGetString("retry")); err != nil {
+			L.ArgError(3, err.Error())
+			return 0
+		}
+	}
 
 	uv.ec.Call(core.Go(func(ctx context.Context) error {
 		var expiresAt time.Time
+		var key string
+		var idempotencyKey string
+		var broadcast *BroadcastOptions
+		var labels map[string]string
+		var prefer []string
+		var deliverAt time.Time
 		var cancel context.CancelFunc = func() {}
 		if tb := options.Table(); tb != nil {
+			deliverAt = parseDeliverAt(tb)
 			val := tb.RawGetString("timeout")
 			if val.Type() == lua.LTNumber {
-				timeout := time.Duration(lua.LVAsNumber(val)) * time.Millisecond
-				expiresAt = time.Now().Add(timeout)
-				ctx, cancel = context.WithTimeout(ctx, timeout)
+				// timeout counts from delivery of delayed requests
+				start := time.Now()
+				if deliverAt.After(start) {
+					start = deliverAt
+				}
+				expiresAt = start.Add(time.Duration(lua.LVAsNumber(val)) * time.Millisecond)
+				ctx, cancel = context.WithDeadline(ctx, expiresAt)
+			}
+			if val := tb.RawGetString("key"); val != lua.LNil {
+				key = lua.LVAsString(val)
+			}
+			if val := tb.RawGetString("idempotency_key"); val != lua.LNil {
+				idempotencyKey = lua.LVAsString(val)
+			}
+			broadcast = parseBroadcastOptions(tb)
+			if tb, ok := tb.RawGetString("labels").(*lua.LTable); ok {
+				labels = map[string]string{}
+				tb.ForEach(func(key, value lua.LValue) {
+					labels[key.String()] = lua.LVAsString(value)
+				})
+			}
+			switch val := tb.RawGetString("prefer").(type) {
+			case lua.LString:
+				prefer = []string{string(val)}
+			case *lua.LTable:
+				val.ForEach(func(_, value lua.LValue) {
+					prefer = append(prefer, lua.LVAsString(value))
+				})
 			}
 		}
 		f(ctx, cancel, &Request{
-			Name:      name.String(),
-			Body:      body,
-			ExpiresAt: expiresAt,
+			Name:           name.String(),
+			Body:           body,
+			ExpiresAt:      expiresAt,
+			Key:            key,
+			Retry:          retry,
+			Broadcast:      broadcast,
+			Labels:         labels,
+			Prefer:         prefer,
+			Codec:          codecName,
+			DeliverAt:      deliverAt,
+			Priority:       priority,
+			IdempotencyKey: idempotencyKey,
 		}, cb)
 		return nil
 	}))
 
 	return 0
 }
+
+// parseDeliverAt reads either delay in milliseconds or deliver_at in unix milliseconds from call options
+func parseDeliverAt(tb *lua.LTable) time.Time {
+	if val, ok := tb.RawGetString("deliver_at").(lua.LNumber); ok {
+		return time.Unix(0, int64(val)*int64(time.Millisecond))
+	}
+	if val, ok := tb.RawGetString("delay").(lua.LNumber); ok && val > 0 {
+		return time.Now().Add(time.Duration(val) * time.Millisecond)
+	}
+	return time.Time{}
+}
+
+// parsePriority accepts "high", "normal" or "low"
+func parsePriority(val lua.LValue) (Priority, error) {
+	if val == lua.LNil {
+		return PriorityNormal, nil
+	}
+	switch lua.LVAsString(val) {
+	case "high":
+		return PriorityHigh, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority \"%s\"", lua.LVAsString(val))
+}
+
+// parseRetryPolicy accepts either number of attempts or a table of { attempts, backoff, max_backoff, on }, errors
+// in on must be of RetryErrors
+func parseRetryPolicy(val lua.LValue) (*RetryPolicy, error) {
+	switch v := val.(type) {
+	case lua.LNumber:
+		return &RetryPolicy{Attempts: int(v)}, nil
+	case *lua.LTable:
+		policy := &RetryPolicy{
+			Attempts:   int(lua.LVAsNumber(v.RawGetString("attempts"))),
+			Backoff:    time.Duration(lua.LVAsNumber(v.RawGetString("backoff"))) * time.Millisecond,
+			MaxBackoff: time.Duration(lua.LVAsNumber(v.RawGetString("max_backoff"))) * time.Millisecond,
+		}
+		if on, ok := v.RawGetString("on").(*lua.LTable); ok {
+			var err error
+			on.ForEach(func(_, value lua.LValue) {
+				name := lua.LVAsString(value)
+				if !RetryErrors[strings.ToLower(name)] && err == nil {
+					err = fmt.Errorf("unknown retry error \"%s\"", name)
+				}
+				policy.On = append(policy.On, name)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return policy, nil
+	}
+	return nil, nil
+}
+
+// parseBroadcastOptions reads { nodes, first, quorum } from call options, nil if none is given
+func parseBroadcastOptions(tb *lua.LTable) *BroadcastOptions {
+	opts := &BroadcastOptions{
+		First:  int(lua.LVAsNumber(tb.RawGetString("first"))),
+		Quorum: lua.LVAsBool(tb.RawGetString("quorum")),
+	}
+	if nodes, ok := tb.RawGetString("nodes").(*lua.LTable); ok {
+		nodes.ForEach(func(_, value lua.LValue) {
+			opts.Nodes = append(opts.Nodes, lua.LVAsString(value))
+		})
+	}
+	if len(opts.Nodes) == 0 && opts.First == 0 && !opts.Quorum {
+		return nil
+	}
+	return opts
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/joesonw/drlee/pkg/core"
 
@@ -28,7 +29,7 @@ var _ = Describe("RPC", func() {
 			`,
 			func(L *lua.LState) {
 				Open(L, nil, &Env{
-					Register: func(name string) {
+					Register: func(name string, opts *RegisterOptions) {
 						serviceName = name
 					},
 				})
@@ -36,6 +37,76 @@ var _ = Describe("RPC", func() {
 		Expect(serviceName).To(Equal("hello"))
 	})
 
+	It("should register with codec", func() {
+		var options *RegisterOptions
+		test.Sync(`
+			local rpc = require "rpc"
+			rpc.register("hello", function() end, { codec = "msgpack" })
+			`,
+			func(L *lua.LState) {
+				Open(L, nil, &Env{
+					Register: func(name string, opts *RegisterOptions) {
+						options = opts
+					},
+				})
+			})
+		Expect(options.Codec).To(Equal("msgpack"))
+	})
+
+	It("should call with codec of registration", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("thumbnail", { size = 3, data = "\0\255" }, function(err, body)
+				assert(err == nil, "err")
+				assert(body.data == "\1\255", "body")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Codec: func(name string) string {
+						return "msgpack"
+					},
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte{0x81, 0xa4, 'd', 'a', 't', 'a', 0xc4, 0x02, 0x01, 0xff},
+						})
+					},
+				})
+			})
+		Expect(r.Codec).To(Equal("msgpack"))
+		Expect(r.Body).To(Equal([]byte{0x82, 0xa4, 'd', 'a', 't', 'a', 0xc4, 0x02, 0x00, 0xff, 0xa4, 's', 'i', 'z', 'e', 0x03}))
+	})
+
+	It("should call with raw codec", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("upload", "\0\1", { codec = "raw" }, function(err, body)
+				assert(err == nil, "err")
+				assert(body == "ok", "body")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Codec: func(name string) string {
+						return "msgpack"
+					},
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte("ok"),
+						})
+					},
+				})
+			})
+		Expect(r.Codec).To(Equal("raw"))
+		Expect(r.Body).To(Equal([]byte{0, 1}))
+	})
+
 	It("should call", func() {
 		var r *Request
 		test.Async(`
@@ -60,6 +131,145 @@ var _ = Describe("RPC", func() {
 		Expect(r.Name).To(Equal("hello"))
 	})
 
+	It("should call with delay", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("hello", "world", { delay = 60000, timeout = 1000 }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(time.Until(r.DeliverAt)).To(BeNumerically(">", time.Second*59))
+		Expect(r.ExpiresAt.Sub(r.DeliverAt)).To(Equal(time.Second))
+	})
+
+	It("should call with priority", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("hello", "world", { priority = "high" }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(r.Priority).To(Equal(PriorityHigh))
+	})
+
+	It("should call with idempotency key", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("hello", "world", { idempotency_key = "order-1" }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(r.IdempotencyKey).To(Equal("order-1"))
+	})
+
+	It("should call with key", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("hello", "world", { key = "room-1" }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(r.Key).To(Equal("room-1"))
+	})
+
+	It("should call with labels", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.call("hello", "world", { labels = { role = "worker" }, prefer = "zone" }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(r.Labels).To(Equal(map[string]string{"role": "worker"}))
+		Expect(r.Prefer).To(Equal([]string{"zone"}))
+	})
+
+	It("should call with retry", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			local ok, err = pcall(rpc.call, "hello", "world", { retry = { on = { "unavailable", "timeout" } } }, function() end)
+			assert(not ok, "unknown retry error")
+			assert(string.find(err, "unknown retry error \"timeout\""), err)
+			rpc.call("hello", "world", { retry = { attempts = 3, backoff = 100, on = { "unavailable" } } }, function(err, body)
+				assert(err == nil, "err")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Call: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{
+							Body: []byte(strconv.Quote("ok")),
+						})
+					},
+				})
+			})
+		Expect(r.Retry.Attempts).To(Equal(3))
+		Expect(r.Retry.Backoff).To(Equal(100 * time.Millisecond))
+		Expect(r.Retry.On).To(Equal([]string{"unavailable"}))
+	})
+
 	It("should broadcast", func() {
 		var r *Request
 		test.Async(`
@@ -88,6 +298,39 @@ var _ = Describe("RPC", func() {
 		Expect(r.Name).To(Equal("hello"))
 	})
 
+	It("should broadcast with options", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.broadcast("hello", "world", { nodes = { "a", "b" }, quorum = true, first = 1 }, function (err, list)
+				assert(err == nil, "err")
+				assert(list[1].node == "a", "node")
+				assert(list[2].node == "b", "node")
+				assert(list[2].error == "timeout", "error")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Broadcast: func(ctx context.Context, req *Request, cb func([]*Response)) {
+						r = req
+						cb([]*Response{{
+							Body:     []byte(strconv.Quote("ok")),
+							NodeName: "a",
+						}, {
+							Error:    errors.New("timeout"),
+							NodeName: "b",
+						}})
+					},
+				})
+			})
+		Expect(r.Broadcast).To(Equal(&BroadcastOptions{
+			Nodes:  []string{"a", "b"},
+			First:  1,
+			Quorum: true,
+		}))
+	})
+
 	It("should start", func() {
 		read := make(chan *Request, 1)
 		read <- &Request{
@@ -107,7 +350,7 @@ var _ = Describe("RPC", func() {
 			`,
 			func(L *lua.LState, ec *core.ExecutionContext) {
 				Open(L, ec, &Env{
-					Register: func(name string) {},
+					Register: func(name string, opts *RegisterOptions) {},
 					Start: func() {
 					},
 					Reply: func(id, nodeName string, isLoopBack bool, res *Response) {
@@ -123,4 +366,109 @@ var _ = Describe("RPC", func() {
 		res := <-response
 		Expect(string(res.Body)).To(Equal(strconv.Quote("ok")))
 	})
+
+	It("should still reply once request has expired", func() {
+		read := make(chan *Request, 1)
+		read <- &Request{
+			ID:        "123",
+			Name:      "hello",
+			Body:      []byte(strconv.Quote("world")),
+			ExpiresAt: time.Now().Add(-time.Second),
+		}
+		response := make(chan *Response, 1)
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.register("hello", function (message, reply)
+				resolve()
+				reply(nil, "ok")
+			end)
+			rpc.start()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Register: func(name string, opts *RegisterOptions) {},
+					Start:    func() {},
+					Reply: func(id, nodeName string, isLoopBack bool, res *Response) {
+						select {
+						case response <- res:
+						default:
+						}
+					},
+					ReadChan: func() <-chan *Request {
+						return read
+					},
+				})
+			})
+		res := <-response
+		Expect(res.Error).To(BeNil())
+		Expect(string(res.Body)).To(Equal(strconv.Quote("ok")))
+	})
+
+	It("should report failed handler", func() {
+		read := make(chan *Request, 1)
+		read <- &Request{
+			ID:   "123",
+			Name: "hello",
+			Body: []byte(strconv.Quote("world")),
+		}
+		failed := make(chan error, 1)
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.register("hello", function (message, reply)
+				resolve()
+				error("oops")
+			end)
+			rpc.start()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Register: func(name string, opts *RegisterOptions) {},
+					Start:    func() {},
+					Reply:    func(id, nodeName string, isLoopBack bool, res *Response) {},
+					Failed: func(req *Request, err error) {
+						failed <- err
+					},
+					ReadChan: func() <-chan *Request {
+						return read
+					},
+				})
+			})
+		Expect((<-failed).Error()).To(ContainSubstring("oops"))
+	})
+
+	It("should notify cancellation", func() {
+		done := make(chan struct{})
+		read := make(chan *Request, 1)
+		read <- &Request{
+			ID:   "123",
+			Name: "hello",
+			Body: []byte(strconv.Quote("world")),
+			Done: done,
+		}
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.register("hello", function (message, reply, ctx)
+				assert(not ctx.cancelled, "not cancelled")
+				ctx:on_cancel(function()
+					assert(ctx.cancelled, "cancelled")
+					resolve()
+				end)
+			end)
+			rpc.start()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Register: func(name string, opts *RegisterOptions) {},
+					Start: func() {
+						go func() {
+							time.Sleep(time.Millisecond * 50)
+							close(done)
+						}()
+					},
+					ReadChan: func() <-chan *Request {
+						return read
+					},
+				})
+			})
+	})
 })
@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/core/object"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxStreamPending chunks written but not yet accepted by caller, writing more fails until some are accepted
+const maxStreamPending = 64
+
+var (
+	errStreamClosed = errors.New("stream is already closed")
+	errStreamFull   = fmt.Errorf("stream has %d chunks pending, wait for them to be accepted", maxStreamPending)
+)
+
+type streamChunk struct {
+	seq int64
+	res *Response
+	cb  lua.LValue
+}
+
+// lStreamWriter sends chunks of a streaming reply one at a time, in the order they were written
+type lStreamWriter struct {
+	uv      *lRPC
+	req     *Request
+	ctx     *lContext
+	mu      *sync.Mutex
+	seq     int64
+	queue   []*streamChunk
+	sending bool
+	closed  bool
+}
+
+func (w *lStreamWriter) push(res *Response, cb lua.LValue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errStreamClosed
+	}
+	// end of stream is always let in, so a stream full of chunks can still be closed
+	if !res.IsEnd && len(w.queue) >= maxStreamPending {
+		return errStreamFull
+	}
+	if res.IsEnd {
+		w.closed = true
+		w.ctx.finish()
+	}
+	w.queue = append(w.queue, &streamChunk{
+		seq: w.seq,
+		res: res,
+		cb:  cb,
+	})
+	w.seq++
+	if !w.sending {
+		w.sending = true
+		go w.flush()
+	}
+	return nil
+}
+
+func (w *lStreamWriter) flush() {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.sending = false
+			w.mu.Unlock()
+			return
+		}
+		chunk := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		if err := w.uv.env.ReplyStream(w.req, chunk.seq, chunk.res); err != nil {
+			w.uv.ec.Call(core.Lua(chunk.cb, utils.LError(err)))
+		} else {
+			w.uv.ec.Call(core.Lua(chunk.cb))
+		}
+	}
+}
+
+func (uv *lRPC) handleStream(req *Request) {
+	handler, ok := uv.streamHandlers[req.Name]
+	if !ok {
+		go func() {
+			_ = uv.env.ReplyStream(req, 0, &Response{
+				Error: fmt.Errorf("stream method \"%s\" is not found", req.Name),
+				IsEnd: true,
+			})
+		}()
+		return
+	}
+
+	writer := &lStreamWriter{
+		uv:  uv,
+		req: req,
+		ctx: newContext(uv, req),
+		mu:  &sync.Mutex{},
+	}
+	uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+		v, err := codec.Decode(L, req.Codec, req.Body)
+		if err != nil {
+			return writer.push(&Response{Error: err, IsEnd: true}, lua.LNil)
+		}
+
+		obj := object.NewReadOnly(L, streamWriterFuncs, map[string]lua.LValue{}, writer)
+		err = utils.CallLuaFunction(L, handler, v, obj.Value(), writer.ctx.value(L))
+		if err != nil {
+			_ = writer.push(&Response{Error: err, IsEnd: true}, lua.LNil)
+		}
+		return nil
+	}))
+}
+
+func checkStreamWriter(L *lua.LState) *lStreamWriter {
+	writer, err := object.Value(L.CheckUserData(1))
+	if err != nil {
+		L.RaiseError(err.Error())
+	}
+	return writer.(*lStreamWriter)
+}
+
+var streamWriterFuncs = map[string]lua.LGFunction{
+	"send":  lStreamWriterSend,
+	"close": lStreamWriterClose,
+}
+
+func checkStreamExpired(L *lua.LState, req *Request) {
+	if exp := req.ExpiresAt; !exp.IsZero() && exp.Before(time.Now()) {
+		L.RaiseError(fmt.Sprintf("req \"%s\" is already timedout", req.ID))
+	}
+}
+
+func lStreamWriterSend(L *lua.LState) int {
+	writer := checkStreamWriter(L)
+	checkStreamExpired(L, writer.req)
+	b, err := codec.Encode(writer.req.Codec, L.Get(2))
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+	if err := writer.push(&Response{Body: b}, L.Get(3)); err != nil {
+		L.RaiseError(err.Error())
+	}
+	return 0
+}
+
+func lStreamWriterClose(L *lua.LState) int {
+	writer := checkStreamWriter(L)
+	res := &Response{IsEnd: true}
+	if err := L.Get(2); err != lua.LNil && err.Type() != lua.LTFunction {
+		res.Error = errors.New(err.String())
+	}
+	if err := writer.push(res, L.Get(L.GetTop())); err != nil {
+		L.RaiseError(err.Error())
+	}
+	return 0
+}
+
+func lRegisterStream(L *lua.LState) int {
+	uv := checkRPC(L)
+	name := L.CheckString(1)
+	handler := L.CheckFunction(2)
+	uv.env.Register(name, checkRegisterOptions(L, 3))
+	uv.streamHandlers[name] = handler
+	return 0
+}
+
+func lStream(L *lua.LState) int {
+	uv := checkRPC(L)
+
+	return auxCall(L, "rpc.stream(name, message, options?, cb?)", func(ctx context.Context, cancel context.CancelFunc, req *Request, cb lua.LValue) {
+		req.IsStream = true
+		uv.env.Stream(ctx, req, func(res *Response) {
+			if res.IsEnd {
+				cancel()
+			}
+			// wait until the chunk is handled, so that a slow consumer slows down the stream
+			done := make(chan struct{})
+			uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+				defer close(done)
+				if res.Error != nil {
+					return utils.CallLuaFunction(L, cb, utils.LError(res.Error), lua.LNil, lua.LBool(res.IsEnd))
+				}
+
+				var val lua.LValue = lua.LNil
+				if len(res.Body) > 0 {
+					var err error
+					val, err = codec.Decode(L, req.Codec, res.Body)
+					if err != nil {
+						return utils.CallLuaFunction(L, cb, utils.LError(err), lua.LNil, lua.LBool(res.IsEnd))
+					}
+				}
+				return utils.CallLuaFunction(L, cb, lua.LNil, val, lua.LBool(res.IsEnd))
+			}))
+			<-done
+		})
+	})
+}
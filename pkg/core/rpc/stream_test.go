@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var _ = Describe("Stream", func() {
+	It("should stream", func() {
+		var r *Request
+		test.Async(`
+			local rpc = require "rpc"
+			local chunks = {}
+			rpc.stream("hello", "world", function(err, chunk, done)
+				assert(err == nil, "err")
+				if done then
+					assert(table.getn(chunks) == 2, "chunks")
+					assert(chunks[1] == "a", "first chunk")
+					assert(chunks[2] == "b", "second chunk")
+					resolve()
+					return
+				end
+				table.insert(chunks, chunk)
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Stream: func(ctx context.Context, req *Request, cb func(*Response)) {
+						r = req
+						cb(&Response{Body: []byte(strconv.Quote("a"))})
+						cb(&Response{Body: []byte(strconv.Quote("b"))})
+						cb(&Response{IsEnd: true})
+					},
+				})
+			})
+		Expect(r.IsStream).To(BeTrue())
+		Expect(r.Name).To(Equal("hello"))
+	})
+
+	It("should reply stream", func() {
+		read := make(chan *Request, 1)
+		read <- &Request{
+			ID:       "123",
+			Name:     "hello",
+			Body:     []byte(strconv.Quote("world")),
+			IsStream: true,
+		}
+		var chunks []*Response
+		var seqs []int64
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.register_stream("hello", function (message, writer)
+				assert(message == "world", "message")
+				writer:send("a", function(err)
+					assert(err == nil, "send")
+					writer:send("b")
+					writer:close(function()
+						resolve()
+					end)
+				end)
+			end)
+			rpc.start()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Register: func(name string, opts *RegisterOptions) {},
+					Start:    func() {},
+					ReplyStream: func(req *Request, seq int64, res *Response) error {
+						seqs = append(seqs, seq)
+						chunks = append(chunks, res)
+						return nil
+					},
+					ReadChan: func() <-chan *Request {
+						return read
+					},
+				})
+			})
+		Expect(seqs).To(Equal([]int64{0, 1, 2}))
+		Expect(string(chunks[0].Body)).To(Equal(strconv.Quote("a")))
+		Expect(string(chunks[1].Body)).To(Equal(strconv.Quote("b")))
+		Expect(chunks[2].IsEnd).To(BeTrue())
+	})
+
+	It("should bound chunks pending", func() {
+		read := make(chan *Request, 1)
+		read <- &Request{
+			ID:       "123",
+			Name:     "hello",
+			Body:     []byte(strconv.Quote("world")),
+			IsStream: true,
+		}
+		release := make(chan struct{})
+		var chunks []*Response
+		test.Async(`
+			local rpc = require "rpc"
+			rpc.register_stream("hello", function (message, writer)
+				local sent = 0
+				while pcall(writer.send, writer, sent) do
+					sent = sent + 1
+				end
+				assert(sent >= 64 and sent <= 65, "sent " .. sent)
+				writer:close(function()
+					resolve()
+				end)
+				release()
+			end)
+			rpc.start()
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				L.SetGlobal("release", L.NewFunction(func(L *lua.LState) int {
+					close(release)
+					return 0
+				}))
+				Open(L, ec, &Env{
+					Register: func(name string, opts *RegisterOptions) {},
+					Start:    func() {},
+					ReplyStream: func(req *Request, seq int64, res *Response) error {
+						<-release
+						chunks = append(chunks, res)
+						return nil
+					},
+					ReadChan: func() <-chan *Request {
+						return read
+					},
+				})
+			})
+		Expect(len(chunks)).To(BeNumerically(">=", 65))
+		Expect(chunks[len(chunks)-1].IsEnd).To(BeTrue())
+	})
+})
@@ -0,0 +1,210 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/codec"
+	"github.com/joesonw/drlee/pkg/core/helpers/params"
+	"github.com/joesonw/drlee/pkg/utils"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Codec workflow input, step messages and results are encoded with
+const Codec = "json"
+
+// Step a step of workflow, it's a call of Method. Compensate is called for completed steps in reverse order once
+// a later step has failed.
+type Step struct {
+	Name       string
+	Method     string
+	Compensate string
+	// Timeout of each call, zero uses default of node
+	Timeout time.Duration
+	// Retries times a failed call is retried before workflow fails
+	Retries int
+	Backoff time.Duration
+}
+
+type Definition struct {
+	Name  string
+	Steps []*Step
+}
+
+// Instance state of a workflow, Results of completed steps by name
+type Instance struct {
+	ID      string
+	Name    string
+	Status  string
+	Step    string
+	Error   string
+	Results map[string][]byte
+}
+
+type Env struct {
+	Define func(def *Definition)
+	// Start persists a new instance of workflow and returns its id, an existing instance is returned if id is taken
+	Start func(ctx context.Context, name, id string, input []byte) (string, error)
+	// Status nil if instance is not found
+	Status func(ctx context.Context, id string) (*Instance, error)
+}
+
+type lWorkflow struct {
+	env *Env
+	ec  *core.ExecutionContext
+}
+
+func checkWorkflow(L *lua.LState) *lWorkflow {
+	uv := L.CheckUserData(lua.UpvalueIndex(1))
+	if u, ok := uv.Value.(*lWorkflow); ok {
+		return u
+	}
+
+	L.RaiseError("expected workflow")
+	return nil
+}
+
+var funcs = map[string]lua.LGFunction{
+	"define": lDefine,
+	"start":  lStart,
+	"status": lStatus,
+}
+
+func Open(L *lua.LState, ec *core.ExecutionContext, env *Env) {
+	ud := L.NewUserData()
+	ud.Value = &lWorkflow{
+		env: env,
+		ec:  ec,
+	}
+	utils.RegisterLuaModule(L, "workflow", funcs, ud)
+}
+
+// lDefine workflow.define(name, steps), each step is { name, method, compensate?, timeout?, retries?, backoff? }
+func lDefine(L *lua.LState) int {
+	uv := checkWorkflow(L)
+	name := L.CheckString(1)
+	tb := L.CheckTable(2)
+	def := &Definition{Name: name}
+	names := map[string]bool{}
+	var err error
+	tb.ForEach(func(_, value lua.LValue) {
+		if err != nil {
+			return
+		}
+		stepTable, ok := value.(*lua.LTable)
+		if !ok {
+			err = fmt.Errorf("step %d is not a table", len(def.Steps)+1)
+			return
+		}
+		step := &Step{
+			Name:       lua.LVAsString(stepTable.RawGetString("name")),
+			Method:     lua.LVAsString(stepTable.RawGetString("method")),
+			Compensate: lua.LVAsString(stepTable.RawGetString("compensate")),
+		}
+		if step.Name == "" {
+			step.Name = step.Method
+		}
+		if step.Method == "" {
+			err = fmt.Errorf("step \"%s\" has no method", step.Name)
+			return
+		}
+		if names[step.Name] {
+			err = fmt.Errorf("step \"%s\" is defined twice", step.Name)
+			return
+		}
+		names[step.Name] = true
+		if val, ok := stepTable.RawGetString("timeout").(lua.LNumber); ok {
+			step.Timeout = time.Duration(val) * time.Millisecond
+		}
+		if val, ok := stepTable.RawGetString("retries").(lua.LNumber); ok {
+			step.Retries = int(val)
+		}
+		if val, ok := stepTable.RawGetString("backoff").(lua.LNumber); ok {
+			step.Backoff = time.Duration(val) * time.Millisecond
+		}
+		def.Steps = append(def.Steps, step)
+	})
+	if err != nil {
+		L.ArgError(2, err.Error())
+	}
+	if len(def.Steps) == 0 {
+		L.ArgError(2, "workflow has no step")
+	}
+	uv.env.Define(def)
+	return 0
+}
+
+// lStart workflow.start(name, input, options?, cb?), cb is called with id of instance once it's persisted
+func lStart(L *lua.LState) int {
+	uv := checkWorkflow(L)
+	name := params.String()
+	input := params.Any()
+	options := params.Table()
+	cb := params.Check(L, 1, 2, "workflow.start(name, input, options?, cb?)", name, input, options)
+
+	var id string
+	if tb := options.Table(); tb != nil {
+		if val := tb.RawGetString("id"); val != lua.LNil {
+			id = lua.LVAsString(val)
+		}
+	}
+	body, err := codec.Encode(Codec, input.Value())
+	if err != nil {
+		L.RaiseError(err.Error())
+		return 0
+	}
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		id, err := uv.env.Start(ctx, name.String(), id, body)
+		if err != nil {
+			uv.ec.Call(core.Lua(cb, utils.LError(err)))
+			return nil
+		}
+		uv.ec.Call(core.Lua(cb, lua.LNil, lua.LString(id)))
+		return nil
+	}))
+	return 0
+}
+
+// lStatus workflow.status(id, cb), cb is called with nil if instance is not found
+func lStatus(L *lua.LState) int {
+	uv := checkWorkflow(L)
+	id := L.CheckString(1)
+	cb := L.CheckFunction(2)
+
+	uv.ec.Call(core.Go(func(ctx context.Context) error {
+		instance, err := uv.env.Status(ctx, id)
+		uv.ec.Call(core.Scoped(func(L *lua.LState) error {
+			if err != nil {
+				return utils.CallLuaFunction(L, cb, utils.LError(err))
+			}
+			if instance == nil {
+				return utils.CallLuaFunction(L, cb, lua.LNil, lua.LNil)
+			}
+			tb := L.NewTable()
+			tb.RawSetString("id", lua.LString(instance.ID))
+			tb.RawSetString("name", lua.LString(instance.Name))
+			tb.RawSetString("status", lua.LString(instance.Status))
+			if instance.Step != "" {
+				tb.RawSetString("step", lua.LString(instance.Step))
+			}
+			if instance.Error != "" {
+				tb.RawSetString("error", lua.LString(instance.Error))
+			}
+			results := L.NewTable()
+			for name, b := range instance.Results {
+				v, err := codec.Decode(L, Codec, b)
+				if err != nil {
+					return utils.CallLuaFunction(L, cb, utils.LError(err))
+				}
+				results.RawSetString(name, v)
+			}
+			tb.RawSetString("results", results)
+			return utils.CallLuaFunction(L, cb, lua.LNil, tb)
+		}))
+		return nil
+	}))
+	return 0
+}
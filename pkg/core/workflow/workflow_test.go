@@ -0,0 +1,97 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/core"
+	"github.com/joesonw/drlee/pkg/core/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func Test(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "core/workflow")
+}
+
+var _ = Describe("Workflow", func() {
+	It("should define and start", func() {
+		var defined *Definition
+		var started []byte
+		test.Async(`
+			local workflow = require "workflow"
+			workflow.define("order", {
+				{ name = "reserve", method = "inventory.reserve", compensate = "inventory.release", timeout = 5000 },
+				{ method = "payment.charge", retries = 2, backoff = 100 },
+			})
+			workflow.start("order", { sku = "a" }, { id = "1" }, function(err, id)
+				assert(err == nil, "err")
+				assert(id == "1", "id")
+				resolve()
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Define: func(def *Definition) {
+						defined = def
+					},
+					Start: func(ctx context.Context, name, id string, input []byte) (string, error) {
+						Expect(name).To(Equal("order"))
+						started = input
+						return id, nil
+					},
+				})
+			})
+		Expect(defined.Name).To(Equal("order"))
+		Expect(defined.Steps).To(Equal([]*Step{{
+			Name:       "reserve",
+			Method:     "inventory.reserve",
+			Compensate: "inventory.release",
+			Timeout:    5 * time.Second,
+		}, {
+			Name:    "payment.charge",
+			Method:  "payment.charge",
+			Retries: 2,
+			Backoff: 100 * time.Millisecond,
+		}}))
+		Expect(string(started)).To(MatchJSON(`{"sku":"a"}`))
+	})
+
+	It("should get status", func() {
+		test.Async(`
+			local workflow = require "workflow"
+			workflow.status("1", function(err, instance)
+				assert(err == nil, "err")
+				assert(instance.status == "compensating", "status")
+				assert(instance.step == "charge", "step")
+				assert(instance.error == "declined", "error")
+				assert(instance.results.reserve.count == 2, "result")
+				workflow.status("2", function(err, instance)
+					assert(err == nil, "err")
+					assert(instance == nil, "not found")
+					resolve()
+				end)
+			end)
+			`,
+			func(L *lua.LState, ec *core.ExecutionContext) {
+				Open(L, ec, &Env{
+					Status: func(ctx context.Context, id string) (*Instance, error) {
+						if id != "1" {
+							return nil, nil
+						}
+						return &Instance{
+							ID:      "1",
+							Name:    "order",
+							Status:  "compensating",
+							Step:    "charge",
+							Error:   "declined",
+							Results: map[string][]byte{"reserve": []byte(`{"count":2}`)},
+						}, nil
+					},
+				})
+			})
+	})
+})
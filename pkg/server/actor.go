@@ -0,0 +1,422 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	coreActor "github.com/joesonw/drlee/pkg/core/actor"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// actorServicePrefix each kind of actors is offered as a service of this prefix, nodes owning actors are chosen
+	// by consistent hashing over nodes offering it
+	actorServicePrefix        = "actor."
+	defaultActorIdleTimeout   = time.Minute * 10
+	defaultActorHandleTimeout = time.Minute
+	defaultActorMailboxSize   = 1024
+	// actorSweepInterval idle actors and actors owned by other nodes are deactivated this often
+	actorSweepInterval = time.Second
+	// actorConsumerSize messages handed to a worker but not yet taken by it
+	actorConsumerSize = 256
+)
+
+// actorMailbox messages of an actor waiting for it, they are handed to its worker one at a time
+type actorMailbox struct {
+	kind   string
+	id     string
+	worker int
+	queue  []*RPCRequest
+	// current message being handled, the next one is handed once it's done or past deadline
+	current    *RPCRequest
+	deadline   time.Time
+	isActive   bool
+	lastActive time.Time
+}
+
+// Actors mailboxes of actors owned by local node. Actor messages are routed to their owner like calls keyed by actor
+// id, inbox hands them to mailboxes instead of workers. Each actor sticks to a worker while its mailbox lives, mailboxes
+// are removed once actors are idle or owned by another node, their workers are told to deactivate them.
+type Actors struct {
+	mu        *sync.Mutex
+	config    ActorConfig
+	inbox     *Inbox
+	kinds     map[string]map[int]bool
+	consumers map[int]chan *coreActor.Message
+	mailboxes map[string]*actorMailbox
+	running   map[string]*actorMailbox
+	isOwner   func(kind, id string) bool
+	logger    *zap.Logger
+}
+
+func newActors(config ActorConfig, inbox *Inbox, isOwner func(kind, id string) bool, logger *zap.Logger) *Actors {
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultActorIdleTimeout
+	}
+	if config.HandleTimeout <= 0 {
+		config.HandleTimeout = defaultActorHandleTimeout
+	}
+	if config.MailboxSize <= 0 {
+		config.MailboxSize = defaultActorMailboxSize
+	}
+	return &Actors{
+		mu:        &sync.Mutex{},
+		config:    config,
+		inbox:     inbox,
+		kinds:     map[string]map[int]bool{},
+		consumers: map[int]chan *coreActor.Message{},
+		mailboxes: map[string]*actorMailbox{},
+		running:   map[string]*actorMailbox{},
+		isOwner:   isOwner,
+		logger:    logger,
+	}
+}
+
+// isActorMessage whether call of name keyed by key is a message to an actor
+func isActorMessage(name, key string) bool {
+	return key != "" && strings.HasPrefix(name, actorServicePrefix)
+}
+
+func actorMailboxKey(kind, id string) string {
+	return kind + "\x00" + id
+}
+
+// Admit returns ResourceExhausted error if request is an actor message and mailbox of its actor is full
+func (a *Actors) Admit(name, key string) error {
+	if !isActorMessage(name, key) {
+		return nil
+	}
+	kind := strings.TrimPrefix(name, actorServicePrefix)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	mb, ok := a.mailboxes[actorMailboxKey(kind, key)]
+	if !ok {
+		return nil
+	}
+	if size := len(mb.queue); size >= a.config.MailboxSize {
+		return status.Errorf(codes.ResourceExhausted, "mailbox of actor \"%s\" of \"%s\" reached limit %d", key, kind, a.config.MailboxSize)
+	}
+	return nil
+}
+
+// Put puts actor message into mailbox of its actor, returns false if request is not an actor message
+func (a *Actors) Put(req *RPCRequest) bool {
+	if !isActorMessage(req.Name, req.Key) {
+		return false
+	}
+	kind := strings.TrimPrefix(req.Name, actorServicePrefix)
+	key := actorMailboxKey(kind, req.Key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	mb, ok := a.mailboxes[key]
+	if !ok {
+		mb = &actorMailbox{
+			kind:       kind,
+			id:         req.Key,
+			worker:     a.pickWorker(kind, req.Key),
+			lastActive: time.Now(),
+		}
+		a.mailboxes[key] = mb
+	}
+	mb.queue = append(mb.queue, req)
+	a.next(mb)
+	return true
+}
+
+// pickWorker hashes id over workers defined kind, -1 if there is none. Actors must be locked
+func (a *Actors) pickWorker(kind, id string) int {
+	workers := make([]int, 0, len(a.kinds[kind]))
+	for worker := range a.kinds[kind] {
+		workers = append(workers, worker)
+	}
+	if len(workers) == 0 {
+		return -1
+	}
+	sort.Ints(workers)
+	return workers[crc32.ChecksumIEEE([]byte(id))%uint32(len(workers))]
+}
+
+// next hands the next message of mailbox to its worker unless one is being handled, messages wait if worker is busy
+// taking others or there is no worker defined kind yet. Actors must be locked
+func (a *Actors) next(mb *actorMailbox) {
+	for mb.current == nil && len(mb.queue) > 0 {
+		consumer, ok := a.consumers[mb.worker]
+		if !ok || !a.kinds[mb.kind][mb.worker] {
+			mb.worker = a.pickWorker(mb.kind, mb.id)
+			if consumer, ok = a.consumers[mb.worker]; !ok {
+				return
+			}
+		}
+		req := mb.queue[0]
+		var expiresAt time.Time
+		if req.Timeout != 0 {
+			expiresAt = req.Timestamp.Add(req.Timeout)
+		}
+		if !expiresAt.IsZero() && expiresAt.Before(time.Now()) {
+			mb.queue = mb.queue[1:]
+			a.inbox.deadLetters.RecordRequest(req, DeadLetterExpired, nil)
+			continue
+		}
+		if _, ok := a.inbox.start(req.ID, req.NodeName, expiresAt); !ok {
+			mb.queue = mb.queue[1:]
+			continue
+		}
+		msg := &coreActor.Message{
+			ID:         req.ID,
+			Kind:       mb.kind,
+			ActorID:    mb.id,
+			Body:       req.Body,
+			Codec:      req.Codec,
+			NodeName:   req.NodeName,
+			IsLoopBack: req.IsLoopBack,
+			IsAsk:      !req.IsOneWay,
+		}
+		select {
+		case consumer <- msg:
+		default:
+			// retried by sweep
+			a.inbox.Done(req.ID)
+			return
+		}
+		mb.queue = mb.queue[1:]
+		mb.current = req
+		mb.deadline = time.Now().Add(a.config.HandleTimeout)
+		if !expiresAt.IsZero() && expiresAt.Before(mb.deadline) {
+			mb.deadline = expiresAt
+		}
+		mb.isActive = true
+		a.running[req.ID] = mb
+	}
+}
+
+// Done lets the next message of actor in once message is handled
+func (a *Actors) Done(msg *coreActor.Message) {
+	a.inbox.Done(msg.ID)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	mb, ok := a.running[msg.ID]
+	if !ok {
+		return
+	}
+	delete(a.running, msg.ID)
+	mb.current = nil
+	mb.lastActive = time.Now()
+	a.next(mb)
+}
+
+// Define marks kind as defined by worker, messages waiting for a worker of kind are handed to it
+func (a *Actors) Define(worker int, kind string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.kinds[kind]; !ok {
+		a.kinds[kind] = map[int]bool{}
+	}
+	a.kinds[kind][worker] = true
+	for _, mb := range a.mailboxes {
+		if mb.kind == kind {
+			a.next(mb)
+		}
+	}
+}
+
+func (a *Actors) NewConsumer(worker int) <-chan *coreActor.Message {
+	ch := make(chan *coreActor.Message, actorConsumerSize)
+	a.mu.Lock()
+	a.consumers[worker] = ch
+	a.mu.Unlock()
+	return ch
+}
+
+// Reset stops handing messages to workers, actors are activated again once kinds are defined. Messages being handled
+// are handed again.
+func (a *Actors) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, ch := range a.consumers {
+		close(ch)
+	}
+	a.consumers = map[int]chan *coreActor.Message{}
+	a.kinds = map[string]map[int]bool{}
+	for _, mb := range a.mailboxes {
+		if mb.current != nil {
+			mb.queue = append([]*RPCRequest{mb.current}, mb.queue...)
+			mb.current = nil
+		}
+		mb.worker = -1
+		mb.isActive = false
+	}
+	a.running = map[string]*actorMailbox{}
+}
+
+func (a *Actors) startSweep(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(actorSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.sweep()
+			}
+		}
+	}()
+}
+
+// sweep gives up messages past deadline, retries messages failed to be handed and deactivates actors idle or owned by
+// other nodes now. Actors moved are activated on their new owner by the next message.
+func (a *Actors) sweep() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for key, mb := range a.mailboxes {
+		if mb.current != nil {
+			if now.Before(mb.deadline) {
+				continue
+			}
+			a.logger.Warn(fmt.Sprintf("actor \"%s\" of \"%s\" didn't reply message [%s] in time", mb.id, mb.kind, mb.current.ID))
+			a.inbox.Done(mb.current.ID)
+			delete(a.running, mb.current.ID)
+			mb.current = nil
+			mb.lastActive = now
+		}
+		if len(mb.queue) > 0 {
+			a.next(mb)
+			continue
+		}
+		if now.Sub(mb.lastActive) < a.config.IdleTimeout && a.isOwner(mb.kind, mb.id) {
+			continue
+		}
+		if mb.isActive {
+			consumer, ok := a.consumers[mb.worker]
+			if !ok {
+				delete(a.mailboxes, key)
+				continue
+			}
+			select {
+			case consumer <- &coreActor.Message{Kind: mb.kind, ActorID: mb.id, Deactivate: true}:
+			default:
+				continue
+			}
+		}
+		delete(a.mailboxes, key)
+	}
+}
+
+// describe actors active and messages waiting for them by kind
+func (a *Actors) describe() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	active := map[string]int{}
+	waiting := map[string]int{}
+	for _, mb := range a.mailboxes {
+		if mb.isActive {
+			active[mb.kind]++
+		}
+		waiting[mb.kind] += len(mb.queue)
+	}
+	kinds := map[string]bool{}
+	for kind := range a.kinds {
+		kinds[kind] = true
+	}
+	for kind := range waiting {
+		kinds[kind] = true
+	}
+	lines := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		lines = append(lines, fmt.Sprintf("%s: active=%d waiting=%d workers=%d", kind, active[kind], waiting[kind], len(a.kinds[kind])))
+	}
+	if len(lines) == 0 {
+		return "no actors"
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// isActorOwner whether local node owns actor on hash ring of its kind
+func (s *Server) isActorOwner(kind, id string) bool {
+	nodeName := s.getRing(actorServicePrefix+kind).Get(id, func(nodeName string) bool {
+		return !s.isRoutable(nodeName)
+	})
+	return nodeName == s.members.LocalNode().Name
+}
+
+func actorRequest(kind, id string, body []byte) *coreRPC.Request {
+	return &coreRPC.Request{
+		Name: actorServicePrefix + kind,
+		Key:  id,
+		Body: body,
+	}
+}
+
+type luaActorEnv struct {
+	server   *Server
+	id       int
+	consumer <-chan *coreActor.Message
+	logger   *zap.Logger
+}
+
+// Define offers kind as a service, so that actors of kind are owned by local node in its share of hash ring
+func (env *luaActorEnv) Define(kind string) {
+	name := actorServicePrefix + kind
+	env.server.actors.Define(env.id, kind)
+	env.server.localServicesMu.Lock()
+	env.server.localServices[name] = 1
+	env.server.localServicesMu.Unlock()
+	env.server.invalidateRings(name)
+	env.server.broadcasts.QueueBroadcast(&RegistryBroadcast{
+		NodeName:  env.server.members.LocalNode().Name,
+		Timestamp: time.Now(),
+		Name:      name,
+		Weight:    1,
+	})
+	env.logger.Info(fmt.Sprintf("broadcasted actor \"%s\"", kind))
+}
+
+func (env *luaActorEnv) Send(ctx context.Context, kind, id string, body []byte) error {
+	req := actorRequest(kind, id, body)
+	req.IsOneWay = true
+	_, err := env.server.dispatchCall(ctx, uuid.NewV4().String(), req)
+	return err
+}
+
+func (env *luaActorEnv) Ask(ctx context.Context, kind, id string, body []byte, timeout time.Duration) ([]byte, error) {
+	req := actorRequest(kind, id, body)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req.ExpiresAt = time.Now().Add(timeout)
+	}
+	return env.server.luaRPCCall(ctx, req)
+}
+
+func (env *luaActorEnv) Reply(msg *coreActor.Message, body []byte, err error) {
+	if err := env.server.replyCall(msg.ID, msg.NodeName, msg.IsLoopBack, &coreRPC.Response{Body: body, Error: err}, env.logger); err != nil {
+		env.logger.Error("unable to reply actor message", zap.Error(err))
+	}
+}
+
+func (env *luaActorEnv) ReadChan() <-chan *coreActor.Message {
+	return env.consumer
+}
+
+func (env *luaActorEnv) Build() *coreActor.Env {
+	return &coreActor.Env{
+		Define:   env.Define,
+		Send:     env.Send,
+		Ask:      env.Ask,
+		Reply:    env.Reply,
+		Done:     env.server.actors.Done,
+		ReadChan: env.ReadChan,
+	}
+}
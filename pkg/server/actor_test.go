@@ -0,0 +1,81 @@
+package server
+
+import (
+	"time"
+
+	coreActor "github.com/joesonw/drlee/pkg/core/actor"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Actors", func() {
+	var actors *Actors
+
+	BeforeEach(func() {
+		actors = newActors(ActorConfig{MailboxSize: 2}, newInbox(InboxConfig{}, "", nil, nil, nil), func(kind, id string) bool {
+			return true
+		}, zap.NewNop())
+	})
+
+	message := func(id, actorID string) *RPCRequest {
+		return &RPCRequest{
+			ID:        id,
+			Name:      actorServicePrefix + "counter",
+			Key:       actorID,
+			Timestamp: time.Now(),
+		}
+	}
+
+	It("should reject messages once mailbox of actor is full", func() {
+		Expect(actors.Admit("counter", "a")).To(Succeed())
+		Expect(actors.Admit(actorServicePrefix+"counter", "a")).To(Succeed())
+
+		// no worker defined counter yet, messages wait in mailbox
+		Expect(actors.Put(message("1", "a"))).To(BeTrue())
+		Expect(actors.Admit(actorServicePrefix+"counter", "a")).To(Succeed())
+		Expect(actors.Put(message("2", "a"))).To(BeTrue())
+		err := actors.Admit(actorServicePrefix+"counter", "a")
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+
+		Expect(actors.Admit(actorServicePrefix+"counter", "b")).To(Succeed())
+		Expect(actors.Admit("counter", "a")).To(Succeed())
+	})
+
+	It("should admit messages again once actor catches up", func() {
+		actors.NewConsumer(0)
+		actors.Put(message("1", "a"))
+		actors.Put(message("2", "a"))
+		actors.Put(message("3", "a"))
+		Expect(status.Code(actors.Admit(actorServicePrefix+"counter", "a"))).To(Equal(codes.ResourceExhausted))
+
+		// one message is handed to actor at a time
+		actors.Define(0, "counter")
+		Expect(status.Code(actors.Admit(actorServicePrefix+"counter", "a"))).To(Equal(codes.ResourceExhausted))
+		actors.Done(&coreActor.Message{ID: "1"})
+		Expect(actors.Admit(actorServicePrefix+"counter", "a")).To(Succeed())
+	})
+	It("should hold mailbox until message not replied is past handle timeout", func() {
+		actors = newActors(ActorConfig{HandleTimeout: time.Millisecond * 50}, newInbox(InboxConfig{}, "", nil, nil, nil), func(kind, id string) bool {
+			return true
+		}, zap.NewNop())
+		consumer := actors.NewConsumer(0)
+		actors.Define(0, "counter")
+		sent := message("1", "a")
+		sent.IsOneWay = true
+		actors.Put(sent)
+		actors.Put(message("2", "a"))
+		Expect((<-consumer).ID).To(Equal("1"))
+
+		// handler of a sent message returned without calling reply
+		actors.sweep()
+		Consistently(consumer, time.Millisecond*30).ShouldNot(Receive())
+		time.Sleep(time.Millisecond * 30)
+		actors.sweep()
+		Eventually(consumer).Should(Receive(WithTransform(func(msg *coreActor.Message) string {
+			return msg.ID
+		}, Equal("2"))))
+	})
+})
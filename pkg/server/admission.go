@@ -0,0 +1,92 @@
+package server
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// waited records how long request had waited in inbox, requests delivered later are counted from their delivery time
+func (inbox *Inbox) waited(req *RPCRequest) {
+	queuedAt := req.Timestamp
+	if req.DeliverAt.After(queuedAt) {
+		queuedAt = req.DeliverAt
+	}
+	now := time.Now()
+	inbox.Lock()
+	defer inbox.Unlock()
+	inbox.lastWait = now.Sub(queuedAt)
+	inbox.lastDispatchAt = now
+}
+
+// Age how long requests wait in inbox, it's measured on the last request handed to worker,
+// and keeps growing while requests are waiting and none is handed.
+func (inbox *Inbox) Age() time.Duration {
+	if inbox.Depth() == 0 {
+		return 0
+	}
+	inbox.Lock()
+	defer inbox.Unlock()
+	age := inbox.lastWait
+	if inbox.lastDispatchAt.IsZero() {
+		return age
+	}
+	if stalled := time.Since(inbox.lastDispatchAt); stalled > age {
+		age = stalled
+	}
+	return age
+}
+
+// Bytes size of requests waiting in inbox, backlog of previous run is estimated from queue files
+func (inbox *Inbox) Bytes() int64 {
+	return inbox.bytes.Load()
+}
+
+// Admit returns ResourceExhausted error while any limit of inbox is exceeded
+func (inbox *Inbox) Admit() error {
+	if limit := inbox.config.MaxDepth; limit > 0 {
+		if depth := inbox.Depth(); depth >= limit {
+			return status.Errorf(codes.ResourceExhausted, "inbox depth %d reached limit %d", depth, limit)
+		}
+	}
+	if limit := inbox.config.MaxBytes; limit > 0 {
+		if bytes := inbox.Bytes(); bytes >= limit {
+			return status.Errorf(codes.ResourceExhausted, "inbox bytes %d reached limit %d", bytes, limit)
+		}
+	}
+	if limit := inbox.config.MaxAge; limit > 0 {
+		if age := inbox.Age(); age > limit {
+			return status.Errorf(codes.ResourceExhausted, "inbox age %s exceeded limit %s", age.Round(time.Millisecond), limit)
+		}
+	}
+	return nil
+}
+
+// admit returns ResourceExhausted error while inbox is over any of its limits, or call is a message to an actor whose
+// mailbox is full
+func (s *Server) admit(name, key string) error {
+	if err := s.inbox.Admit(); err != nil {
+		return err
+	}
+	return s.actors.Admit(name, key)
+}
+
+// markOverloaded node rejected a call, it's avoided by routing until its next load report
+func (s *Server) markOverloaded(nodeName string) {
+	s.loadsMu.Lock()
+	defer s.loadsMu.Unlock()
+	s.overloaded[nodeName] = time.Now().Add(s.loadReportInterval())
+}
+
+// isOverloaded whether node rejected a call recently, or reported that it's rejecting calls
+func (s *Server) isOverloaded(nodeName string) bool {
+	s.loadsMu.RLock()
+	until, ok := s.overloaded[nodeName]
+	s.loadsMu.RUnlock()
+	if ok && time.Now().Before(until) {
+		return true
+	}
+	load := s.getLoad(nodeName)
+	return load != nil && load.Rejecting
+}
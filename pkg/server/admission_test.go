@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Admission", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	put := func(inbox *Inbox, count int) {
+		for i := 0; i < count; i++ {
+			Expect(inbox.Put(&RPCRequest{ID: "id", Name: "test", Body: make([]byte, 100), Timestamp: time.Now()})).To(Succeed())
+		}
+	}
+
+	// drain takes every request waiting as dispatcher does
+	drain := func(inbox *Inbox) {
+		readAhead(ctx, inbox)
+		Eventually(func() int64 {
+			for {
+				data, _, ok := inbox.next()
+				if !ok {
+					break
+				}
+				req := &RPCRequest{}
+				Expect(utils.UnmarshalGOB(data, req)).To(Succeed())
+				inbox.waited(req)
+			}
+			return inbox.Depth()
+		}).Should(BeZero())
+	}
+
+	expectRejected := func(inbox *Inbox) {
+		err := inbox.Admit()
+		Expect(err).NotTo(BeNil())
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+	}
+
+	It("should reject calls while max depth is reached", func() {
+		inbox := newInbox(InboxConfig{MaxDepth: 3}, "", newMemoryQueue, nil, nil)
+		put(inbox, 2)
+		Expect(inbox.Admit()).To(Succeed())
+		put(inbox, 1)
+		expectRejected(inbox)
+
+		drain(inbox)
+		Expect(inbox.Admit()).To(Succeed())
+	})
+
+	It("should reject calls while max bytes is reached", func() {
+		inbox := newInbox(InboxConfig{}, "", newMemoryQueue, nil, nil)
+		put(inbox, 1)
+		Expect(inbox.Bytes()).To(BeNumerically(">", 100))
+		// room for one more request
+		inbox.config.MaxBytes = inbox.Bytes()*2 + 1
+		put(inbox, 1)
+		Expect(inbox.Admit()).To(Succeed())
+		put(inbox, 1)
+		expectRejected(inbox)
+
+		drain(inbox)
+		Expect(inbox.Bytes()).To(BeZero())
+		Expect(inbox.Admit()).To(Succeed())
+	})
+
+	It("should reject calls while requests have waited longer than max age", func() {
+		inbox := newInbox(InboxConfig{MaxAge: time.Minute}, "", newMemoryQueue, nil, nil)
+		put(inbox, 2)
+		Expect(inbox.Admit()).To(Succeed())
+		inbox.waited(&RPCRequest{Timestamp: time.Now().Add(-time.Minute * 2)})
+		expectRejected(inbox)
+
+		drain(inbox)
+		Expect(inbox.Admit()).To(Succeed())
+	})
+})
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Second * 10
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker opens after consecutive failures, and lets a single probe through (half-open) once cooldown has passed
+type CircuitBreaker struct {
+	mu        *sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &CircuitBreaker{
+		mu:        &sync.Mutex{},
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *CircuitBreaker) currentState() BreakerState {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+	return b.state
+}
+
+// Available whether node can be picked by routing, it does not take the probe
+func (b *CircuitBreaker) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState() {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return !b.probing
+	}
+	return true
+}
+
+// Allow whether a call can be made, in half-open state only one probe is allowed at a time
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState() {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Release ends probe without telling whether node is healthy, e.g. caller gave up waiting
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+func (b *CircuitBreaker) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.currentState()
+	if state == BreakerOpen {
+		return fmt.Sprintf("%s (failures: %d, retry in %s)", state, b.failures, (b.cooldown - time.Since(b.openedAt)).Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s (failures: %d)", state, b.failures)
+}
+
+// isBreakerFailure only errors indicating node is unreachable or wedged are counted as failures
+func isBreakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// breakerRPCClient proto.RPCClient guarded by circuit breaker, replies are sent regardless of it
+type breakerRPCClient struct {
+	proto.RPCClient
+	nodeName string
+	breaker  *CircuitBreaker
+}
+
+func (c *breakerRPCClient) done(err error) {
+	if err == nil {
+		c.breaker.Success()
+	} else if isBreakerFailure(err) {
+		c.breaker.Failure()
+	} else {
+		c.breaker.Release()
+	}
+}
+
+func (c *breakerRPCClient) errOpen() error {
+	return status.Errorf(codes.Unavailable, "circuit breaker of node \"%s\" is open", c.nodeName)
+}
+
+func (c *breakerRPCClient) RPCCall(ctx context.Context, in *proto.CallRequest, opts ...grpc.CallOption) (*proto.CallResponse, error) {
+	if !c.breaker.Allow() {
+		return nil, c.errOpen()
+	}
+	res, err := c.RPCClient.RPCCall(ctx, in, opts...)
+	// calls waiting for replies are done once reply arrives or caller gives up, see Server.replied
+	if err != nil || in.IsOneWay {
+		c.done(err)
+	}
+	return res, err
+}
+
+func (c *breakerRPCClient) RPCBroadcast(ctx context.Context, in *proto.BroadcastRequest, opts ...grpc.CallOption) (*proto.BroadcastResponse, error) {
+	if !c.breaker.Allow() {
+		return nil, c.errOpen()
+	}
+	res, err := c.RPCClient.RPCBroadcast(ctx, in, opts...)
+	c.done(err)
+	return res, err
+}
+
+// replied records outcome of waiting for reply of call accepted by node. Replies not arriving in time count as failures,
+// so nodes accepting calls without ever answering them are cut off as well.
+func (s *Server) replied(nodeName string, err error) {
+	s.endpointMu.RLock()
+	breaker, ok := s.breakers[nodeName]
+	s.endpointMu.RUnlock()
+	if !ok {
+		return
+	}
+	switch {
+	case err == nil:
+		breaker.Success()
+	case errors.Is(err, context.DeadlineExceeded):
+		breaker.Failure()
+	default:
+		breaker.Release()
+	}
+}
+
+// isRoutable whether node is not cut off by its circuit breaker
+func (s *Server) isRoutable(nodeName string) bool {
+	s.endpointMu.RLock()
+	breaker, ok := s.breakers[nodeName]
+	s.endpointMu.RUnlock()
+	return !ok || breaker.Available()
+}
+
+func (s *Server) describeBreakers() string {
+	s.endpointMu.RLock()
+	defer s.endpointMu.RUnlock()
+	lines := make([]string, 0, len(s.breakers))
+	for nodeName, breaker := range s.breakers {
+		lines = append(lines, fmt.Sprintf("%s: %s", nodeName, breaker))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
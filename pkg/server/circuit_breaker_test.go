@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeRPCClient struct {
+	proto.RPCClient
+	err     error
+	calls   int
+	replies int
+}
+
+func (c *fakeRPCClient) RPCCall(ctx context.Context, in *proto.CallRequest, opts ...grpc.CallOption) (*proto.CallResponse, error) {
+	c.calls++
+	return &proto.CallResponse{}, c.err
+}
+
+func (c *fakeRPCClient) RPCReply(ctx context.Context, in *proto.ReplyRequest, opts ...grpc.CallOption) (*proto.ReplyResponse, error) {
+	c.replies++
+	return &proto.ReplyResponse{}, c.err
+}
+
+var _ = Describe("CircuitBreaker", func() {
+	It("should open after consecutive failures and probe once cooled down", func() {
+		b := NewCircuitBreaker(2, 50*time.Millisecond)
+		Expect(b.Allow()).To(BeTrue())
+		b.Failure()
+		b.Success()
+		b.Failure()
+		Expect(b.Available()).To(BeTrue())
+		b.Failure()
+		Expect(b.Available()).To(BeFalse())
+		Expect(b.Allow()).To(BeFalse())
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(b.Available()).To(BeTrue())
+		Expect(b.Allow()).To(BeTrue())
+		Expect(b.Allow()).To(BeFalse())
+		b.Failure()
+		Expect(b.Allow()).To(BeFalse())
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(b.Allow()).To(BeTrue())
+		b.Release()
+		Expect(b.Allow()).To(BeTrue())
+		b.Success()
+		Expect(b.Allow()).To(BeTrue())
+		Expect(b.Allow()).To(BeTrue())
+	})
+
+	It("should guard calls but not replies", func() {
+		b := NewCircuitBreaker(1, time.Minute)
+		rpc := &fakeRPCClient{err: status.Error(codes.Unavailable, "down")}
+		client := &breakerRPCClient{RPCClient: rpc, nodeName: "a", breaker: b}
+		_, err := client.RPCCall(context.Background(), &proto.CallRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		_, err = client.RPCCall(context.Background(), &proto.CallRequest{})
+		Expect(err).To(MatchError(ContainSubstring("circuit breaker")))
+
+		rpc.err = nil
+		_, err = client.RPCReply(context.Background(), &proto.ReplyRequest{})
+		Expect(err).To(BeNil())
+		Expect(rpc.replies).To(Equal(1))
+	})
+
+	It("should count replies not arriving in time as failures", func() {
+		b := NewCircuitBreaker(2, time.Minute)
+		s := &Server{
+			endpointMu: &sync.RWMutex{},
+			breakers:   map[string]*CircuitBreaker{"a": b},
+		}
+		client := &breakerRPCClient{RPCClient: &fakeRPCClient{}, nodeName: "a", breaker: b}
+		for i := 0; i < 2; i++ {
+			_, err := client.RPCCall(context.Background(), &proto.CallRequest{})
+			Expect(err).To(BeNil())
+			s.replied("a", context.DeadlineExceeded)
+		}
+		Expect(b.Available()).To(BeFalse())
+
+		b = NewCircuitBreaker(2, time.Minute)
+		s.breakers["a"] = b
+		s.replied("a", context.DeadlineExceeded)
+		s.replied("a", nil)
+		s.replied("a", context.DeadlineExceeded)
+		s.replied("a", context.Canceled)
+		Expect(b.Available()).To(BeTrue())
+		s.replied("b", context.DeadlineExceeded)
+	})
+
+	It("should count one way calls once accepted", func() {
+		b := NewCircuitBreaker(1, 50*time.Millisecond)
+		b.Failure()
+		time.Sleep(60 * time.Millisecond)
+		client := &breakerRPCClient{RPCClient: &fakeRPCClient{}, nodeName: "a", breaker: b}
+		_, err := client.RPCCall(context.Background(), &proto.CallRequest{IsOneWay: true})
+		Expect(err).To(BeNil())
+		Expect(b.state).To(Equal(BreakerClosed))
+	})
+})
@@ -1,15 +1,34 @@
 package server
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	NodeName    string         `yaml:"node-name"`
-	Gossip      GossipConfig   `yaml:"gossip"`
-	RPC         RPCConfig      `yaml:"rpc"`
-	Concurrency int            `yaml:"concurrency"`
-	Queue       QueueConfig    `yaml:"queue"`
-	Plugins     []PluginConfig `yaml:"plugins"`
-	ScriptArgs  []string       `yaml:"script-args"`
+	NodeName    string            `yaml:"node-name"`
+	Labels      map[string]string `yaml:"labels"`
+	Gossip      GossipConfig      `yaml:"gossip"`
+	RPC         RPCConfig         `yaml:"rpc"`
+	Raft        RaftConfig        `yaml:"raft"`
+	Concurrency int               `yaml:"concurrency"`
+	Queue       QueueConfig       `yaml:"queue"`
+	Plugins     []PluginConfig    `yaml:"plugins"`
+	ScriptArgs  []string          `yaml:"script-args"`
+}
+
+// Validate rejects values that would otherwise be ignored silently
+func (c *Config) Validate() error {
+	if _, err := NewRouter(c.RPC.Routing); err != nil {
+		return fmt.Errorf("rpc.routing: %w", err)
+	}
+	for _, name := range c.RPC.Retry.On {
+		if _, ok := retryableCodes[strings.ToLower(name)]; !ok {
+			return fmt.Errorf("rpc.retry.on: unknown retry error \"%s\"", name)
+		}
+	}
+	return nil
 }
 
 type PluginConfig struct {
@@ -18,11 +37,65 @@ type PluginConfig struct {
 }
 
 type QueueConfig struct {
-	Dir             string        `yaml:"dir"`
-	MaxBytesPerFile int64         `yaml:"max-bytes-per-file"`
-	MaxMsgSize      int32         `yaml:"max-msg-size"`
-	SyncEvery       int64         `yaml:"sync-every"`
-	SyncTimeout     time.Duration `yaml:"sync-timeout"`
+	Dir             string         `yaml:"dir"`
+	MaxBytesPerFile int64          `yaml:"max-bytes-per-file"`
+	MaxMsgSize      int32          `yaml:"max-msg-size"`
+	SyncEvery       int64          `yaml:"sync-every"`
+	SyncTimeout     time.Duration  `yaml:"sync-timeout"`
+	Inbox           InboxConfig    `yaml:"inbox"`
+	Jobs            JobsConfig     `yaml:"jobs"`
+	Workflow        WorkflowConfig `yaml:"workflow"`
+}
+
+// JobsConfig how background jobs are retried and redelivered
+type JobsConfig struct {
+	// VisibilityTimeout jobs not acked within this long after handed to workers are redelivered
+	VisibilityTimeout time.Duration `yaml:"visibility-timeout"`
+	// Retries default retries of jobs enqueued without retries
+	Retries    int           `yaml:"retries"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+}
+
+// WorkflowConfig how workflow instances are run and retried
+type WorkflowConfig struct {
+	// Concurrency instances run at the same time
+	Concurrency int `yaml:"concurrency"`
+	// StepTimeout default timeout of each call of steps defined without timeout
+	StepTimeout time.Duration `yaml:"step-timeout"`
+	Backoff     time.Duration `yaml:"backoff"`
+	MaxBackoff  time.Duration `yaml:"max-backoff"`
+	// CompensationRetries least times a failed compensation is retried before instance fails
+	CompensationRetries int `yaml:"compensation-retries"`
+	// Retention finished instances are kept this long for status lookups
+	Retention time.Duration `yaml:"retention"`
+}
+
+// InboxConfig how incoming requests are queued and scheduled to workers
+type InboxConfig struct {
+	// PerService requests of services not in any class are queued per service, otherwise they share default class
+	PerService bool `yaml:"per-service"`
+	// DefaultWeight weight of default class and per service queues, 1 if not set
+	DefaultWeight int                `yaml:"default-weight"`
+	Classes       []InboxClassConfig `yaml:"classes"`
+	// MaxDepth calls are rejected while this many requests are waiting, unlimited if not set
+	MaxDepth int64 `yaml:"max-depth"`
+	// MaxBytes calls are rejected while requests waiting take this many bytes, unlimited if not set
+	MaxBytes int64 `yaml:"max-bytes"`
+	// MaxAge calls are rejected while requests handed to workers have waited longer than this, unlimited if not set
+	MaxAge time.Duration `yaml:"max-age"`
+	// HandleTimeout calls not replied by workers within this long are given up, unlimited if not set
+	HandleTimeout time.Duration `yaml:"handle-timeout"`
+}
+
+// InboxClassConfig services sharing a queue, class named "default" configures the default class
+type InboxClassConfig struct {
+	Name     string   `yaml:"name"`
+	Services []string `yaml:"services"`
+	// Weight share of requests handed to workers when several classes are waiting
+	Weight int `yaml:"weight"`
+	// MaxInFlight at most this many requests of class are handled at the same time, unlimited if not set
+	MaxInFlight int `yaml:"max-in-flight"`
 }
 
 type GossipConfig struct {
@@ -32,9 +105,89 @@ type GossipConfig struct {
 }
 
 type RPCConfig struct {
-	Addr             string `yaml:"addr"`
-	Port             int32  `yaml:"port"`
-	ReplyConcurrency int    `yaml:"reply-concurrency"`
+	Addr               string            `yaml:"addr"`
+	Port               int32             `yaml:"port"`
+	ReplyConcurrency   int               `yaml:"reply-concurrency"`
+	Routing            string            `yaml:"routing"`
+	LoadReportInterval time.Duration     `yaml:"load-report-interval"`
+	Retry              RetryConfig       `yaml:"retry"`
+	CircuitBreaker     BreakerConfig     `yaml:"circuit-breaker"`
+	ReplyRetry         ReplyRetryConfig  `yaml:"reply-retry"`
+	Idempotency        IdempotencyConfig `yaml:"idempotency"`
+	Actor              ActorConfig       `yaml:"actor"`
+	TLS                TLSConfig         `yaml:"tls"`
+}
+
+// ActorConfig how long actors are kept active
+type ActorConfig struct {
+	// IdleTimeout actors without messages for this long are deactivated
+	IdleTimeout time.Duration `yaml:"idle-timeout"`
+	// HandleTimeout the next message is handed to actor if it hasn't replied within this long
+	HandleTimeout time.Duration `yaml:"handle-timeout"`
+	// MailboxSize messages an actor may have waiting, further ones are rejected until it catches up
+	MailboxSize int `yaml:"mailbox-size"`
+}
+
+// TLSConfig with CA configured, every peer must present a certificate issued by it
+type TLSConfig struct {
+	CAFile   string `yaml:"ca-file"`
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// VerifyNodeName requests must come from certificates issued for node they name, debug requests for AdminNames
+	VerifyNodeName bool          `yaml:"verify-node-name"`
+	AdminNames     []string      `yaml:"admin-names"`
+	ReloadInterval time.Duration `yaml:"reload-interval"`
+}
+
+// IsEnabled whether rpc port is served over tls
+func (c TLSConfig) IsEnabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// IsMutual whether peers are authenticated by their certificates
+func (c TLSConfig) IsMutual() bool {
+	return c.CAFile != ""
+}
+
+type RaftConfig struct {
+	Addr string `yaml:"addr"`
+	Port int32  `yaml:"port"`
+	// BootstrapExpect number of nodes to bootstrap with, nodes joining afterwards are added by the leader
+	BootstrapExpect   int           `yaml:"bootstrap-expect"`
+	ApplyTimeout      time.Duration `yaml:"apply-timeout"`
+	SnapshotInterval  time.Duration `yaml:"snapshot-interval"`
+	SnapshotThreshold uint64        `yaml:"snapshot-threshold"`
+}
+
+// IsEnabled whether node takes part in raft group
+func (c RaftConfig) IsEnabled() bool {
+	return c.Port > 0
+}
+
+type BreakerConfig struct {
+	Threshold int           `yaml:"threshold"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+}
+
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+	On         []string      `yaml:"on"`
+}
+
+// ReplyRetryConfig replies failed to be sent are retried with exponential backoff until callers give up,
+// or MaxAge has passed for callers waiting without timeout
+type ReplyRetryConfig struct {
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+	MaxAge     time.Duration `yaml:"max-age"`
+}
+
+// IdempotencyConfig recent idempotency keys and their replies are kept up to Capacity, for TTL after being replied
+type IdempotencyConfig struct {
+	Capacity int           `yaml:"capacity"`
+	TTL      time.Duration `yaml:"ttl"`
 }
 
 type ScriptConfig struct {
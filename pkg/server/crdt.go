@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	coreCRDT "github.com/joesonw/drlee/pkg/core/crdt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCRDTFlushInterval = time.Second
+	// maxCRDTBroadcastSize keeps a single change within one gossip packet, larger states are left to push/pull
+	maxCRDTBroadcastSize = 1024
+)
+
+var _ memberlist.Broadcast = &CRDTBroadcast{}
+
+// Invalidates a crdt is broadcast with either full local state or slot of local node in counters, which only grows,
+// thus each of them includes every previous one of the same node
+func (b CRDTBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*CRDTBroadcast); ok {
+		return o.Name == b.Name && o.NodeName == b.NodeName
+	}
+	return false
+}
+
+func (b CRDTBroadcast) Finished() {}
+
+// CRDTs crdts of local node, persisted to a local file
+type CRDTs struct {
+	store   *coreCRDT.Store
+	path    string
+	isDirty *atomic.Bool
+	logger  *zap.Logger
+}
+
+func newCRDTs(path string, logger *zap.Logger) *CRDTs {
+	return &CRDTs{
+		store:   coreCRDT.NewStore(),
+		path:    path,
+		isDirty: atomic.NewBool(false),
+		logger:  logger,
+	}
+}
+
+// Load merges states persisted in file
+func (c *CRDTs) Load() error {
+	b, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var states []*coreCRDT.State
+	if err := json.Unmarshal(b, &states); err != nil {
+		return fmt.Errorf("unable to load crdts from %s: %w", c.path, err)
+	}
+	for _, state := range states {
+		if _, err := c.store.Merge(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes states to file if there are changes since last flush
+func (c *CRDTs) Flush() error {
+	if !c.isDirty.CAS(true, false) {
+		return nil
+	}
+	states, err := c.store.Snapshot()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *CRDTs) startFlush(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(defaultCRDTFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Flush(); err != nil {
+					c.logger.Error("unable to persist crdts", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Merge merges state from peer
+func (c *CRDTs) Merge(state *coreCRDT.State) (bool, error) {
+	changed, err := c.store.Merge(state)
+	if changed {
+		c.isDirty.Store(true)
+	}
+	return changed, err
+}
+
+// handleCRDTBroadcast merges crdt state from peer
+func (s *Server) handleCRDTBroadcast(broadcast *CRDTBroadcast) {
+	changed, err := s.crdts.Merge(&coreCRDT.State{
+		Name: broadcast.Name,
+		Kind: broadcast.Kind,
+		Data: broadcast.Data,
+	})
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("unable to merge crdt \"%s\" from node %s", broadcast.Name, broadcast.NodeName), zap.Error(err))
+		return
+	}
+	if changed {
+		s.logger.Sugar().Debugf("merged crdt \"%s\" from node %s", broadcast.Name, broadcast.NodeName)
+	}
+}
+
+// localCRDTs states of every crdt, sent along with local state
+func (s *Server) localCRDTs() []*coreCRDT.State {
+	states, err := s.crdts.store.Snapshot()
+	if err != nil {
+		s.logger.Error("unable to snapshot crdts", zap.Error(err))
+	}
+	return states
+}
+
+type luaCRDTEnv struct {
+	server *Server
+}
+
+func (env *luaCRDTEnv) Update(name string, kind coreCRDT.Kind, update func(item coreCRDT.CRDT)) error {
+	nodeName := env.server.members.LocalNode().Name
+	state, err := env.server.crdts.store.Update(name, kind, nodeName, update)
+	if err != nil {
+		return err
+	}
+	env.server.crdts.isDirty.Store(true)
+	if len(state.Data) > maxCRDTBroadcastSize {
+		env.server.logger.Sugar().Debugf("crdt \"%s\" exceeds %d bytes, replicated by push/pull only", name, maxCRDTBroadcastSize)
+		return nil
+	}
+	env.server.broadcasts.QueueBroadcast(&CRDTBroadcast{
+		NodeName: nodeName,
+		Name:     state.Name,
+		Kind:     state.Kind,
+		Data:     state.Data,
+	})
+	return nil
+}
+
+func (env *luaCRDTEnv) Build() *coreCRDT.Env {
+	return &coreCRDT.Env{
+		NodeName: env.server.members.LocalNode().Name,
+		Update:   env.Update,
+		View:     env.server.crdts.store.View,
+	}
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CRDTBroadcast", func() {
+	It("should only invalidate broadcasts of the same crdt from the same node", func() {
+		b := &CRDTBroadcast{NodeName: "a", Name: "hits"}
+		Expect(b.Invalidates(&CRDTBroadcast{NodeName: "a", Name: "hits"})).To(BeTrue())
+		Expect(b.Invalidates(&CRDTBroadcast{NodeName: "b", Name: "hits"})).To(BeFalse())
+		Expect(b.Invalidates(&CRDTBroadcast{NodeName: "a", Name: "online"})).To(BeFalse())
+		Expect(b.Invalidates(&KVBroadcast{})).To(BeFalse())
+	})
+})
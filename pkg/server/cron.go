@@ -0,0 +1,46 @@
+package server
+
+import (
+	"hash/crc32"
+
+	coreCron "github.com/joesonw/drlee/pkg/core/cron"
+)
+
+// cronOwner node running cluster-once job of name, chosen from alive members by consistent hashing. Ownership moves
+// to the next node on the ring once the owner leaves.
+func (s *Server) cronOwner(name string) string {
+	var nodes []string
+	for _, member := range s.members.Members() {
+		nodes = append(nodes, member.Name)
+	}
+	return NewHashRing(nodes).Get("cron:"+name, nil)
+}
+
+// cronWorker worker of every node running job of name
+func (s *Server) cronWorker(name string) int {
+	return int(crc32.ChecksumIEEE([]byte(name)) % uint32(s.config.Concurrency))
+}
+
+type luaCronEnv struct {
+	server *Server
+	id     int
+}
+
+func (env *luaCronEnv) IsOwner(name string, mode coreCron.Mode) bool {
+	s := env.server
+	switch mode {
+	case coreCron.ModeWorker:
+		return true
+	case coreCron.ModeNode:
+		return s.cronWorker(name) == env.id
+	case coreCron.ModeCluster:
+		return s.cronWorker(name) == env.id && s.cronOwner(name) == s.members.LocalNode().Name
+	}
+	return false
+}
+
+func (env *luaCronEnv) Build() *coreCron.Env {
+	return &coreCron.Env{
+		IsOwner: env.IsOwner,
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	coreCron "github.com/joesonw/drlee/pkg/core/cron"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// newTestMembers memberlists of nodes joined on loopback
+func newTestMembers(names ...string) []*memberlist.Memberlist {
+	var list []*memberlist.Memberlist
+	for _, name := range names {
+		config := memberlist.DefaultLocalConfig()
+		config.Name = name
+		config.BindAddr = "127.0.0.1"
+		config.BindPort = 0
+		config.LogOutput = ioutil.Discard
+		members, err := memberlist.Create(config)
+		Expect(err).To(BeNil())
+		if len(list) > 0 {
+			_, err = members.Join([]string{list[0].LocalNode().Address()})
+			Expect(err).To(BeNil())
+		}
+		list = append(list, members)
+	}
+	for _, members := range list {
+		Eventually(members.NumMembers).Should(Equal(len(names)))
+	}
+	return list
+}
+
+var _ = Describe("Cron", func() {
+	var members []*memberlist.Memberlist
+	var envs map[string]*luaCronEnv
+	const concurrency = 2
+
+	BeforeEach(func() {
+		members = newTestMembers("a", "b", "c")
+		envs = map[string]*luaCronEnv{}
+		for _, m := range members {
+			envs[m.LocalNode().Name] = &luaCronEnv{server: &Server{config: &Config{Concurrency: concurrency}, members: m}}
+		}
+	})
+
+	AfterEach(func() {
+		for _, m := range members {
+			_ = m.Shutdown()
+		}
+	})
+
+	// firing nodes and workers that would fire job of name
+	firing := func(name string, mode coreCron.Mode) []string {
+		var list []string
+		for _, m := range members {
+			nodeName := m.LocalNode().Name
+			env, ok := envs[nodeName]
+			if !ok {
+				continue
+			}
+			for id := 0; id < concurrency; id++ {
+				env.id = id
+				if env.IsOwner(name, mode) {
+					list = append(list, fmt.Sprintf("%s/%d", nodeName, id))
+				}
+			}
+		}
+		return list
+	}
+
+	It("should fire jobs of each mode on as many workers as expected", func() {
+		Expect(firing("report", coreCron.ModeWorker)).To(HaveLen(3 * concurrency))
+		Expect(firing("report", coreCron.ModeNode)).To(HaveLen(3))
+		Expect(firing("report", coreCron.ModeCluster)).To(HaveLen(1))
+	})
+
+	It("should move cluster jobs once their owner leaves", func() {
+		owners := map[string]string{}
+		for i := 0; i < 20; i++ {
+			name := fmt.Sprintf("job-%d", i)
+			list := firing(name, coreCron.ModeCluster)
+			Expect(list).To(HaveLen(1))
+			owners[name] = list[0]
+		}
+
+		left := members[0]
+		Expect(left.Leave(time.Second)).To(Succeed())
+		Expect(left.Shutdown()).To(Succeed())
+		delete(envs, left.LocalNode().Name)
+		for _, m := range members[1:] {
+			Eventually(m.NumMembers).Should(Equal(2))
+		}
+
+		moved := 0
+		for name, owner := range owners {
+			list := firing(name, coreCron.ModeCluster)
+			Expect(list).To(HaveLen(1))
+			if owner[:1] == left.LocalNode().Name {
+				moved++
+				continue
+			}
+			// jobs of nodes still alive stay where they are
+			Expect(list[0]).To(Equal(owner))
+		}
+		Expect(moved).To(BeNumerically(">", 0))
+	})
+})
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	coreJobs "github.com/joesonw/drlee/pkg/core/jobs"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	"github.com/joesonw/drlee/pkg/utils"
+	"github.com/nsqio/go-diskqueue"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+type DeadLetterReason string
+
+const (
+	DeadLetterDecodeError  DeadLetterReason = "decode_error"
+	DeadLetterExpired      DeadLetterReason = "expired"
+	DeadLetterUnknownNode  DeadLetterReason = "unknown_node"
+	DeadLetterHandlerError DeadLetterReason = "handler_error"
+	DeadLetterUndelivered  DeadLetterReason = "undelivered"
+	// DeadLetterRetriesExhausted job failed, or wasn't acked in time, on every attempt
+	DeadLetterRetriesExhausted DeadLetterReason = "retries_exhausted"
+)
+
+type DeadLetterKind string
+
+const (
+	DeadLetterRequest DeadLetterKind = "request"
+	DeadLetterReply   DeadLetterKind = "reply"
+	DeadLetterJob     DeadLetterKind = "job"
+)
+
+// DeadLetter a request or reply failed to be handled or delivered, or a job failed on every attempt. Payload is the GOB
+// encoded RPCRequest, RPCResponse or job, or raw data if it can't be decoded
+type DeadLetter struct {
+	ID     string
+	Reason DeadLetterReason
+	Error  string
+	Kind   DeadLetterKind
+	// NodeName node request came from, or reply was sent to
+	NodeName string
+	// Name method of request or queue of job, empty for replies
+	Name string
+	// MessageID id of request or reply
+	MessageID string
+	// Timestamp when request was accepted or reply was made
+	Timestamp time.Time
+	DeadAt    time.Time
+	Payload   []byte
+}
+
+// DeadLetters dead letters of local node, each one is kept in its own file under dir, so that reading them never
+// takes them out
+type DeadLetters struct {
+	dir string
+	// legacy diskqueue dead letters were kept in by older versions, they are moved to dir once started
+	legacy diskqueue.Interface
+	mu     *sync.Mutex
+	logger *zap.Logger
+}
+
+func newDeadLetters(dir string, legacy diskqueue.Interface, logger *zap.Logger) *DeadLetters {
+	return &DeadLetters{
+		dir:    dir,
+		legacy: legacy,
+		mu:     &sync.Mutex{},
+		logger: logger,
+	}
+}
+
+// Start creates dir and moves dead letters left in legacy queue into it
+func (d *DeadLetters) Start() error {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	if d.legacy != nil {
+		go d.drainLegacy()
+	}
+	return nil
+}
+
+func (d *DeadLetters) drainLegacy() {
+	for b := range d.legacy.ReadChan() {
+		letter := &DeadLetter{}
+		if err := utils.UnmarshalGOB(b, letter); err != nil {
+			d.Record(&DeadLetter{
+				Reason:  DeadLetterDecodeError,
+				Error:   err.Error(),
+				Payload: b,
+			})
+			continue
+		}
+		if err := d.write(letter); err != nil {
+			d.logger.Error(fmt.Sprintf("unable to move dead letter %s out of legacy queue", letter.ID), zap.Error(err))
+		}
+	}
+}
+
+func (d *DeadLetters) Record(letter *DeadLetter) {
+	letter.ID = uuid.NewV4().String()
+	letter.DeadAt = time.Now()
+	if err := d.write(letter); err != nil {
+		d.logger.Error(fmt.Sprintf("unable to record dead letter of %s [%s]", letter.Kind, letter.MessageID), zap.Error(err))
+		return
+	}
+	d.logger.Sugar().Debugf("recorded dead letter of %s [%s]: %s", letter.Kind, letter.MessageID, letter.Reason)
+}
+
+// write persists letter in a file named after its death, so that files are listed in order
+func (d *DeadLetters) write(letter *DeadLetter) error {
+	b, err := utils.MarshalGOB(letter)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.dir, fmt.Sprintf("%020d-%s.gob", letter.DeadAt.UnixNano(), letter.ID))
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RecordRequest records request, it can be replayed later
+func (d *DeadLetters) RecordRequest(req *RPCRequest, reason DeadLetterReason, err error) {
+	payload, _ := utils.MarshalGOB(req)
+	letter := &DeadLetter{
+		Reason:    reason,
+		Kind:      DeadLetterRequest,
+		NodeName:  req.NodeName,
+		Name:      req.Name,
+		MessageID: req.ID,
+		Timestamp: req.Timestamp,
+		Payload:   payload,
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	d.Record(letter)
+}
+
+// RecordReply records reply, it can be replayed later
+func (d *DeadLetters) RecordReply(res *RPCResponse, reason DeadLetterReason, err error) {
+	payload, _ := utils.MarshalGOB(res)
+	letter := &DeadLetter{
+		Reason:    reason,
+		Kind:      DeadLetterReply,
+		NodeName:  res.NodeName,
+		MessageID: res.ID,
+		Timestamp: res.Timestamp,
+		Payload:   payload,
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	d.Record(letter)
+}
+
+// RecordJob records job with its last error, it can be replayed later
+func (d *DeadLetters) RecordJob(job *coreJobs.Job, reason DeadLetterReason) {
+	payload, _ := utils.MarshalGOB(job)
+	d.Record(&DeadLetter{
+		Reason:    reason,
+		Error:     job.Error,
+		Kind:      DeadLetterJob,
+		NodeName:  job.NodeName,
+		Name:      job.Queue,
+		MessageID: job.ID,
+		Timestamp: job.EnqueuedAt,
+		Payload:   payload,
+	})
+}
+
+// each goes through every dead letter in order, those fn returns false for are removed. Files failed to be read or
+// decoded are left as they are.
+func (d *DeadLetters) each(fn func(letter *DeadLetter) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files, err := ioutil.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".gob") {
+			continue
+		}
+		path := filepath.Join(d.dir, file.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			d.logger.Error(fmt.Sprintf("unable to read dead letter %s", path), zap.Error(err))
+			continue
+		}
+		letter := &DeadLetter{}
+		if err := utils.UnmarshalGOB(b, letter); err != nil {
+			d.logger.Error(fmt.Sprintf("unable to decode dead letter %s", path), zap.Error(err))
+			continue
+		}
+		if fn(letter) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List dead letters without payload
+func (d *DeadLetters) List() ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	err := d.each(func(letter *DeadLetter) bool {
+		letter.Payload = nil
+		letters = append(letters, letter)
+		return true
+	})
+	return letters, err
+}
+
+// Get dead letter by id, nil if not found
+func (d *DeadLetters) Get(id string) (*DeadLetter, error) {
+	var found *DeadLetter
+	err := d.each(func(letter *DeadLetter) bool {
+		if letter.ID == id {
+			found = letter
+		}
+		return true
+	})
+	return found, err
+}
+
+// Take removes dead letters having id and returns them, every one is taken if id is "all"
+func (d *DeadLetters) Take(id string) ([]*DeadLetter, error) {
+	var taken []*DeadLetter
+	err := d.each(func(letter *DeadLetter) bool {
+		if id == "all" || letter.ID == id {
+			taken = append(taken, letter)
+			return false
+		}
+		return true
+	})
+	return taken, err
+}
+
+// replayDeadLetters takes dead letters and puts them back into inbox, outbox or job queues, requests and replies are
+// replayed as new ones without timeout since their callers have given up already, jobs get their retries again. Letters failed to be replayed are recorded again.
+func (s *Server) replayDeadLetters(id string) (string, error) {
+	letters, err := s.deadLetters.Take(id)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, letter := range letters {
+		if err := s.replayDeadLetter(letter); err != nil {
+			s.deadLetters.Record(letter)
+			lines = append(lines, fmt.Sprintf("%s: %s", letter.ID, err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: replayed", letter.ID))
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("dead letter %s not found", id), nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Server) replayDeadLetter(letter *DeadLetter) error {
+	switch {
+	case letter.Reason == DeadLetterDecodeError:
+		return errors.New("undecodable message can't be replayed")
+	case letter.Kind == DeadLetterRequest:
+		req := &RPCRequest{}
+		if err := utils.UnmarshalGOB(letter.Payload, req); err != nil {
+			return err
+		}
+		req.Timestamp = time.Now()
+		req.Timeout = 0
+		req.DeliverAt = time.Time{}
+		// replayed request is handled again, its reply replaces the cached one
+		if req.IdempotencyKey != "" {
+			s.idempotency.forget(req.Name, req.IdempotencyKey)
+		}
+		return s.inbox.Put(req)
+	case letter.Kind == DeadLetterReply:
+		res := &RPCResponse{}
+		if err := utils.UnmarshalGOB(letter.Payload, res); err != nil {
+			return err
+		}
+		res.Timestamp = time.Now()
+		res.ExpiresAt = time.Time{}
+		res.Attempts = 0
+		return s.outbox.Put(res)
+	case letter.Kind == DeadLetterJob:
+		job := &coreJobs.Job{}
+		if err := utils.UnmarshalGOB(letter.Payload, job); err != nil {
+			return err
+		}
+		job.Attempt = 0
+		job.Error = ""
+		job.Lease = ""
+		job.DeliverAt = time.Time{}
+		return s.jobs.Enqueue(job)
+	}
+	return fmt.Errorf("unknown dead letter kind \"%s\"", letter.Kind)
+}
+
+func (s *Server) purgeDeadLetters(id string) (string, error) {
+	letters, err := s.deadLetters.Take(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("purged %d dead letters", len(letters)), nil
+}
+
+func (s *Server) describeDeadLetters() (string, error) {
+	return s.describeDeadLettersOf("", "no dead letters")
+}
+
+// describeFailedJobs dead letters of jobs
+func (s *Server) describeFailedJobs() (string, error) {
+	return s.describeDeadLettersOf(DeadLetterJob, "no failed jobs")
+}
+
+// describeDeadLettersOf lists dead letters of kind, every one if kind is empty
+func (s *Server) describeDeadLettersOf(kind DeadLetterKind, empty string) (string, error) {
+	letters, err := s.deadLetters.List()
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(letters))
+	for _, letter := range letters {
+		if kind != "" && letter.Kind != kind {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s [%s] %s node=%s dead_at=%s %s", letter.ID, letter.Kind, letter.Reason, letter.MessageID, letter.Name, letter.NodeName, letter.DeadAt.Format(time.RFC3339), letter.Error))
+	}
+	if len(lines) == 0 {
+		return empty, nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// describeDeadLetter every field of dead letter, payload of requests and replies is decoded
+func (s *Server) describeDeadLetter(id string) (string, error) {
+	letter, err := s.deadLetters.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if letter == nil {
+		return fmt.Sprintf("dead letter %s not found", id), nil
+	}
+	lines := []string{
+		"id: " + letter.ID,
+		"kind: " + string(letter.Kind),
+		"reason: " + string(letter.Reason),
+		"error: " + letter.Error,
+		"node: " + letter.NodeName,
+		"name: " + letter.Name,
+		"message_id: " + letter.MessageID,
+		"timestamp: " + letter.Timestamp.Format(time.RFC3339Nano),
+		"dead_at: " + letter.DeadAt.Format(time.RFC3339Nano),
+	}
+	switch letter.Kind {
+	case DeadLetterRequest:
+		req := &RPCRequest{}
+		if err := utils.UnmarshalGOB(letter.Payload, req); err != nil {
+			lines = append(lines, fmt.Sprintf("payload: %q", letter.Payload))
+			break
+		}
+		lines = append(lines, "codec: "+req.Codec, fmt.Sprintf("timeout: %s", req.Timeout), fmt.Sprintf("body: %s", req.Body))
+	case DeadLetterReply:
+		res := &RPCResponse{}
+		if err := utils.UnmarshalGOB(letter.Payload, res); err != nil {
+			lines = append(lines, fmt.Sprintf("payload: %q", letter.Payload))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("is_error: %t", res.IsError), fmt.Sprintf("result: %s", res.Result))
+	case DeadLetterJob:
+		job := &coreJobs.Job{}
+		if err := utils.UnmarshalGOB(letter.Payload, job); err != nil {
+			lines = append(lines, fmt.Sprintf("payload: %q", letter.Payload))
+			break
+		}
+		lines = append(lines, "codec: "+job.Codec, fmt.Sprintf("attempts: %d", job.Attempt), fmt.Sprintf("retries: %d", job.Retries), fmt.Sprintf("payload: %s", job.Payload))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// luaRPCFailed records requests handler failed with
+func (s *Server) luaRPCFailed(req *coreRPC.Request, err error) {
+	s.deadLetters.RecordRequest(&RPCRequest{
+		ID:             req.ID,
+		Name:           req.Name,
+		Body:           req.Body,
+		Timestamp:      time.Now(),
+		NodeName:       req.NodeName,
+		IsLoopBack:     req.IsLoopBack,
+		Codec:          req.Codec,
+		IdempotencyKey: req.IdempotencyKey,
+	}, DeadLetterHandlerError, err)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/joesonw/drlee/pkg/utils"
+	diskqueue "github.com/nsqio/go-diskqueue"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+// legacyDeadLetterQueue diskqueue holding given messages
+type legacyDeadLetterQueue struct {
+	diskqueue.Interface
+	ch chan []byte
+}
+
+func newLegacyDeadLetterQueue(messages ...[]byte) *legacyDeadLetterQueue {
+	ch := make(chan []byte, len(messages))
+	for _, b := range messages {
+		ch <- b
+	}
+	return &legacyDeadLetterQueue{ch: ch}
+}
+
+func (q *legacyDeadLetterQueue) ReadChan() <-chan []byte {
+	return q.ch
+}
+
+var _ = Describe("DeadLetters", func() {
+	var dir string
+	var letters *DeadLetters
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-dead-letters")
+		Expect(err).To(BeNil())
+		letters = newDeadLetters(filepath.Join(dir, "dead-letters"), nil, zap.NewNop())
+		Expect(letters.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	ids := func(list []*DeadLetter) []string {
+		var result []string
+		for _, letter := range list {
+			result = append(result, letter.MessageID)
+		}
+		return result
+	}
+
+	It("should keep letters while listing and getting them", func() {
+		letters.Record(&DeadLetter{Kind: DeadLetterRequest, MessageID: "1", Payload: []byte("a")})
+		letters.Record(&DeadLetter{Kind: DeadLetterReply, MessageID: "2", Payload: []byte("b")})
+
+		for i := 0; i < 2; i++ {
+			list, err := letters.List()
+			Expect(err).To(BeNil())
+			Expect(ids(list)).To(Equal([]string{"1", "2"}))
+			Expect(list[0].Payload).To(BeNil())
+		}
+
+		list, _ := letters.List()
+		letter, err := letters.Get(list[1].ID)
+		Expect(err).To(BeNil())
+		Expect(letter.Payload).To(Equal([]byte("b")))
+
+		// survives restart
+		letters = newDeadLetters(filepath.Join(dir, "dead-letters"), nil, zap.NewNop())
+		Expect(letters.Start()).To(Succeed())
+		list, err = letters.List()
+		Expect(err).To(BeNil())
+		Expect(ids(list)).To(Equal([]string{"1", "2"}))
+	})
+
+	It("should remove taken letters only", func() {
+		letters.Record(&DeadLetter{MessageID: "1"})
+		letters.Record(&DeadLetter{MessageID: "2"})
+		list, _ := letters.List()
+
+		taken, err := letters.Take(list[0].ID)
+		Expect(err).To(BeNil())
+		Expect(ids(taken)).To(Equal([]string{"1"}))
+		list, _ = letters.List()
+		Expect(ids(list)).To(Equal([]string{"2"}))
+
+		taken, err = letters.Take("all")
+		Expect(err).To(BeNil())
+		Expect(ids(taken)).To(Equal([]string{"2"}))
+		list, _ = letters.List()
+		Expect(list).To(BeEmpty())
+	})
+
+	It("should leave undecodable files in place", func() {
+		path := filepath.Join(dir, "dead-letters", "0-broken.gob")
+		Expect(ioutil.WriteFile(path, []byte("broken"), 0600)).To(Succeed())
+		letters.Record(&DeadLetter{MessageID: "1"})
+
+		taken, err := letters.Take("all")
+		Expect(err).To(BeNil())
+		Expect(ids(taken)).To(Equal([]string{"1"}))
+		_, err = os.Stat(path)
+		Expect(err).To(BeNil())
+	})
+
+	It("should move letters out of legacy queue", func() {
+		b, err := utils.MarshalGOB(&DeadLetter{ID: "legacy", MessageID: "1"})
+		Expect(err).To(BeNil())
+		letters = newDeadLetters(filepath.Join(dir, "dead-letters"), newLegacyDeadLetterQueue(b, []byte("broken")), zap.NewNop())
+		Expect(letters.Start()).To(Succeed())
+
+		Eventually(func() int {
+			list, _ := letters.List()
+			return len(list)
+		}).Should(Equal(2))
+		letter, err := letters.Get("legacy")
+		Expect(err).To(BeNil())
+		Expect(letter.MessageID).To(Equal("1"))
+		list, _ := letters.List()
+		Expect(list[1].Reason).To(Equal(DeadLetterDecodeError))
+	})
+})
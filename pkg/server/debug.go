@@ -40,6 +40,7 @@ func (s *Server) RPCDebug(ctx context.Context, req *proto.DebugRequest) (res *pr
 				ID:         uuid.NewV4().String(),
 				Name:       call.Name,
 				Body:       call.Body,
+				Codec:      call.Codec,
 				Timestamp:  time.Now(),
 				IsLoopBack: true,
 			})
@@ -49,12 +50,51 @@ func (s *Server) RPCDebug(ctx context.Context, req *proto.DebugRequest) (res *pr
 
 			res = &proto.DebugResponse{Body: result}
 		}
+	case "breakers":
+		res = &proto.DebugResponse{Body: []byte(s.describeBreakers())}
+	case "raft":
+		res = &proto.DebugResponse{Body: []byte(s.describeRaft())}
+	case "inbox":
+		res = &proto.DebugResponse{Body: []byte(s.inbox.describe())}
+	case "outbox":
+		res = &proto.DebugResponse{Body: []byte(s.outbox.describe())}
+	case "jobs":
+		res = &proto.DebugResponse{Body: []byte(s.jobs.describe())}
+	case "failed-jobs":
+		res, err = debugResponse(s.describeFailedJobs())
+	case "actors":
+		res = &proto.DebugResponse{Body: []byte(s.actors.describe())}
+	case "workflows":
+		res = &proto.DebugResponse{Body: []byte(s.workflows.describe())}
+	case "workflow":
+		res, err = debugResponse(s.workflows.describeInstance(string(req.Body)))
+	case "resume":
+		id := string(req.Body)
+		if err = s.workflows.Resume(id); err != nil {
+			return
+		}
+		res = &proto.DebugResponse{Body: []byte(fmt.Sprintf("resumed workflow instance \"%s\"", id))}
+	case "dead-letters":
+		res, err = debugResponse(s.describeDeadLetters())
+	case "dead-letter":
+		res, err = debugResponse(s.describeDeadLetter(string(req.Body)))
+	case "replay":
+		res, err = debugResponse(s.replayDeadLetters(string(req.Body)))
+	case "purge":
+		res, err = debugResponse(s.purgeDeadLetters(string(req.Body)))
 	default:
 		res = &proto.DebugResponse{Body: []byte(fmt.Sprintf("command '%s' not found", req.Name))}
 	}
 	return res, err
 }
 
+func debugResponse(body string, err error) (*proto.DebugResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DebugResponse{Body: []byte(body)}, nil
+}
+
 func (s *Server) RPCDebugStream(req *proto.DebugRequest, stream proto.RPC_RPCDebugStreamServer) error {
 	return nil
 }
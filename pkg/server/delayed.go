@@ -0,0 +1,172 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/utils"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+// delayedRetryInterval delivery of a due request is retried after this long if it failed
+const delayedRetryInterval = time.Second
+
+type delayedRequest struct {
+	path string
+	req  *RPCRequest
+}
+
+type delayedHeap []*delayedRequest
+
+func (h delayedHeap) Len() int { return len(h) }
+func (h delayedHeap) Less(i, j int) bool {
+	return h[i].req.DeliverAt.Before(h[j].req.DeliverAt)
+}
+func (h delayedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *delayedHeap) Push(x interface{}) {
+	*h = append(*h, x.(*delayedRequest))
+}
+func (h *delayedHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// DelayedInbox requests not yet due, each one is kept in its own file under dir until it's handed to inbox,
+// so that they survive restarts
+type DelayedInbox struct {
+	dir    string
+	mu     *sync.Mutex
+	items  delayedHeap
+	wake   chan struct{}
+	logger *zap.Logger
+}
+
+func newDelayedInbox(dir string, logger *zap.Logger) *DelayedInbox {
+	return &DelayedInbox{
+		dir:    dir,
+		mu:     &sync.Mutex{},
+		wake:   make(chan struct{}, 1),
+		logger: logger,
+	}
+}
+
+// Load reads every request persisted in dir
+func (d *DelayedInbox) Load() error {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".gob") {
+			continue
+		}
+		path := filepath.Join(d.dir, file.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		req := &RPCRequest{}
+		if err := utils.UnmarshalGOB(b, req); err != nil {
+			d.logger.Error(fmt.Sprintf("unable to load delayed request %s, removing", path), zap.Error(err))
+			_ = os.Remove(path)
+			continue
+		}
+		heap.Push(&d.items, &delayedRequest{path: path, req: req})
+	}
+	return nil
+}
+
+// Len number of requests not yet due
+func (d *DelayedInbox) Len() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return int64(len(d.items))
+}
+
+// Put persists request, it's returned once request is written to disk
+func (d *DelayedInbox) Put(req *RPCRequest) error {
+	b, err := utils.MarshalGOB(req)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.gob", req.DeliverAt.UnixNano(), uuid.NewV4().String())
+	path := filepath.Join(d.dir, name)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	heap.Push(&d.items, &delayedRequest{path: path, req: req})
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// due pops next request if it's due, otherwise returns how long until it is
+func (d *DelayedInbox) due() (*delayedRequest, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return nil, time.Hour
+	}
+	if wait := time.Until(d.items[0].req.DeliverAt); wait > 0 {
+		return nil, wait
+	}
+	return heap.Pop(&d.items).(*delayedRequest), 0
+}
+
+// start hands due requests to deliver, file of request is removed once it's delivered. Requests failed to be
+// delivered are retried later.
+func (d *DelayedInbox) start(ctx context.Context, deliver func(req *RPCRequest) error) {
+	go func() {
+		for {
+			item, wait := d.due()
+			if item != nil {
+				if err := deliver(item.req); err != nil {
+					d.logger.Error(fmt.Sprintf("unable to deliver delayed request [%s]", item.req.ID), zap.Error(err))
+					item.req.DeliverAt = time.Now().Add(delayedRetryInterval)
+					d.mu.Lock()
+					heap.Push(&d.items, item)
+					d.mu.Unlock()
+					continue
+				}
+				if err := os.Remove(item.path); err != nil {
+					d.logger.Error(fmt.Sprintf("unable to remove delivered request %s", item.path), zap.Error(err))
+				}
+				continue
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-d.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("DelayedInbox", func() {
+	var dir string
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-delayed")
+		Expect(err).To(BeNil())
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(dir)
+	})
+
+	newDelayed := func() *DelayedInbox {
+		d := newDelayedInbox(dir, zap.NewNop())
+		Expect(d.Load()).To(Succeed())
+		return d
+	}
+
+	type delivery struct {
+		id string
+		at time.Time
+	}
+
+	collect := func(d *DelayedInbox, fail func(req *RPCRequest) bool) <-chan delivery {
+		ch := make(chan delivery, 16)
+		d.start(ctx, func(req *RPCRequest) error {
+			if fail != nil && fail(req) {
+				return errors.New("inbox is closed")
+			}
+			ch <- delivery{id: req.ID, at: time.Now()}
+			return nil
+		})
+		return ch
+	}
+
+	files := func() int {
+		list, err := ioutil.ReadDir(dir)
+		Expect(err).To(BeNil())
+		return len(list)
+	}
+
+	It("should deliver requests in order once they are due", func() {
+		d := newDelayed()
+		now := time.Now()
+		Expect(d.Put(&RPCRequest{ID: "2", DeliverAt: now.Add(200 * time.Millisecond)})).To(Succeed())
+		Expect(d.Put(&RPCRequest{ID: "1", DeliverAt: now.Add(100 * time.Millisecond)})).To(Succeed())
+		Expect(d.Len()).To(Equal(int64(2)))
+
+		ch := collect(d, nil)
+		var first, second delivery
+		Eventually(ch).Should(Receive(&first))
+		Eventually(ch).Should(Receive(&second))
+		Expect(first.id).To(Equal("1"))
+		Expect(second.id).To(Equal("2"))
+		Expect(first.at).To(BeTemporally(">=", now.Add(100*time.Millisecond)))
+		Expect(second.at).To(BeTemporally(">=", now.Add(200*time.Millisecond)))
+		Eventually(files).Should(BeZero())
+	})
+
+	It("should wake up for requests due earlier than the next one", func() {
+		d := newDelayed()
+		ch := collect(d, nil)
+		Expect(d.Put(&RPCRequest{ID: "later", DeliverAt: time.Now().Add(time.Hour)})).To(Succeed())
+		Expect(d.Put(&RPCRequest{ID: "soon", DeliverAt: time.Now().Add(50 * time.Millisecond)})).To(Succeed())
+
+		var got delivery
+		Eventually(ch).Should(Receive(&got))
+		Expect(got.id).To(Equal("soon"))
+		Expect(d.Len()).To(Equal(int64(1)))
+	})
+
+	It("should keep requests across restarts", func() {
+		d := newDelayed()
+		Expect(d.Put(&RPCRequest{ID: "1", Name: "echo", DeliverAt: time.Now().Add(100 * time.Millisecond)})).To(Succeed())
+		Expect(files()).To(Equal(1))
+
+		d = newDelayed()
+		Expect(d.Len()).To(Equal(int64(1)))
+		ch := collect(d, nil)
+		var got delivery
+		Eventually(ch).Should(Receive(&got))
+		Expect(got.id).To(Equal("1"))
+		Eventually(files).Should(BeZero())
+	})
+
+	It("should retry requests failed to be delivered", func() {
+		d := newDelayed()
+		Expect(d.Put(&RPCRequest{ID: "1", DeliverAt: time.Now()})).To(Succeed())
+		failures := 0
+		ch := collect(d, func(*RPCRequest) bool {
+			failures++
+			return failures == 1
+		})
+		var got delivery
+		Eventually(ch, 3*time.Second).Should(Receive(&got))
+		Expect(got.id).To(Equal("1"))
+		Expect(failures).To(Equal(2))
+		Eventually(files).Should(BeZero())
+	})
+})
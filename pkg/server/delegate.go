@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,7 +16,14 @@ import (
 // when broadcasting an alive message. It's length is limited to
 // the given byte size. This metadata is available in the Node structure.
 func (s *Server) NodeMeta(limit int) []byte {
-	return s.meta.Encode()
+	meta := s.meta
+	meta.RaftBootstrapped = s.raftBootstrapped.Load()
+	b := meta.Encode()
+	if len(b) > limit {
+		s.logger.Warn(fmt.Sprintf("node meta exceeds %d bytes, labels are not gossiped", limit))
+		return Meta{RPCPort: meta.RPCPort, RaftPort: meta.RaftPort, RaftBootstrapped: meta.RaftBootstrapped}.Encode()
+	}
+	return b
 }
 
 // NotifyMsg is called when a user-data message is received.
@@ -23,13 +31,49 @@ func (s *Server) NodeMeta(limit int) []byte {
 // so would block the entire UDP packet receive loop. Additionally, the byte
 // slice may be modified after the call returns, so it should be copied if needed
 func (s *Server) NotifyMsg(b []byte) {
-	if MessageType(b[0]) == TypeRegistryBroadcast {
+	switch MessageType(b[0]) {
+	case TypeRegistryBroadcast:
 		broadcast := &RegistryBroadcast{}
 		if err := unmarshalMessage(b, broadcast); err != nil {
 			s.logger.Error("unable to unmarshal RegistryBroadcast message", zap.Error(err))
 			return
 		}
 		s.handleRegistryBroadcast(broadcast)
+	case TypeLoadBroadcast:
+		broadcast := &LoadBroadcast{}
+		if err := unmarshalMessage(b, broadcast); err != nil {
+			s.logger.Error("unable to unmarshal LoadBroadcast message", zap.Error(err))
+			return
+		}
+		s.handleLoadBroadcast(broadcast)
+	case TypeSubscriptionBroadcast:
+		broadcast := &SubscriptionBroadcast{}
+		if err := unmarshalMessage(b, broadcast); err != nil {
+			s.logger.Error("unable to unmarshal SubscriptionBroadcast message", zap.Error(err))
+			return
+		}
+		s.handleSubscriptionBroadcast(broadcast)
+	case TypeKVBroadcast:
+		broadcast := &KVBroadcast{}
+		if err := unmarshalMessage(b, broadcast); err != nil {
+			s.logger.Error("unable to unmarshal KVBroadcast message", zap.Error(err))
+			return
+		}
+		s.handleKVBroadcast(broadcast)
+	case TypeCRDTBroadcast:
+		broadcast := &CRDTBroadcast{}
+		if err := unmarshalMessage(b, broadcast); err != nil {
+			s.logger.Error("unable to unmarshal CRDTBroadcast message", zap.Error(err))
+			return
+		}
+		s.handleCRDTBroadcast(broadcast)
+	case TypeJobQueueBroadcast:
+		broadcast := &JobQueueBroadcast{}
+		if err := unmarshalMessage(b, broadcast); err != nil {
+			s.logger.Error("unable to unmarshal JobQueueBroadcast message", zap.Error(err))
+			return
+		}
+		s.handleJobQueueBroadcast(broadcast)
 	}
 }
 
@@ -38,8 +82,10 @@ func (s *Server) NotifyMsg(b []byte) {
 // the limit. Care should be taken that this method does not block,
 // since doing so would block the entire UDP packet receive loop.
 func (s *Server) GetBroadcasts(overhead, limit int) [][]byte {
-	s.broadcasts.GetBroadcasts(overhead, limit)
-	return nil
+	if s.broadcasts == nil {
+		return nil
+	}
+	return s.broadcasts.GetBroadcasts(overhead, limit)
 }
 
 // LocalState is used for a TCP Push/Pull. This is sent to
@@ -58,10 +104,17 @@ func (s *Server) LocalState(join bool) []byte {
 			Timestamp: time.Now(),
 			Name:      name,
 			Weight:    weight,
+			Codec:     s.localCodecs[name],
 		}
 		i++
 	}
-	b, _ := json.Marshal(services)
+	b, _ := json.Marshal(&RemoteState{
+		Services:      services,
+		Subscriptions: s.localSubscriptions(),
+		KV:            s.kv.List(),
+		CRDTs:         s.localCRDTs(),
+		JobQueues:     s.localJobQueues(),
+	})
 	return b
 }
 
@@ -70,14 +123,33 @@ func (s *Server) LocalState(join bool) []byte {
 // remote side's LocalState call. The 'join'
 // boolean indicates this is for a join instead of a push/pull.
 func (s *Server) MergeRemoteState(buf []byte, join bool) {
-	var services []*RegistryBroadcast
-	err := json.Unmarshal(buf, &services)
+	state := &RemoteState{}
+	var err error
+	if len(buf) > 0 && buf[0] == '[' {
+		err = json.Unmarshal(buf, &state.Services)
+	} else {
+		err = json.Unmarshal(buf, state)
+	}
 	if err != nil {
 		s.logger.Error("unable to merge remote state", zap.Error(err))
 		return
 	}
-	for _, svc := range services {
+	for _, svc := range state.Services {
 		s.handleRegistryBroadcast(svc)
 	}
+	for _, sub := range state.Subscriptions {
+		s.handleSubscriptionBroadcast(sub)
+	}
+	for _, queue := range state.JobQueues {
+		s.handleJobQueueBroadcast(queue)
+	}
+	for _, entry := range state.KV {
+		s.handleKVBroadcast(entry)
+	}
+	for _, crdt := range state.CRDTs {
+		if _, err := s.crdts.Merge(crdt); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to merge crdt \"%s\"", crdt.Name), zap.Error(err))
+		}
+	}
 	s.logger.Info("merged remote state")
 }
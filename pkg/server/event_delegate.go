@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
 )
 
 // EventDelegate is a simpler delegate that is used only to receive
@@ -14,8 +15,14 @@ import (
 // NotifyJoin is invoked when a node is detected to have joined.
 // The Node argument must not be modified.
 func (s *Server) NotifyJoin(node *memberlist.Node) {
-	ep := s.handleNode(node)
+	ep, err := s.handleNode(node)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("unable to handle peer %s(%s)", node.Name, node.Addr), zap.Error(err))
+		return
+	}
 	s.logger.Info(fmt.Sprintf("peer %s(%s) joined, rpc-port: %d", ep.Name, ep.Addr, ep.Meta.RPCPort))
+	s.triggerRaftReconcile()
+	s.outbox.Wake(node.Name)
 }
 
 // NotifyLeave is invoked when a node is detected to have left.
@@ -23,15 +30,35 @@ func (s *Server) NotifyJoin(node *memberlist.Node) {
 func (s *Server) NotifyLeave(node *memberlist.Node) {
 	s.logger.Info(fmt.Sprintf("peer %s(%s) left", node.Name, node.Addr))
 	s.servicesMu.Lock()
-	defer s.servicesMu.Unlock()
 	s.endpointMu.Lock()
-	defer s.endpointMu.Unlock()
-
 	delete(s.endpointRPCs, node.Name)
 	delete(s.endpoints, node.Name)
-	for _, group := range s.services {
+	delete(s.endpointMetas, node.Name)
+	delete(s.breakers, node.Name)
+	for name, group := range s.services {
+		delete(group, node.Name)
+		s.deleteServiceCodec(name, node.Name)
+	}
+	s.endpointMu.Unlock()
+	s.servicesMu.Unlock()
+
+	s.loadsMu.Lock()
+	delete(s.loads, node.Name)
+	s.loadsMu.Unlock()
+
+	s.subscriptionsMu.Lock()
+	for topic, group := range s.subscriptions {
 		delete(group, node.Name)
+		if len(group) == 0 {
+			delete(s.subscriptions, topic)
+		}
 	}
+	s.subscriptionsMu.Unlock()
+	s.jobs.RemoveNode(node.Name)
+	s.invalidateRings()
+	s.triggerRaftReconcile()
+	go s.releaseNodeLeases(node.Name)
+	s.workflows.TriggerTakeOver()
 }
 
 // NotifyUpdate is invoked when a node is detected to have
@@ -45,6 +72,11 @@ func (s *Server) NotifyUpdate(node *memberlist.Node) {
 		s.logger.Warn(fmt.Sprintf("memberlist NotifyUpdate non-exist node \"%s\"", node.Name))
 		return
 	}
-	ep := s.handleNode(node)
+	ep, err := s.handleNode(node)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("unable to handle peer %s(%s)", node.Name, node.Addr), zap.Error(err))
+		return
+	}
 	s.logger.Info(fmt.Sprintf("peer %s(%s) updateda, rpc-port: %d", ep.Name, ep.Addr, ep.Meta.RPCPort))
+	s.triggerRaftReconcile()
 }
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+const hashRingReplicas = 128
+
+// HashRing consistent hash ring, each node is placed on the ring multiple times (virtual nodes),
+// so only keys owned by a joining/leaving node are moved
+type HashRing struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+func NewHashRing(nodes []string) *HashRing {
+	r := &HashRing{
+		nodes: map[uint32]string{},
+	}
+	for _, node := range nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			// virtual nodes colliding are owned by the smaller node name, so ring doesn't depend on order of nodes
+			if owner, ok := r.nodes[hash]; ok {
+				if node < owner {
+					r.nodes[hash] = node
+				}
+				continue
+			}
+			r.hashes = append(r.hashes, hash)
+			r.nodes[hash] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+	return r
+}
+
+func (r *HashRing) IsEmpty() bool {
+	return len(r.hashes) == 0
+}
+
+// Get returns node owning key, the next node clockwise is used if owner is skipped. Returns empty if no node available
+func (r *HashRing) Get(key string, skip func(node string) bool) string {
+	if r.IsEmpty() {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	for i := 0; i < len(r.hashes); i++ {
+		node := r.nodes[r.hashes[(idx+i)%len(r.hashes)]]
+		if skip == nil || !skip(node) {
+			return node
+		}
+	}
+	return ""
+}
+
+// getRing returns hash ring of nodes offering service, including local node
+func (s *Server) getRing(name string) *HashRing {
+	s.ringsMu.Lock()
+	defer s.ringsMu.Unlock()
+	if ring, ok := s.rings[name]; ok {
+		return ring
+	}
+
+	var nodes []string
+	s.servicesMu.RLock()
+	for nodeName := range s.services[name] {
+		nodes = append(nodes, nodeName)
+	}
+	s.servicesMu.RUnlock()
+	s.localServicesMu.RLock()
+	if _, ok := s.localServices[name]; ok {
+		nodes = append(nodes, s.members.LocalNode().Name)
+	}
+	s.localServicesMu.RUnlock()
+
+	ring := NewHashRing(nodes)
+	s.rings[name] = ring
+	return ring
+}
+
+// invalidateRings drops cached rings of given services, or all rings if none is given
+func (s *Server) invalidateRings(names ...string) {
+	s.ringsMu.Lock()
+	defer s.ringsMu.Unlock()
+	if len(names) == 0 {
+		s.rings = map[string]*HashRing{}
+		return
+	}
+	for _, name := range names {
+		delete(s.rings, name)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HashRing", func() {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	owners := func(ring *HashRing) map[string]string {
+		m := map[string]string{}
+		for _, key := range keys {
+			m[key] = ring.Get(key, nil)
+		}
+		return m
+	}
+
+	It("should place virtual nodes of different nodes apart", func() {
+		ring := NewHashRing([]string{"1", "12", "2a", "a"})
+		Expect(ring.hashes).To(HaveLen(4 * hashRingReplicas))
+		counts := map[string]int{}
+		for _, node := range ring.nodes {
+			counts[node]++
+		}
+		Expect(counts).To(HaveLen(4))
+	})
+
+	It("should not depend on order of nodes", func() {
+		Expect(owners(NewHashRing([]string{"a", "b", "c"}))).To(Equal(owners(NewHashRing([]string{"c", "a", "b"}))))
+	})
+
+	It("should distribute keys", func() {
+		counts := map[string]int{}
+		for _, node := range owners(NewHashRing([]string{"a", "b", "c", "d"})) {
+			counts[node]++
+		}
+		Expect(counts).To(HaveLen(4))
+		for _, count := range counts {
+			Expect(count).To(BeNumerically("~", len(keys)/4, len(keys)/10))
+		}
+	})
+
+	It("should only move keys of node added or removed", func() {
+		before := owners(NewHashRing([]string{"a", "b", "c"}))
+		added := owners(NewHashRing([]string{"a", "b", "c", "d"}))
+		moved := 0
+		for key, node := range added {
+			if node != before[key] {
+				Expect(node).To(Equal("d"))
+				moved++
+			}
+		}
+		Expect(moved).To(BeNumerically("~", len(keys)/4, len(keys)/10))
+
+		removed := owners(NewHashRing([]string{"a", "c"}))
+		for key, node := range removed {
+			if before[key] != "b" {
+				Expect(node).To(Equal(before[key]))
+			} else {
+				Expect(node).NotTo(Equal("b"))
+			}
+		}
+	})
+
+	It("should skip nodes", func() {
+		ring := NewHashRing([]string{"a", "b"})
+		for _, key := range keys[:100] {
+			Expect(ring.Get(key, func(node string) bool { return node == "a" })).To(Equal("b"))
+		}
+		Expect(ring.Get("key", func(string) bool { return true })).To(BeEmpty())
+		Expect(NewHashRing(nil).Get("key", nil)).To(BeEmpty())
+	})
+})
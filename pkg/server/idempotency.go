@@ -0,0 +1,366 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultIdempotencyCapacity      = 10000
+	defaultIdempotencyTTL           = time.Hour * 24
+	defaultIdempotencyFlushInterval = time.Second
+)
+
+// IdempotencyEntry call of a method with idempotency key, its reply is cached once handler returns
+type IdempotencyEntry struct {
+	Name string
+	Key  string
+	// RequestID id of the call being handled, duplicates of other ids wait for its reply
+	RequestID string
+	IsDone    bool
+	Result    []byte
+	IsError   bool
+	CreatedAt time.Time
+	// ExpiresAt pending entries are given up once caller of the original call gives up, replies are cached until then
+	ExpiresAt time.Time
+	waiters   []*idempotencyWaiter
+}
+
+// idempotencyWaiter duplicate call waiting for the original one to be replied
+type idempotencyWaiter struct {
+	id         string
+	nodeName   string
+	isLoopBack bool
+	expiresAt  time.Time
+	// req duplicate call, it's queued again if the original one is abandoned
+	req *RPCRequest
+}
+
+// IdempotencyTable recent idempotency keys of local node and their replies, bounded by capacity and persisted to a
+// local file
+type IdempotencyTable struct {
+	mu       *sync.Mutex
+	entries  map[string]*IdempotencyEntry
+	order    []string
+	requests map[string]string
+	capacity int
+	ttl      time.Duration
+	path     string
+	isDirty  bool
+	logger   *zap.Logger
+}
+
+func newIdempotencyTable(config IdempotencyConfig, path string, logger *zap.Logger) *IdempotencyTable {
+	if config.Capacity <= 0 {
+		config.Capacity = defaultIdempotencyCapacity
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultIdempotencyTTL
+	}
+	return &IdempotencyTable{
+		mu:       &sync.Mutex{},
+		entries:  map[string]*IdempotencyEntry{},
+		requests: map[string]string{},
+		capacity: config.Capacity,
+		ttl:      config.TTL,
+		path:     path,
+		logger:   logger,
+	}
+}
+
+func idempotencyTableKey(name, key string) string {
+	return name + "\x00" + key
+}
+
+// Load restores entries persisted in file, expired ones are dropped. Pending ones are dropped as well, as their calls
+// may have been lost along with the process; calls still in inbox claim their keys again once they are read.
+func (t *IdempotencyTable) Load() error {
+	b, err := ioutil.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []*IdempotencyEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("unable to load idempotency keys from %s: %w", t.path, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.IsDone || now.After(entry.ExpiresAt) {
+			continue
+		}
+		key := idempotencyTableKey(entry.Name, entry.Key)
+		t.entries[key] = entry
+		t.order = append(t.order, key)
+	}
+	return nil
+}
+
+// Flush writes entries to file if there are changes since last flush
+func (t *IdempotencyTable) Flush() error {
+	t.mu.Lock()
+	if !t.isDirty {
+		t.mu.Unlock()
+		return nil
+	}
+	t.isDirty = false
+	entries := make([]*IdempotencyEntry, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, entry)
+	}
+	b, err := json.Marshal(entries)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := t.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+func (t *IdempotencyTable) startFlush(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(defaultIdempotencyFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					t.logger.Error("unable to persist idempotency keys", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// begin looks up key of request, returns true if it is to be handled. Otherwise the cached entry is returned for
+// duplicates of calls already replied, or request waits for the original call to be replied.
+// isQueued is set once request is read from inbox, so the original call is handled even if it was delivered before.
+func (t *IdempotencyTable) begin(req *RPCRequest, isQueued bool) (*IdempotencyEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	key := idempotencyTableKey(req.Name, req.IdempotencyKey)
+	entry, ok := t.entries[key]
+	if ok && now.After(entry.ExpiresAt) {
+		t.remove(key)
+		ok = false
+	}
+	if !ok {
+		entry = &IdempotencyEntry{
+			Name:      req.Name,
+			Key:       req.IdempotencyKey,
+			RequestID: req.ID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(t.ttl),
+		}
+		if req.Timeout > 0 {
+			entry.ExpiresAt = req.Timestamp.Add(req.Timeout)
+		}
+		t.entries[key] = entry
+		t.order = append(t.order, key)
+		t.requests[req.ID] = key
+		t.isDirty = true
+		t.evict()
+		return nil, true
+	}
+	if entry.IsDone {
+		cached := *entry
+		cached.waiters = nil
+		return &cached, false
+	}
+	if entry.RequestID == req.ID {
+		// caller retried a call already in inbox, it's replied once handled
+		return nil, isQueued
+	}
+	waiter := &idempotencyWaiter{
+		id:         req.ID,
+		nodeName:   req.NodeName,
+		isLoopBack: req.IsLoopBack,
+		req:        req,
+	}
+	if req.Timeout > 0 {
+		waiter.expiresAt = req.Timestamp.Add(req.Timeout)
+	}
+	entry.waiters = append(entry.waiters, waiter)
+	return nil, false
+}
+
+// complete caches reply of request, returns duplicates waiting for it
+func (t *IdempotencyTable) complete(id string, result []byte, isError bool) []*idempotencyWaiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok := t.requests[id]
+	if !ok {
+		return nil
+	}
+	delete(t.requests, id)
+	entry, ok := t.entries[key]
+	if !ok || entry.RequestID != id {
+		return nil
+	}
+	entry.IsDone = true
+	entry.Result = result
+	entry.IsError = isError
+	entry.ExpiresAt = time.Now().Add(t.ttl)
+	waiters := entry.waiters
+	entry.waiters = nil
+	t.isDirty = true
+	return waiters
+}
+
+// abort forgets key of request not accepted after all, so it can be called again
+func (t *IdempotencyTable) abort(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if key, ok := t.requests[id]; ok {
+		t.remove(key)
+	}
+}
+
+// abandon forgets keys of requests that are lost without being replied, returns duplicates waiting for them
+func (t *IdempotencyTable) abandon(ids []string) []*idempotencyWaiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var waiters []*idempotencyWaiter
+	for _, id := range ids {
+		key, ok := t.requests[id]
+		if !ok {
+			continue
+		}
+		if entry, ok := t.entries[key]; ok && entry.RequestID == id {
+			waiters = append(waiters, entry.waiters...)
+		}
+		t.remove(key)
+	}
+	return waiters
+}
+
+// forget drops key of method, so the next call of it is handled again
+func (t *IdempotencyTable) forget(name, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(idempotencyTableKey(name, key))
+}
+
+// remove drops entry of key, it's left in order until evicted. Table must be locked
+func (t *IdempotencyTable) remove(key string) {
+	entry, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	delete(t.entries, key)
+	delete(t.requests, entry.RequestID)
+	t.isDirty = true
+}
+
+// evict drops the oldest replied entries over capacity, pending ones are kept until they are replied. Table must be
+// locked
+func (t *IdempotencyTable) evict() {
+	for scanned := len(t.order); len(t.entries) > t.capacity && scanned > 0; scanned-- {
+		key := t.order[0]
+		t.order = t.order[1:]
+		entry, ok := t.entries[key]
+		if !ok {
+			continue
+		}
+		if !entry.IsDone {
+			t.order = append(t.order, key)
+			continue
+		}
+		t.remove(key)
+	}
+	// keys removed otherwise are left behind
+	if len(t.order) > 2*t.capacity {
+		order := make([]string, 0, len(t.entries))
+		for _, key := range t.order {
+			if _, ok := t.entries[key]; ok {
+				order = append(order, key)
+			}
+		}
+		t.order = order
+	}
+}
+
+// Len number of keys in table and those being handled
+func (t *IdempotencyTable) Len() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries), len(t.requests)
+}
+
+// deduplicate checks idempotency key of request, returns true if it's a duplicate: it's replied with the cached reply
+// right away, or once the original call is replied. Streams are never deduplicated.
+func (s *Server) deduplicate(req *RPCRequest, isQueued bool) bool {
+	if req.IdempotencyKey == "" || req.IsStream {
+		return false
+	}
+	cached, ok := s.idempotency.begin(req, isQueued)
+	if ok {
+		return false
+	}
+	if cached != nil {
+		s.logger.Sugar().Debugf("replied duplicate rpc call [%s] '%s' with reply of [%s]", req.ID, req.Name, cached.RequestID)
+		waiter := &idempotencyWaiter{
+			id:         req.ID,
+			nodeName:   req.NodeName,
+			isLoopBack: req.IsLoopBack,
+		}
+		if req.Timeout > 0 {
+			waiter.expiresAt = req.Timestamp.Add(req.Timeout)
+		}
+		s.replyDuplicate(waiter, cached.Result, cached.IsError)
+	}
+	return true
+}
+
+// completeIdempotent caches reply of request and sends it to duplicates waiting for it
+func (s *Server) completeIdempotent(id string, result []byte, isError bool) {
+	for _, waiter := range s.idempotency.complete(id, result, isError) {
+		s.replyDuplicate(waiter, result, isError)
+	}
+}
+
+// abandonIdempotent forgets keys of requests dropped without being handled, duplicates waiting for them are queued
+// again, the first one read from inbox is handled in place of the original call
+func (s *Server) abandonIdempotent(ids []string) {
+	for _, waiter := range s.idempotency.abandon(ids) {
+		if err := s.inbox.Put(waiter.req); err != nil {
+			s.deadLetters.RecordRequest(waiter.req, DeadLetterUndelivered, err)
+		}
+	}
+}
+
+func (s *Server) replyDuplicate(waiter *idempotencyWaiter, result []byte, isError bool) {
+	r := &RPCResponse{
+		ID:        waiter.id,
+		Result:    result,
+		Timestamp: time.Now(),
+		NodeName:  waiter.nodeName,
+		IsError:   isError,
+		ExpiresAt: waiter.expiresAt,
+	}
+	if err := s.queueReply(r, waiter.isLoopBack); err != nil {
+		s.logger.Error("unable to reply duplicate rpc call", zap.Error(err))
+	}
+}
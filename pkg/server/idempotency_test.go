@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("IdempotencyTable", func() {
+	var dir string
+	var table *IdempotencyTable
+
+	newRequest := func(id string) *RPCRequest {
+		return &RPCRequest{
+			ID:             id,
+			Name:           "charge",
+			IdempotencyKey: "order-1",
+			Timestamp:      time.Now(),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-idempotency")
+		Expect(err).To(BeNil())
+		table = newIdempotencyTable(IdempotencyConfig{}, filepath.Join(dir, "idempotency.json"), zap.NewNop())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should let duplicates wait for the original call", func() {
+		_, ok := table.begin(newRequest("1"), false)
+		Expect(ok).To(BeTrue())
+		_, ok = table.begin(newRequest("2"), false)
+		Expect(ok).To(BeFalse())
+
+		waiters := table.complete("1", []byte("done"), false)
+		Expect(waiters).To(HaveLen(1))
+		Expect(waiters[0].id).To(Equal("2"))
+		cached, ok := table.begin(newRequest("3"), false)
+		Expect(ok).To(BeFalse())
+		Expect(cached.Result).To(Equal([]byte("done")))
+	})
+
+	It("should hand duplicates of abandoned calls back to be queued again", func() {
+		table.begin(newRequest("1"), false)
+		table.begin(newRequest("2"), false)
+
+		waiters := table.abandon([]string{"1"})
+		Expect(waiters).To(HaveLen(1))
+		Expect(waiters[0].req.ID).To(Equal("2"))
+
+		// the first duplicate read from inbox claims the key
+		_, ok := table.begin(waiters[0].req, true)
+		Expect(ok).To(BeTrue())
+		_, ok = table.begin(newRequest("3"), true)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should only restore replied keys", func() {
+		table.begin(newRequest("1"), false)
+		other := newRequest("2")
+		other.IdempotencyKey = "order-2"
+		table.begin(other, false)
+		table.complete("2", []byte("done"), false)
+		Expect(table.Flush()).To(Succeed())
+
+		table = newIdempotencyTable(IdempotencyConfig{}, filepath.Join(dir, "idempotency.json"), zap.NewNop())
+		Expect(table.Load()).To(Succeed())
+		entries, pending := table.Len()
+		Expect(entries).To(Equal(1))
+		Expect(pending).To(Equal(0))
+
+		// call still in inbox claims its key again
+		_, ok := table.begin(newRequest("1"), true)
+		Expect(ok).To(BeTrue())
+	})
+})
@@ -1,62 +1,430 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
 	"github.com/joesonw/drlee/pkg/utils"
-	"github.com/nsqio/go-diskqueue"
 	uuid "github.com/satori/go.uuid"
+	"go.uber.org/atomic"
 )
 
+const (
+	// cancellations of requests not yet handed to workers are kept for this long
+	inboxCancelTTL = time.Minute * 10
+	// inboxSweepInterval running requests past deadline are given up this often
+	inboxSweepInterval = time.Second
+)
+
+// Inbox requests are queued by class of their service and priority, dispatcher hands them to workers in fair shares
 type Inbox struct {
-	diskqueue.Interface
 	*sync.Mutex
-	consumers map[int]chan *coreRPC.Request
+	config         InboxConfig
+	dir            string
+	newQueue       QueueFactory
+	serviceClasses map[string]string
+	classes        map[string]*inboxClass
+	vtime          uint64
+	// bytes size of requests waiting, lastWait how long the last request handed to worker had waited
+	bytes          *atomic.Int64
+	lastWait       time.Duration
+	lastDispatchAt time.Time
+	ctx            context.Context
+	wake           chan struct{}
+	requests       chan *RPCRequest
+	delayed        *DelayedInbox
+	deadLetters    *DeadLetters
+	consumers      map[int]chan *coreRPC.Request
+	running        map[string]chan struct{}
+	// origins nodes running requests came from, empty for loopback ones, only they may cancel them
+	origins map[string]string
+	// deadlines when callers of running requests give up, startedAt when they were handed to workers
+	deadlines map[string]time.Time
+	startedAt map[string]time.Time
+	cancelled map[string]*inboxCancel
+	// dispatched class of requests handed to workers, inFlight counts them by class
+	dispatched map[string]string
+	inFlight   map[string]int
+	runningMu  *sync.Mutex
+	// deduplicate returns true for duplicates of calls with idempotency key, they are not handed to workers
+	deduplicate func(req *RPCRequest) bool
+	// route takes requests handed to workers otherwise, e.g. actor messages go to mailboxes of their actors
+	route func(req *RPCRequest) bool
 }
 
-func newInbox(queue diskqueue.Interface) *Inbox {
+func newInbox(config InboxConfig, dir string, newQueue QueueFactory, delayed *DelayedInbox, deadLetters *DeadLetters) *Inbox {
+	serviceClasses := map[string]string{}
+	for _, class := range config.Classes {
+		for _, service := range class.Services {
+			serviceClasses[service] = safeQueueName(class.Name)
+		}
+	}
 	return &Inbox{
-		Interface: queue,
-		Mutex:     &sync.Mutex{},
-		consumers: map[int]chan *coreRPC.Request{},
+		Mutex:          &sync.Mutex{},
+		config:         config,
+		dir:            dir,
+		newQueue:       newQueue,
+		serviceClasses: serviceClasses,
+		classes:        map[string]*inboxClass{},
+		bytes:          atomic.NewInt64(0),
+		wake:           make(chan struct{}, 1),
+		requests:       make(chan *RPCRequest),
+		delayed:        delayed,
+		deadLetters:    deadLetters,
+		consumers:      map[int]chan *coreRPC.Request{},
+		running:        map[string]chan struct{}{},
+		deadlines:      map[string]time.Time{},
+		startedAt:      map[string]time.Time{},
+		origins:        map[string]string{},
+		cancelled:      map[string]*inboxCancel{},
+		dispatched:     map[string]string{},
+		inFlight:       map[string]int{},
+		runningMu:      &sync.Mutex{},
 	}
 }
 
-func (inbox *Inbox) Reset() {
+// InFlight number of requests handed to workers but not yet replied
+func (inbox *Inbox) InFlight() int64 {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	return int64(len(inbox.running))
+}
+
+// start marks request from node as handed to worker, returns channel closed once it's cancelled by caller.
+// Returns false if request was cancelled by the same node before being handed.
+func (inbox *Inbox) start(id, nodeName string, expiresAt time.Time) (<-chan struct{}, bool) {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	if cancel, ok := inbox.cancelled[id]; ok {
+		delete(inbox.cancelled, id)
+		if cancel.nodeName == nodeName {
+			inbox.release(id)
+			return nil, false
+		}
+	}
+	done := make(chan struct{})
+	inbox.running[id] = done
+	inbox.origins[id] = nodeName
+	inbox.startedAt[id] = time.Now()
+	if !expiresAt.IsZero() {
+		inbox.deadlines[id] = expiresAt
+	}
+	return done, true
+}
+
+// Deadline when caller of running request gives up, zero if it waits as long as it takes
+func (inbox *Inbox) Deadline(id string) time.Time {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	return inbox.deadlines[id]
+}
+
+// Running whether request is handed to worker and neither replied nor cancelled
+func (inbox *Inbox) Running(id string) bool {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	_, ok := inbox.running[id]
+	return ok
+}
+
+// Done marks a handed request as replied, returns false if it's no longer running (e.g. cancelled by caller)
+func (inbox *Inbox) Done(id string) bool {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	_, ok := inbox.running[id]
+	inbox.forget(id)
+	return ok
+}
+
+// forget drops running request and frees its slot, runningMu must be locked
+func (inbox *Inbox) forget(id string) {
+	delete(inbox.running, id)
+	delete(inbox.origins, id)
+	delete(inbox.deadlines, id)
+	delete(inbox.startedAt, id)
+	inbox.release(id)
+}
+
+// inboxOverdue running request given up by sweep
+type inboxOverdue struct {
+	id       string
+	nodeName string
+	// expired caller has given up already, otherwise worker hasn't replied within handle timeout
+	expired bool
+}
+
+// startSweep gives up running requests past deadline periodically, each of them is passed to fn once it's released
+func (inbox *Inbox) startSweep(ctx context.Context, fn func(*inboxOverdue)) {
+	go func() {
+		ticker := time.NewTicker(inboxSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, overdue := range inbox.sweep(time.Now()) {
+					fn(overdue)
+				}
+			}
+		}
+	}()
+}
+
+// sweep cancels and releases requests whose callers have given up, and requests handed to workers longer than
+// handle timeout ago. Actor messages are left to actors' own handle timeout, unless callers have given up.
+func (inbox *Inbox) sweep(now time.Time) []*inboxOverdue {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	var list []*inboxOverdue
+	for id, done := range inbox.running {
+		overdue := &inboxOverdue{id: id, nodeName: inbox.origins[id]}
+		if deadline, ok := inbox.deadlines[id]; ok && now.After(deadline) {
+			overdue.expired = true
+		} else if _, ok := inbox.dispatched[id]; !ok || inbox.config.HandleTimeout <= 0 ||
+			now.Sub(inbox.startedAt[id]) < inbox.config.HandleTimeout {
+			continue
+		}
+		close(done)
+		inbox.forget(id)
+		list = append(list, overdue)
+	}
+	return list
+}
+
+// reserve counts request dispatched to workers in its class
+func (inbox *Inbox) reserve(id, class string) {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	inbox.dispatched[id] = class
+	inbox.inFlight[class]++
+}
+
+// release frees slot of dispatched request in its class, runningMu must be locked
+func (inbox *Inbox) release(id string) {
+	class, ok := inbox.dispatched[id]
+	if !ok {
+		return
+	}
+	delete(inbox.dispatched, id)
+	inbox.inFlight[class]--
+	inbox.notify()
+}
+
+// inboxCancel cancel of a request not yet handed to workers, it only drops request if it comes from the same node
+type inboxCancel struct {
+	at       time.Time
+	nodeName string
+}
+
+// Cancel signals running request, or drops it when it's read from queue later. Only node request came from may cancel
+// it, nodeName is empty for loopback requests.
+func (inbox *Inbox) Cancel(id, nodeName string) error {
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	if done, ok := inbox.running[id]; ok {
+		if origin := inbox.origins[id]; origin != nodeName {
+			return fmt.Errorf("request [%s] didn't come from node \"%s\"", id, nodeName)
+		}
+		close(done)
+		inbox.forget(id)
+		return nil
+	}
+
+	now := time.Now()
+	for cancelledID, cancel := range inbox.cancelled {
+		if now.Sub(cancel.at) > inboxCancelTTL {
+			delete(inbox.cancelled, cancelledID)
+		}
+	}
+	inbox.cancelled[id] = &inboxCancel{at: now, nodeName: nodeName}
+	return nil
+}
+
+// Reset drops workers along with requests handed to them, returns ids of those dropped without being replied
+func (inbox *Inbox) Reset() []string {
 	inbox.Lock()
 	defer inbox.Unlock()
 	for _, ch := range inbox.consumers {
 		close(ch)
 	}
 	inbox.consumers = map[int]chan *coreRPC.Request{}
+
+	inbox.runningMu.Lock()
+	dropped := make([]string, 0, len(inbox.dispatched))
+	for id := range inbox.dispatched {
+		dropped = append(dropped, id)
+	}
+	for id := range inbox.running {
+		if _, ok := inbox.dispatched[id]; !ok {
+			dropped = append(dropped, id)
+		}
+	}
+	inbox.running = map[string]chan struct{}{}
+	inbox.deadlines = map[string]time.Time{}
+	inbox.startedAt = map[string]time.Time{}
+	inbox.origins = map[string]string{}
+	inbox.cancelled = map[string]*inboxCancel{}
+	inbox.dispatched = map[string]string{}
+	inbox.inFlight = map[string]int{}
+	inbox.runningMu.Unlock()
+	inbox.notify()
+	return dropped
 }
 
+// Put puts request into queue, requests to be delivered later are kept in delayed inbox until then
 func (inbox *Inbox) Put(req *RPCRequest) error {
+	if req.DeliverAt.After(time.Now()) {
+		return inbox.delayed.Put(req)
+	}
+	return inbox.put(req)
+}
+
+func (inbox *Inbox) put(req *RPCRequest) error {
 	var b []byte
 	b, err := utils.MarshalGOB(req)
 	if err != nil {
 		return err
 	}
-	return inbox.Interface.Put(b)
+	if err := inbox.queue(inbox.classOf(req.Name), normalizePriority(req.Priority)).Put(b); err != nil {
+		return err
+	}
+	inbox.bytes.Add(int64(len(b)))
+	return nil
+}
+
+// startDispatch opens queues and starts handing their requests to workers
+func (inbox *Inbox) startDispatch(ctx context.Context) error {
+	inbox.Lock()
+	inbox.ctx = ctx
+	inbox.Unlock()
+	if err := inbox.openQueues(); err != nil {
+		return err
+	}
+	inbox.Lock()
+	for _, class := range inbox.classes {
+		for _, q := range class.queues {
+			go inbox.read(ctx, q)
+		}
+	}
+	inbox.Unlock()
+	go inbox.dispatch(ctx)
+	return nil
+}
+
+// dispatch hands requests to whichever worker is free, undecodable and expired requests are recorded as dead letters
+func (inbox *Inbox) dispatch(ctx context.Context) {
+	for {
+		data, class, ok := inbox.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-inbox.wake:
+			}
+			continue
+		}
+		req := &RPCRequest{}
+		if err := utils.UnmarshalGOB(data, req); err != nil {
+			inbox.deadLetters.Record(&DeadLetter{
+				Reason:  DeadLetterDecodeError,
+				Error:   err.Error(),
+				Kind:    DeadLetterRequest,
+				Payload: data,
+			})
+			continue
+		}
+		inbox.waited(req)
+		if req.Timeout != 0 && req.Timestamp.Add(req.Timeout).Before(time.Now()) {
+			inbox.deadLetters.RecordRequest(req, DeadLetterExpired, nil)
+			continue
+		}
+		if inbox.deduplicate != nil && inbox.deduplicate(req) {
+			continue
+		}
+		if inbox.route != nil && inbox.route(req) {
+			continue
+		}
+		inbox.reserve(req.ID, class)
+		select {
+		case inbox.requests <- req:
+		case <-ctx.Done():
+			_ = inbox.put(req)
+			return
+		}
+	}
+}
+
+// startDelayed hands requests of delayed inbox to workers once they are due
+func (inbox *Inbox) startDelayed(ctx context.Context) error {
+	if err := inbox.delayed.Load(); err != nil {
+		return err
+	}
+	inbox.delayed.start(ctx, func(req *RPCRequest) error {
+		if len(req.BroadcastIDs) > 0 {
+			return inbox.broadcast(req, req.BroadcastIDs)
+		}
+		return inbox.put(req)
+	})
+	return nil
 }
 
-func (inbox *Inbox) Broadcast(req *RPCRequest) []string {
-	var ids []string
+// Broadcast hands request to every worker, returns id of each request. Delayed broadcast is persisted with ids
+// assigned to workers at the moment.
+func (inbox *Inbox) Broadcast(req *RPCRequest) ([]string, error) {
+	inbox.Lock()
+	ids := make([]string, len(inbox.consumers))
+	inbox.Unlock()
+	for i := range ids {
+		ids[i] = uuid.NewV4().String()
+	}
+	if req.DeliverAt.After(time.Now()) {
+		req.BroadcastIDs = ids
+		if err := inbox.delayed.Put(req); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+	return ids, inbox.broadcast(req, ids)
+}
+
+// broadcast hands request to workers with ids in order, workers started after ids are assigned are skipped.
+// It fails if there is no worker, e.g. lua is reloading.
+func (inbox *Inbox) broadcast(req *RPCRequest, ids []string) error {
+	var expiresAt time.Time
+	if req.Timeout > 0 {
+		expiresAt = req.Timestamp.Add(req.Timeout)
+	}
+	inbox.Lock()
+	consumers := make([]chan *coreRPC.Request, 0, len(inbox.consumers))
 	for _, consumer := range inbox.consumers {
-		id := uuid.NewV4().String()
-		ids = append(ids, id)
+		consumers = append(consumers, consumer)
+	}
+	inbox.Unlock()
+	if len(ids) > 0 && len(consumers) == 0 {
+		return errors.New("no worker is running")
+	}
+	for i, consumer := range consumers {
+		if i >= len(ids) {
+			break
+		}
+		id := ids[i]
 		consumer <- &coreRPC.Request{
 			ID:         id,
 			Name:       req.Name,
 			Body:       req.Body,
 			NodeName:   req.NodeName,
 			IsLoopBack: req.IsLoopBack,
-			ExpiresAt:  req.Timestamp.Add(req.Timeout),
+			ExpiresAt:  expiresAt,
+			IsStream:   req.IsStream,
+			Codec:      req.Codec,
 		}
 	}
-	return ids
+	return nil
 }
 
 func (inbox *Inbox) NewConsumer(id int) <-chan *coreRPC.Request {
@@ -65,34 +433,41 @@ func (inbox *Inbox) NewConsumer(id int) <-chan *coreRPC.Request {
 	inbox.Lock()
 	inbox.consumers[id] = consumer
 	inbox.Unlock()
-	read := inbox.ReadChan()
 	go func() {
 		for {
 			select {
-			case data := <-read:
-				{
-					req := &RPCRequest{}
-					if err := utils.UnmarshalGOB(data, req); err != nil {
-						continue
-					}
-					var expiresAt time.Time
-					if req.Timeout != 0 {
-						expiresAt = req.Timestamp.Add(req.Timeout)
-						if expiresAt.Before(time.Now()) {
-							continue
-						}
-					}
-					ch <- &coreRPC.Request{
-						ID:         req.ID,
-						Name:       req.Name,
-						Body:       req.Body,
-						NodeName:   req.NodeName,
-						IsLoopBack: req.IsLoopBack,
-						ExpiresAt:  expiresAt,
-					}
+			case req := <-inbox.requests:
+				var expiresAt time.Time
+				if req.Timeout != 0 {
+					expiresAt = req.Timestamp.Add(req.Timeout)
+				}
+				done, ok := inbox.start(req.ID, req.NodeName, expiresAt)
+				if !ok {
+					continue
+				}
+				ch <- &coreRPC.Request{
+					ID:             req.ID,
+					Name:           req.Name,
+					Body:           req.Body,
+					NodeName:       req.NodeName,
+					IsLoopBack:     req.IsLoopBack,
+					ExpiresAt:      expiresAt,
+					IsStream:       req.IsStream,
+					Codec:          req.Codec,
+					Priority:       req.Priority,
+					Done:           done,
+					IdempotencyKey: req.IdempotencyKey,
+				}
+			case req, ok := <-consumer:
+				// closed by Reset, worker is gone
+				if !ok {
+					return
+				}
+				done, ok := inbox.start(req.ID, req.NodeName, req.ExpiresAt)
+				if !ok {
 					continue
 				}
-			case req := <-consumer:
+				req.Done = done
 				ch <- req
 			}
 		}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	"github.com/nsqio/go-diskqueue"
+)
+
+const (
+	defaultInboxClass = "default"
+	// inboxStride pass of a class advances by inboxStride/weight each time one of its requests is handed to worker
+	inboxStride      = 1 << 20
+	inboxQueueSuffix = ".diskqueue.meta.dat"
+	// inboxReadAhead requests read ahead from each queue, so classes don't miss their turns while queue is being read
+	inboxReadAhead = 8
+)
+
+// inboxPriorities in the order queues are served
+var inboxPriorities = []coreRPC.Priority{coreRPC.PriorityHigh, coreRPC.PriorityNormal, coreRPC.PriorityLow}
+
+var queueNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// QueueFactory opens diskqueue of name, it's called for each class and priority of inbox
+type QueueFactory func(name string) diskqueue.Interface
+
+type inboxQueue struct {
+	diskqueue.Interface
+	// head requests read ahead from queue, only dispatcher takes from it
+	head chan []byte
+}
+
+// inboxClass services sharing queues, classes are scheduled by stride scheduling: the class of lowest pass goes next
+type inboxClass struct {
+	name        string
+	weight      int
+	stride      uint64
+	pass        uint64
+	maxInFlight int
+	queues      map[coreRPC.Priority]*inboxQueue
+}
+
+// safeQueueName names of classes and nodes are used in queue file names
+func safeQueueName(name string) string {
+	return queueNameUnsafe.ReplaceAllString(name, "_")
+}
+
+// inboxQueueName default class of normal priority keeps using the original "inbox" queue
+func inboxQueueName(class string, priority coreRPC.Priority) string {
+	name := "inbox"
+	if class != defaultInboxClass {
+		name += "." + class
+	}
+	switch priority {
+	case coreRPC.PriorityHigh:
+		name += "@high"
+	case coreRPC.PriorityLow:
+		name += "@low"
+	}
+	return name
+}
+
+// parseInboxQueueName reverse of inboxQueueName
+func parseInboxQueueName(name string) (string, coreRPC.Priority, bool) {
+	priority := coreRPC.PriorityNormal
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		switch name[i+1:] {
+		case "high":
+			priority = coreRPC.PriorityHigh
+		case "low":
+			priority = coreRPC.PriorityLow
+		default:
+			return "", 0, false
+		}
+		name = name[:i]
+	}
+	if name == "inbox" {
+		return defaultInboxClass, priority, true
+	}
+	if !strings.HasPrefix(name, "inbox.") {
+		return "", 0, false
+	}
+	return name[len("inbox."):], priority, true
+}
+
+func normalizePriority(priority coreRPC.Priority) coreRPC.Priority {
+	switch {
+	case priority > coreRPC.PriorityNormal:
+		return coreRPC.PriorityHigh
+	case priority < coreRPC.PriorityNormal:
+		return coreRPC.PriorityLow
+	}
+	return coreRPC.PriorityNormal
+}
+
+// classOf class requests of service are queued in
+func (inbox *Inbox) classOf(name string) string {
+	if class, ok := inbox.serviceClasses[name]; ok {
+		return class
+	}
+	if inbox.config.PerService {
+		return safeQueueName(name)
+	}
+	return defaultInboxClass
+}
+
+// class gets or creates class, inbox must be locked
+func (inbox *Inbox) class(name string) *inboxClass {
+	if class, ok := inbox.classes[name]; ok {
+		return class
+	}
+	weight := inbox.config.DefaultWeight
+	maxInFlight := 0
+	for _, c := range inbox.config.Classes {
+		if safeQueueName(c.Name) == name {
+			weight = c.Weight
+			maxInFlight = c.MaxInFlight
+		}
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	class := &inboxClass{
+		name:        name,
+		weight:      weight,
+		stride:      uint64(inboxStride / weight),
+		pass:        inbox.vtime,
+		maxInFlight: maxInFlight,
+		queues:      map[coreRPC.Priority]*inboxQueue{},
+	}
+	inbox.classes[name] = class
+	return class
+}
+
+// queue gets or opens queue of class and priority, it's read once inbox is started
+func (inbox *Inbox) queue(className string, priority coreRPC.Priority) *inboxQueue {
+	inbox.Lock()
+	defer inbox.Unlock()
+	class := inbox.class(className)
+	if q, ok := class.queues[priority]; ok {
+		return q
+	}
+	q := &inboxQueue{
+		Interface: inbox.newQueue(inboxQueueName(className, priority)),
+		head:      make(chan []byte, inboxReadAhead),
+	}
+	class.queues[priority] = q
+	if inbox.ctx != nil {
+		go inbox.read(inbox.ctx, q)
+	}
+	return q
+}
+
+// openQueues opens queues left by previous runs, so requests of services not called since then are still handled
+func (inbox *Inbox) openQueues() error {
+	files, err := filepath.Glob(filepath.Join(inbox.dir, "inbox*"+inboxQueueSuffix))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), inboxQueueSuffix)
+		class, priority, ok := parseInboxQueueName(name)
+		if ok {
+			inbox.bytes.Add(queueBytes(inbox.dir, name))
+			inbox.queue(class, priority)
+		}
+	}
+	return nil
+}
+
+// queueBytes estimates size of messages left in diskqueue from its metadata and files
+func queueBytes(dir, name string) int64 {
+	f, err := os.Open(filepath.Join(dir, name+inboxQueueSuffix))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	var depth, readFileNum, readPos, writeFileNum, writePos int64
+	if _, err := fmt.Fscanf(f, "%d\n%d,%d\n%d,%d\n", &depth, &readFileNum, &readPos, &writeFileNum, &writePos); err != nil {
+		return 0
+	}
+	size := writePos - readPos
+	for num := readFileNum; num < writeFileNum; num++ {
+		if info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%s.diskqueue.%06d.dat", name, num))); err == nil {
+			size += info.Size()
+		}
+	}
+	// each message is prefixed with its size
+	size -= depth * 4
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+// read keeps head of queue filled, data read ahead is put back if inbox stops
+func (inbox *Inbox) read(ctx context.Context, q *inboxQueue) {
+	defer func() {
+		for {
+			select {
+			case data := <-q.head:
+				_ = q.Put(data)
+			default:
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-q.ReadChan():
+			select {
+			case q.head <- data:
+				inbox.notify()
+			case <-ctx.Done():
+				_ = q.Put(data)
+				return
+			}
+		}
+	}
+}
+
+// notify wakes up dispatcher
+func (inbox *Inbox) notify() {
+	select {
+	case inbox.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes request of the highest priority waiting, classes of the same priority are chosen by their weights.
+// Classes having max in-flight requests are skipped.
+func (inbox *Inbox) next() ([]byte, string, bool) {
+	inbox.Lock()
+	defer inbox.Unlock()
+	for _, priority := range inboxPriorities {
+		var picked *inboxClass
+		for _, class := range inbox.classes {
+			q := class.queues[priority]
+			if q == nil || len(q.head) == 0 || !inbox.hasCapacity(class) {
+				continue
+			}
+			if picked == nil || class.pass < picked.pass || (class.pass == picked.pass && class.name < picked.name) {
+				picked = class
+			}
+		}
+		if picked == nil {
+			continue
+		}
+		var data []byte
+		select {
+		case data = <-picked.queues[priority].head:
+		default:
+			// put back by reader as inbox stops
+			return nil, "", false
+		}
+		inbox.bytes.Sub(int64(len(data)))
+		// classes idle for a while don't get to catch up
+		if picked.pass < inbox.vtime {
+			picked.pass = inbox.vtime
+		}
+		inbox.vtime = picked.pass
+		picked.pass += picked.stride
+		return data, picked.name, true
+	}
+	return nil, "", false
+}
+
+func (inbox *Inbox) hasCapacity(class *inboxClass) bool {
+	if class.maxInFlight <= 0 {
+		return true
+	}
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	return inbox.inFlight[class.name] < class.maxInFlight
+}
+
+// Depth number of requests waiting in every queue
+func (inbox *Inbox) Depth() int64 {
+	inbox.Lock()
+	defer inbox.Unlock()
+	var depth int64
+	for _, class := range inbox.classes {
+		for _, q := range class.queues {
+			depth += q.Depth() + int64(len(q.head))
+		}
+	}
+	return depth
+}
+
+// describe depth of each priority and in-flight requests of every class, preceded by totals
+func (inbox *Inbox) describe() string {
+	total := fmt.Sprintf("inbox: depth=%d bytes=%d age=%s", inbox.Depth(), inbox.Bytes(), inbox.Age().Round(time.Millisecond))
+	if err := inbox.Admit(); err != nil {
+		total += " rejecting"
+	}
+	inbox.Lock()
+	defer inbox.Unlock()
+	inbox.runningMu.Lock()
+	defer inbox.runningMu.Unlock()
+	lines := make([]string, 0, len(inbox.classes))
+	for _, class := range inbox.classes {
+		var depths [3]int64
+		for i, priority := range inboxPriorities {
+			if q := class.queues[priority]; q != nil {
+				depths[i] = q.Depth() + int64(len(q.head))
+			}
+		}
+		inFlight := fmt.Sprintf("%d", inbox.inFlight[class.name])
+		if class.maxInFlight > 0 {
+			inFlight += fmt.Sprintf("/%d", class.maxInFlight)
+		}
+		lines = append(lines, fmt.Sprintf("%s: weight=%d high=%d normal=%d low=%d in_flight=%s", class.name, class.weight, depths[0], depths[1], depths[2], inFlight))
+	}
+	sort.Strings(lines)
+	return strings.Join(append([]string{total}, lines...), "\n")
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	"github.com/joesonw/drlee/pkg/utils"
+	diskqueue "github.com/nsqio/go-diskqueue"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// memoryQueue diskqueue kept in memory
+type memoryQueue struct {
+	diskqueue.Interface
+	ch chan []byte
+}
+
+func newMemoryQueue(string) diskqueue.Interface {
+	return &memoryQueue{ch: make(chan []byte, 1024)}
+}
+
+func (q *memoryQueue) Put(b []byte) error {
+	q.ch <- b
+	return nil
+}
+
+func (q *memoryQueue) ReadChan() <-chan []byte {
+	return q.ch
+}
+
+func (q *memoryQueue) Depth() int64 {
+	return int64(len(q.ch))
+}
+
+// readAhead starts reading queues of inbox, it returns once head of each queue is filled
+func readAhead(ctx context.Context, inbox *Inbox) {
+	inbox.Lock()
+	var queues []*inboxQueue
+	for _, class := range inbox.classes {
+		for _, q := range class.queues {
+			queues = append(queues, q)
+			go inbox.read(ctx, q)
+		}
+	}
+	inbox.Unlock()
+	for _, q := range queues {
+		q := q
+		Eventually(func() bool {
+			return len(q.head) == inboxReadAhead || q.Depth() == 0
+		}).Should(BeTrue())
+	}
+}
+
+// nextName name of request dispatcher would take next, empty if none
+func nextName(inbox *Inbox) string {
+	data, _, ok := inbox.next()
+	if !ok {
+		return ""
+	}
+	req := &RPCRequest{}
+	Expect(utils.UnmarshalGOB(data, req)).To(Succeed())
+	return req.Name
+}
+
+var _ = Describe("Inbox", func() {
+	Describe("Cancel", func() {
+		var inbox *Inbox
+
+		BeforeEach(func() {
+			inbox = newInbox(InboxConfig{}, "", nil, nil, nil)
+		})
+
+		It("should only let node request came from cancel it", func() {
+			done, ok := inbox.start("1", "a", time.Time{})
+			Expect(ok).To(BeTrue())
+
+			Expect(inbox.Cancel("1", "b")).NotTo(Succeed())
+			Expect(inbox.Running("1")).To(BeTrue())
+			Consistently(done, "10ms").ShouldNot(BeClosed())
+
+			Expect(inbox.Cancel("1", "a")).To(Succeed())
+			Expect(inbox.Running("1")).To(BeFalse())
+			Expect(done).To(BeClosed())
+		})
+
+		It("should only drop requests not yet handed if cancelled by node they came from", func() {
+			Expect(inbox.Cancel("1", "b")).To(Succeed())
+			_, ok := inbox.start("1", "a", time.Time{})
+			Expect(ok).To(BeTrue())
+
+			Expect(inbox.Cancel("2", "a")).To(Succeed())
+			_, ok = inbox.start("2", "a", time.Time{})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should keep loopback requests to local node", func() {
+			_, ok := inbox.start("1", "", time.Time{})
+			Expect(ok).To(BeTrue())
+			Expect(inbox.Cancel("1", "a")).NotTo(Succeed())
+			Expect(inbox.Cancel("1", "")).To(Succeed())
+		})
+	})
+
+	Describe("scheduling", func() {
+		var ctx context.Context
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		newScheduledInbox := func(classes ...InboxClassConfig) *Inbox {
+			return newInbox(InboxConfig{Classes: classes}, "", newMemoryQueue, nil, nil)
+		}
+
+		put := func(inbox *Inbox, name string, priority coreRPC.Priority, count int) {
+			for i := 0; i < count; i++ {
+				Expect(inbox.Put(&RPCRequest{ID: name, Name: name, Priority: priority, Timestamp: time.Now()})).To(Succeed())
+			}
+		}
+
+		It("should share workers among classes by their weights", func() {
+			inbox := newScheduledInbox(
+				InboxClassConfig{Name: "a", Services: []string{"a"}, Weight: 1},
+				InboxClassConfig{Name: "b", Services: []string{"b"}, Weight: 3},
+			)
+			put(inbox, "a", coreRPC.PriorityNormal, 20)
+			put(inbox, "b", coreRPC.PriorityNormal, 20)
+			readAhead(ctx, inbox)
+
+			counts := map[string]int{}
+			for i := 0; i < 8; i++ {
+				counts[nextName(inbox)]++
+			}
+			Expect(counts).To(Equal(map[string]int{"a": 2, "b": 6}))
+		})
+
+		It("should hand requests of higher priority first within a class", func() {
+			inbox := newScheduledInbox()
+			put(inbox, "low", coreRPC.PriorityLow, 1)
+			put(inbox, "normal", coreRPC.PriorityNormal, 1)
+			put(inbox, "high", coreRPC.PriorityHigh, 1)
+			readAhead(ctx, inbox)
+
+			Expect(nextName(inbox)).To(Equal("high"))
+			Expect(nextName(inbox)).To(Equal("normal"))
+			Expect(nextName(inbox)).To(Equal("low"))
+			Expect(nextName(inbox)).To(Equal(""))
+		})
+
+		It("should skip classes having max in-flight requests until one is done", func() {
+			inbox := newScheduledInbox(
+				InboxClassConfig{Name: "a", Services: []string{"a"}, MaxInFlight: 1},
+				InboxClassConfig{Name: "b", Services: []string{"b"}},
+			)
+			put(inbox, "a", coreRPC.PriorityNormal, 2)
+			put(inbox, "b", coreRPC.PriorityNormal, 2)
+			readAhead(ctx, inbox)
+
+			Expect(nextName(inbox)).To(Equal("a"))
+			inbox.reserve("a1", "a")
+			Expect(nextName(inbox)).To(Equal("b"))
+			Expect(nextName(inbox)).To(Equal("b"))
+			Expect(nextName(inbox)).To(Equal(""))
+
+			Expect(inbox.Done("a1")).To(BeFalse())
+			Expect(nextName(inbox)).To(Equal("a"))
+		})
+	})
+
+	Describe("sweep", func() {
+		It("should release requests whose callers have given up", func() {
+			inbox := newInbox(InboxConfig{}, "", nil, nil, nil)
+			inbox.reserve("1", "a")
+			done, ok := inbox.start("1", "node", time.Now().Add(-time.Second))
+			Expect(ok).To(BeTrue())
+			_, ok = inbox.start("2", "node", time.Now().Add(time.Minute))
+			Expect(ok).To(BeTrue())
+
+			Expect(inbox.sweep(time.Now())).To(Equal([]*inboxOverdue{{id: "1", nodeName: "node", expired: true}}))
+			Expect(done).To(BeClosed())
+			Expect(inbox.Running("1")).To(BeFalse())
+			Expect(inbox.inFlight["a"]).To(Equal(0))
+			Expect(inbox.Running("2")).To(BeTrue())
+		})
+
+		It("should give up requests handed to workers longer than handle timeout ago", func() {
+			inbox := newInbox(InboxConfig{HandleTimeout: time.Minute}, "", nil, nil, nil)
+			inbox.reserve("1", "a")
+			_, ok := inbox.start("1", "", time.Time{})
+			Expect(ok).To(BeTrue())
+			// actor messages are left to actors
+			_, ok = inbox.start("2", "", time.Time{})
+			Expect(ok).To(BeTrue())
+
+			Expect(inbox.sweep(time.Now())).To(BeEmpty())
+			Expect(inbox.sweep(time.Now().Add(time.Minute * 2))).To(Equal([]*inboxOverdue{{id: "1"}}))
+			Expect(inbox.inFlight["a"]).To(Equal(0))
+			Expect(inbox.Running("2")).To(BeTrue())
+			// late reply is dropped
+			Expect(inbox.Done("1")).To(BeFalse())
+		})
+	})
+})
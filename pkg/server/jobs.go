@@ -0,0 +1,893 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	coreJobs "github.com/joesonw/drlee/pkg/core/jobs"
+	"github.com/joesonw/drlee/pkg/utils"
+	"github.com/joesonw/drlee/proto"
+	"github.com/nsqio/go-diskqueue"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultJobVisibilityTimeout = time.Second * 30
+	defaultJobRetries           = 3
+	defaultJobBackoff           = time.Second
+	defaultJobMaxBackoff        = time.Minute * 10
+	// jobForwardRetryInterval forwarding jobs of a queue is retried after this long if it failed
+	jobForwardRetryInterval = time.Second
+	jobForwardTimeout       = time.Second * 10
+	// jobConsumerSize jobs handed to a worker but not yet taken by it
+	jobConsumerSize = 64
+)
+
+var _ memberlist.Broadcast = &JobQueueBroadcast{}
+
+func (b JobQueueBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*JobQueueBroadcast); ok && o.NodeName == b.NodeName && o.Queue == b.Queue {
+		return o.Timestamp.After(b.Timestamp)
+	}
+	return false
+}
+
+func (b JobQueueBroadcast) Finished() {}
+
+// scheduledJob job waiting until due, it's kept in its own file so that it survives restarts. Jobs leased to workers
+// are redelivered once due, others are put back into their queues.
+type scheduledJob struct {
+	path    string
+	job     *coreJobs.Job
+	due     time.Time
+	leased  bool
+	worker  int
+	removed bool
+}
+
+// scheduledJobFile content of file of scheduled job
+type scheduledJobFile struct {
+	Job    *coreJobs.Job
+	Due    time.Time
+	Leased bool
+}
+
+type jobHeap []*scheduledJob
+
+func (h jobHeap) Len() int { return len(h) }
+func (h jobHeap) Less(i, j int) bool {
+	return h[i].due.Before(h[j].due)
+}
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x interface{}) {
+	*h = append(*h, x.(*scheduledJob))
+}
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+type jobQueue struct {
+	diskqueue.Interface
+	name string
+	wake chan struct{}
+}
+
+type jobStats struct {
+	acked       int64
+	retried     int64
+	redelivered int64
+	failed      int64
+	forwarded   int64
+}
+
+// Jobs background jobs of local node. Jobs wait in a diskqueue per queue until a local worker processing the queue is
+// free, or they are forwarded to another node processing it. Jobs handed to workers are leased until acked, unacked
+// ones are redelivered once visibility timeout has passed. Jobs failed after every retry are recorded as dead letters.
+type Jobs struct {
+	mu       *sync.Mutex
+	config   JobsConfig
+	dir      string
+	newQueue QueueFactory
+	queues   map[string]*jobQueue
+	ctx      context.Context
+	// scheduled delayed jobs, jobs waiting for retry and jobs leased to workers, persisted under scheduleDir
+	scheduleDir string
+	scheduled   jobHeap
+	leases      map[string]*scheduledJob
+	wake        chan struct{}
+	consumers   map[int]chan *coreJobs.Job
+	// processors concurrency of local workers processing each queue, running jobs handed to each of them
+	processors map[string]map[int]int
+	running    map[string]map[int]int
+	// remote nodes processing each queue
+	remote      map[string]map[string]bool
+	stats       map[string]*jobStats
+	forward     func(ctx context.Context, nodeName string, job *coreJobs.Job) error
+	deadLetters *DeadLetters
+	logger      *zap.Logger
+}
+
+func newJobs(config JobsConfig, dir string, newQueue QueueFactory, forward func(ctx context.Context, nodeName string, job *coreJobs.Job) error, deadLetters *DeadLetters, logger *zap.Logger) *Jobs {
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaultJobVisibilityTimeout
+	}
+	if config.Retries <= 0 {
+		config.Retries = defaultJobRetries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultJobBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultJobMaxBackoff
+	}
+	return &Jobs{
+		mu:          &sync.Mutex{},
+		config:      config,
+		dir:         dir,
+		newQueue:    newQueue,
+		queues:      map[string]*jobQueue{},
+		scheduleDir: filepath.Join(dir, "jobs"),
+		leases:      map[string]*scheduledJob{},
+		wake:        make(chan struct{}, 1),
+		consumers:   map[int]chan *coreJobs.Job{},
+		processors:  map[string]map[int]int{},
+		running:     map[string]map[int]int{},
+		remote:      map[string]map[string]bool{},
+		stats:       map[string]*jobStats{},
+		forward:     forward,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+}
+
+// Enqueue persists job, delayed jobs are scheduled until they are due
+func (j *Jobs) Enqueue(job *coreJobs.Job) error {
+	if job.ID == "" {
+		job.ID = uuid.NewV4().String()
+	}
+	if job.EnqueuedAt.IsZero() {
+		job.EnqueuedAt = time.Now()
+	}
+	if job.Retries < 0 {
+		job.Retries = j.config.Retries
+	}
+	if job.Backoff <= 0 {
+		job.Backoff = j.config.Backoff
+	}
+	if job.DeliverAt.After(time.Now()) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		return j.schedule(job, job.DeliverAt, false, -1)
+	}
+	return j.put(job)
+}
+
+func (j *Jobs) put(job *coreJobs.Job) error {
+	b, err := utils.MarshalGOB(job)
+	if err != nil {
+		return err
+	}
+	return j.queue(job.Queue).Put(b)
+}
+
+// queue gets or opens queue of name, it's dispatched once jobs are started
+func (j *Jobs) queue(name string) *jobQueue {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.openQueue(safeQueueName(name))
+}
+
+// openQueue jobs must be locked
+func (j *Jobs) openQueue(name string) *jobQueue {
+	if q, ok := j.queues[name]; ok {
+		return q
+	}
+	q := &jobQueue{
+		Interface: j.newQueue("jobs." + name),
+		name:      name,
+		wake:      make(chan struct{}, 1),
+	}
+	j.queues[name] = q
+	if j.ctx != nil {
+		go j.dispatch(j.ctx, q)
+	}
+	return q
+}
+
+// Start loads scheduled jobs, opens queues left by previous runs and starts dispatching them
+func (j *Jobs) Start(ctx context.Context) error {
+	if err := j.load(); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(j.dir, "jobs.*"+inboxQueueSuffix))
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	for _, file := range files {
+		j.openQueue(strings.TrimPrefix(strings.TrimSuffix(filepath.Base(file), inboxQueueSuffix), "jobs."))
+	}
+	j.ctx = ctx
+	for _, q := range j.queues {
+		go j.dispatch(ctx, q)
+	}
+	j.mu.Unlock()
+	go j.runSchedule(ctx)
+	return nil
+}
+
+// load reads scheduled jobs persisted, leases of previous runs are redelivered once their visibility timeout passes
+func (j *Jobs) load() error {
+	if err := os.MkdirAll(j.scheduleDir, 0700); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(j.scheduleDir)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".gob") {
+			continue
+		}
+		path := filepath.Join(j.scheduleDir, file.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content := &scheduledJobFile{}
+		if err := utils.UnmarshalGOB(b, content); err != nil {
+			j.logger.Error(fmt.Sprintf("unable to load scheduled job %s, removing", path), zap.Error(err))
+			_ = os.Remove(path)
+			continue
+		}
+		item := &scheduledJob{path: path, job: content.Job, due: content.Due, leased: content.Leased, worker: -1}
+		if item.leased {
+			j.leases[item.job.Lease] = item
+		}
+		heap.Push(&j.scheduled, item)
+	}
+	return nil
+}
+
+// schedule persists job until due, leased jobs are redelivered then. Jobs must be locked
+func (j *Jobs) schedule(job *coreJobs.Job, due time.Time, leased bool, worker int) error {
+	path := filepath.Join(j.scheduleDir, fmt.Sprintf("%s-%s.gob", job.ID, uuid.NewV4().String()))
+	if err := writeScheduledJob(path, job, due, leased); err != nil {
+		return err
+	}
+	item := &scheduledJob{path: path, job: job, due: due, leased: leased, worker: worker}
+	if leased {
+		j.leases[job.Lease] = item
+	}
+	heap.Push(&j.scheduled, item)
+	j.notify()
+	return nil
+}
+
+// writeScheduledJob persists scheduled job to path, file is replaced as a whole
+func writeScheduledJob(path string, job *coreJobs.Job, due time.Time, leased bool) error {
+	b, err := utils.MarshalGOB(&scheduledJobFile{Job: job, Due: due, Leased: leased})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// unlease takes back job leased to worker, it's redelivered right away without counting as attempt. Jobs must be
+// locked, scheduled jobs must be reordered afterwards.
+func (j *Jobs) unlease(item *scheduledJob) {
+	item.job.Attempt--
+	item.due = time.Now()
+	item.leased = false
+	delete(j.leases, item.job.Lease)
+	if err := writeScheduledJob(item.path, item.job, item.due, false); err != nil {
+		j.logger.Error(fmt.Sprintf("unable to take back lease of job [%s], it's redelivered once visibility timeout passes after restart", item.job.ID), zap.Error(err))
+	}
+}
+
+// notify wakes up scheduler
+func (j *Jobs) notify() {
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// unschedule removes scheduled job, it's skipped once due. Jobs must be locked
+func (j *Jobs) unschedule(item *scheduledJob) {
+	item.removed = true
+	if item.leased {
+		delete(j.leases, item.job.Lease)
+		j.release(item)
+	}
+	if err := os.Remove(item.path); err != nil && !os.IsNotExist(err) {
+		j.logger.Error(fmt.Sprintf("unable to remove scheduled job %s", item.path), zap.Error(err))
+	}
+}
+
+// release frees slot of worker job was leased to. Jobs must be locked
+func (j *Jobs) release(item *scheduledJob) {
+	name := safeQueueName(item.job.Queue)
+	if running, ok := j.running[name]; ok && item.worker >= 0 && running[item.worker] > 0 {
+		running[item.worker]--
+	}
+	item.worker = -1
+	if q, ok := j.queues[name]; ok {
+		notifyJobQueue(q)
+	}
+}
+
+func notifyJobQueue(q *jobQueue) {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due pops next scheduled job if it's due, otherwise returns how long until it is. Returns true if job was leased and
+// it has run out of retries.
+func (j *Jobs) due() (*coreJobs.Job, bool, time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for len(j.scheduled) > 0 && j.scheduled[0].removed {
+		heap.Pop(&j.scheduled)
+	}
+	if len(j.scheduled) == 0 {
+		return nil, false, time.Hour
+	}
+	if wait := time.Until(j.scheduled[0].due); wait > 0 {
+		return nil, false, wait
+	}
+	item := heap.Pop(&j.scheduled).(*scheduledJob)
+	var isExhausted bool
+	if item.leased {
+		// worker didn't ack within visibility timeout
+		item.job.Error = "visibility timeout"
+		isExhausted = item.job.Attempt > item.job.Retries
+		j.stat(item.job.Queue, func(stats *jobStats) {
+			stats.redelivered++
+		})
+	}
+	j.unschedule(item)
+	return item.job, isExhausted, 0
+}
+
+// runSchedule puts due jobs back into their queues, jobs failed to be put are retried later
+func (j *Jobs) runSchedule(ctx context.Context) {
+	for {
+		job, isExhausted, wait := j.due()
+		if job != nil {
+			if isExhausted {
+				j.fail(job)
+				continue
+			}
+			if err := j.put(job); err != nil {
+				j.logger.Error(fmt.Sprintf("unable to put scheduled job [%s] back into queue", job.ID), zap.Error(err))
+				j.mu.Lock()
+				if err := j.schedule(job, time.Now().Add(jobForwardRetryInterval), false, -1); err != nil {
+					j.logger.Error(fmt.Sprintf("unable to schedule job [%s], it's lost", job.ID), zap.Error(err))
+				}
+				j.mu.Unlock()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-j.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a free slot of local workers processing queue, returns false if there is none
+func (j *Jobs) reserve(name string) (int, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	workers := make([]int, 0, len(j.processors[name]))
+	for worker := range j.processors[name] {
+		workers = append(workers, worker)
+	}
+	sort.Ints(workers)
+	best := -1
+	for _, worker := range workers {
+		running := j.running[name][worker]
+		if running >= j.processors[name][worker] {
+			continue
+		}
+		if best < 0 || running < j.running[name][best] {
+			best = worker
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	if _, ok := j.running[name]; !ok {
+		j.running[name] = map[int]int{}
+	}
+	j.running[name][best]++
+	return best, true
+}
+
+func (j *Jobs) unreserve(name string, worker int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if running, ok := j.running[name]; ok && running[worker] > 0 {
+		running[worker]--
+	}
+}
+
+// pickNode picks a remote node processing queue, empty if there is none
+func (j *Jobs) pickNode(name string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	nodes := make([]string, 0, len(j.remote[name]))
+	for nodeName := range j.remote[name] {
+		nodes = append(nodes, nodeName)
+	}
+	if len(nodes) == 0 {
+		return ""
+	}
+	//nolint:gosec
+	return nodes[rand.Intn(len(nodes))]
+}
+
+// dispatch hands jobs of queue to free local workers processing it, or forwards them to other nodes processing it
+// if there is no local one
+func (j *Jobs) dispatch(ctx context.Context, q *jobQueue) {
+	for {
+		worker, isLocal := j.reserve(q.name)
+		var nodeName string
+		if !isLocal {
+			j.mu.Lock()
+			hasProcessors := len(j.processors[q.name]) > 0
+			j.mu.Unlock()
+			if !hasProcessors {
+				nodeName = j.pickNode(q.name)
+			}
+			if nodeName == "" {
+				select {
+				case <-ctx.Done():
+					return
+				case <-q.wake:
+				}
+				continue
+			}
+		}
+
+		var data []byte
+		select {
+		case <-ctx.Done():
+			if isLocal {
+				j.unreserve(q.name, worker)
+			}
+			return
+		case <-q.wake:
+			if isLocal {
+				j.unreserve(q.name, worker)
+			}
+			continue
+		case data = <-q.ReadChan():
+		}
+
+		job := &coreJobs.Job{}
+		if err := utils.UnmarshalGOB(data, job); err != nil {
+			if isLocal {
+				j.unreserve(q.name, worker)
+			}
+			j.deadLetters.Record(&DeadLetter{
+				Reason:  DeadLetterDecodeError,
+				Error:   err.Error(),
+				Kind:    DeadLetterJob,
+				Payload: data,
+			})
+			continue
+		}
+		if isLocal {
+			j.deliver(worker, job)
+			continue
+		}
+
+		fctx, cancel := context.WithTimeout(ctx, jobForwardTimeout)
+		err := j.forward(fctx, nodeName, job)
+		cancel()
+		if err == nil {
+			j.stat(job.Queue, func(stats *jobStats) {
+				stats.forwarded++
+			})
+			continue
+		}
+		j.logger.Sugar().Debugf("unable to forward job [%s] of queue \"%s\" to node %s: %s", job.ID, job.Queue, nodeName, err)
+		if err := q.Put(data); err != nil {
+			j.logger.Error(fmt.Sprintf("unable to put job [%s] back into queue", job.ID), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobForwardRetryInterval):
+		}
+	}
+}
+
+// deliver leases job to worker and hands it over, it's put back if worker is gone or busy
+func (j *Jobs) deliver(worker int, job *coreJobs.Job) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.Attempt++
+	job.Lease = uuid.NewV4().String()
+	if err := j.schedule(job, time.Now().Add(j.config.VisibilityTimeout), true, worker); err != nil {
+		j.logger.Error(fmt.Sprintf("unable to lease job [%s]", job.ID), zap.Error(err))
+		job.Attempt--
+		if running, ok := j.running[safeQueueName(job.Queue)]; ok && running[worker] > 0 {
+			running[worker]--
+		}
+		if err := j.schedule(job, time.Now().Add(jobForwardRetryInterval), false, -1); err != nil {
+			j.logger.Error(fmt.Sprintf("unable to schedule job [%s], it's lost", job.ID), zap.Error(err))
+		}
+		return
+	}
+	item := j.leases[job.Lease]
+	consumer, ok := j.consumers[worker]
+	if ok {
+		select {
+		case consumer <- job:
+			return
+		default:
+		}
+	}
+	j.unlease(item)
+	j.release(item)
+	heap.Init(&j.scheduled)
+	j.notify()
+}
+
+// Ack removes job handled, acks of leases already expired are ignored
+func (j *Jobs) Ack(job *coreJobs.Job) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	item, ok := j.leases[job.Lease]
+	if !ok {
+		j.logger.Sugar().Debugf("ignored ack of job [%s], its lease has expired", job.ID)
+		return
+	}
+	j.unschedule(item)
+	j.stat(job.Queue, func(stats *jobStats) {
+		stats.acked++
+	})
+}
+
+// Fail retries job after backoff, jobs out of retries are recorded as dead letters
+func (j *Jobs) Fail(job *coreJobs.Job, err error) {
+	j.mu.Lock()
+	item, ok := j.leases[job.Lease]
+	if !ok {
+		j.mu.Unlock()
+		j.logger.Sugar().Debugf("ignored failure of job [%s], its lease has expired", job.ID)
+		return
+	}
+	j.unschedule(item)
+	job.Error = err.Error()
+	if job.Attempt > job.Retries {
+		j.mu.Unlock()
+		j.fail(job)
+		return
+	}
+	defer j.mu.Unlock()
+	j.stat(job.Queue, func(stats *jobStats) {
+		stats.retried++
+	})
+	if err := j.schedule(job, time.Now().Add(j.backoff(job)), false, -1); err != nil {
+		j.logger.Error(fmt.Sprintf("unable to schedule retry of job [%s]", job.ID), zap.Error(err))
+	}
+}
+
+// fail records job out of retries
+func (j *Jobs) fail(job *coreJobs.Job) {
+	j.mu.Lock()
+	j.stat(job.Queue, func(stats *jobStats) {
+		stats.failed++
+	})
+	j.mu.Unlock()
+	j.deadLetters.RecordJob(job, DeadLetterRetriesExhausted)
+}
+
+func (j *Jobs) backoff(job *coreJobs.Job) time.Duration {
+	backoff := job.Backoff << uint(job.Attempt-1)
+	if backoff > j.config.MaxBackoff || backoff <= 0 {
+		backoff = j.config.MaxBackoff
+	}
+	return backoff
+}
+
+// stat updates stats of queue. Jobs must be locked
+func (j *Jobs) stat(queue string, fn func(stats *jobStats)) {
+	name := safeQueueName(queue)
+	stats, ok := j.stats[name]
+	if !ok {
+		stats = &jobStats{}
+		j.stats[name] = stats
+	}
+	fn(stats)
+}
+
+func (j *Jobs) NewConsumer(id int) <-chan *coreJobs.Job {
+	ch := make(chan *coreJobs.Job, jobConsumerSize)
+	j.mu.Lock()
+	j.consumers[id] = ch
+	j.mu.Unlock()
+	return ch
+}
+
+// Process worker processes queue with concurrency, returns true if it's the first local worker processing it
+func (j *Jobs) Process(id int, queue string, concurrency int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	name := safeQueueName(queue)
+	workers, ok := j.processors[name]
+	if !ok {
+		workers = map[int]int{}
+		j.processors[name] = workers
+	}
+	workers[id] = concurrency
+	notifyJobQueue(j.openQueue(name))
+	return !ok
+}
+
+// Reset stops handing jobs to workers, jobs leased to them are redelivered right away. Returns queues that were
+// processed.
+func (j *Jobs) Reset() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, ch := range j.consumers {
+		close(ch)
+	}
+	j.consumers = map[int]chan *coreJobs.Job{}
+	queues := make([]string, 0, len(j.processors))
+	for name := range j.processors {
+		queues = append(queues, name)
+	}
+	j.processors = map[string]map[int]int{}
+	j.running = map[string]map[int]int{}
+	for _, item := range j.leases {
+		item.worker = -1
+		j.unlease(item)
+	}
+	heap.Init(&j.scheduled)
+	j.notify()
+	return queues
+}
+
+// Queues queues processed by local workers
+func (j *Jobs) Queues() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	queues := make([]string, 0, len(j.processors))
+	for name := range j.processors {
+		queues = append(queues, name)
+	}
+	return queues
+}
+
+// SetRemote records whether node processes queue
+func (j *Jobs) SetRemote(nodeName, queue string, isProcessing bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	name := safeQueueName(queue)
+	if q, ok := j.queues[name]; ok {
+		defer notifyJobQueue(q)
+	}
+	if !isProcessing {
+		delete(j.remote[name], nodeName)
+		if len(j.remote[name]) == 0 {
+			delete(j.remote, name)
+		}
+		return
+	}
+	if _, ok := j.remote[name]; !ok {
+		j.remote[name] = map[string]bool{}
+	}
+	j.remote[name][nodeName] = true
+}
+
+// RemoveNode forgets queues processed by node
+func (j *Jobs) RemoveNode(nodeName string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for name, nodes := range j.remote {
+		delete(nodes, nodeName)
+		if len(nodes) == 0 {
+			delete(j.remote, name)
+		}
+	}
+}
+
+// describe waiting, scheduled and leased jobs of every queue, along with workers and nodes processing it
+func (j *Jobs) describe() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	scheduled := map[string]int{}
+	leased := map[string]int{}
+	for _, item := range j.scheduled {
+		if item.removed {
+			continue
+		}
+		name := safeQueueName(item.job.Queue)
+		if item.leased {
+			leased[name]++
+		} else {
+			scheduled[name]++
+		}
+	}
+	names := map[string]bool{}
+	for name := range j.queues {
+		names[name] = true
+	}
+	for name := range j.remote {
+		names[name] = true
+	}
+	lines := make([]string, 0, len(names))
+	for name := range names {
+		var depth int64
+		if q, ok := j.queues[name]; ok {
+			depth = q.Depth()
+		}
+		var concurrency int
+		for _, n := range j.processors[name] {
+			concurrency += n
+		}
+		nodes := make([]string, 0, len(j.remote[name]))
+		for nodeName := range j.remote[name] {
+			nodes = append(nodes, nodeName)
+		}
+		sort.Strings(nodes)
+		stats, ok := j.stats[name]
+		if !ok {
+			stats = &jobStats{}
+		}
+		lines = append(lines, fmt.Sprintf("%s: waiting=%d scheduled=%d leased=%d workers=%d concurrency=%d nodes=[%s] acked=%d retried=%d redelivered=%d failed=%d forwarded=%d",
+			name, depth, scheduled[name], leased[name], len(j.processors[name]), concurrency, strings.Join(nodes, ","),
+			stats.acked, stats.retried, stats.redelivered, stats.failed, stats.forwarded))
+	}
+	if len(lines) == 0 {
+		return "no job queues"
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// handleJobQueueBroadcast records queues processed by peer
+func (s *Server) handleJobQueueBroadcast(broadcast *JobQueueBroadcast) {
+	if broadcast.NodeName == s.members.LocalNode().Name {
+		return
+	}
+	s.jobs.SetRemote(broadcast.NodeName, broadcast.Queue, !broadcast.IsDeleted)
+	if broadcast.IsDeleted {
+		s.logger.Sugar().Debugf("node %s stopped processing jobs of \"%s\"", broadcast.NodeName, broadcast.Queue)
+		return
+	}
+	s.logger.Sugar().Debugf("node %s processes jobs of \"%s\"", broadcast.NodeName, broadcast.Queue)
+}
+
+func (s *Server) broadcastJobQueue(queue string, isDeleted bool) {
+	s.broadcasts.QueueBroadcast(&JobQueueBroadcast{
+		NodeName:  s.members.LocalNode().Name,
+		Timestamp: time.Now(),
+		Queue:     queue,
+		IsDeleted: isDeleted,
+	})
+}
+
+// localJobQueues queues processed by local node, sent along with local state
+func (s *Server) localJobQueues() []*JobQueueBroadcast {
+	nodeName := s.members.LocalNode().Name
+	var list []*JobQueueBroadcast
+	for _, queue := range s.jobs.Queues() {
+		list = append(list, &JobQueueBroadcast{
+			NodeName:  nodeName,
+			Timestamp: time.Now(),
+			Queue:     queue,
+		})
+	}
+	return list
+}
+
+// forwardJob hands job over to node processing its queue, it's persisted there once this returns
+func (s *Server) forwardJob(ctx context.Context, nodeName string, job *coreJobs.Job) error {
+	rpc := s.getRemoteRPC(nodeName)
+	if rpc == nil {
+		return status.Errorf(codes.Unavailable, "remote \"%s\": not found", nodeName)
+	}
+	_, err := rpc.RPCEnqueueJob(ctx, &proto.EnqueueJobRequest{
+		ID:                  job.ID,
+		Queue:               job.Queue,
+		Payload:             job.Payload,
+		Codec:               job.Codec,
+		Retries:             int32(job.Retries),
+		BackoffMilliseconds: job.Backoff.Milliseconds(),
+		DeliverAtUnixNano:   unixNano(job.DeliverAt),
+		Attempt:             int32(job.Attempt),
+		NodeName:            job.NodeName,
+		EnqueuedAtUnixNano:  unixNano(job.EnqueuedAt),
+		Error:               job.Error,
+	})
+	return err
+}
+
+func (s *Server) RPCEnqueueJob(ctx context.Context, req *proto.EnqueueJobRequest) (*proto.EnqueueJobResponse, error) {
+	err := s.jobs.Enqueue(&coreJobs.Job{
+		ID:         req.ID,
+		Queue:      req.Queue,
+		Payload:    req.Payload,
+		Codec:      req.Codec,
+		Retries:    int(req.Retries),
+		Backoff:    time.Millisecond * time.Duration(req.BackoffMilliseconds),
+		DeliverAt:  timeFromUnixNano(req.DeliverAtUnixNano),
+		Attempt:    int(req.Attempt),
+		NodeName:   req.NodeName,
+		EnqueuedAt: timeFromUnixNano(req.EnqueuedAtUnixNano),
+		Error:      req.Error,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proto.EnqueueJobResponse{}, nil
+}
+
+type luaJobsEnv struct {
+	server   *Server
+	id       int
+	consumer <-chan *coreJobs.Job
+	logger   *zap.Logger
+}
+
+func (env *luaJobsEnv) Enqueue(ctx context.Context, job *coreJobs.Job) error {
+	job.NodeName = env.server.members.LocalNode().Name
+	return env.server.jobs.Enqueue(job)
+}
+
+func (env *luaJobsEnv) Process(queue string, concurrency int) {
+	if env.server.jobs.Process(env.id, queue, concurrency) {
+		env.server.broadcastJobQueue(safeQueueName(queue), false)
+		env.logger.Info(fmt.Sprintf("processing jobs of \"%s\"", queue))
+	}
+}
+
+func (env *luaJobsEnv) ReadChan() <-chan *coreJobs.Job {
+	return env.consumer
+}
+
+func (env *luaJobsEnv) Build() *coreJobs.Env {
+	return &coreJobs.Env{
+		Enqueue:  env.Enqueue,
+		Process:  env.Process,
+		Ack:      env.server.jobs.Ack,
+		Fail:     env.server.jobs.Fail,
+		ReadChan: env.ReadChan,
+	}
+}
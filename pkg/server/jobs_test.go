@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	coreJobs "github.com/joesonw/drlee/pkg/core/jobs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Jobs", func() {
+	var dir string
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var letters *DeadLetters
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-jobs")
+		Expect(err).To(BeNil())
+		ctx, cancel = context.WithCancel(context.Background())
+		letters = newDeadLetters(filepath.Join(dir, "dead-letters"), nil, zap.NewNop())
+		Expect(letters.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(dir)
+	})
+
+	newTestJobs := func(config JobsConfig) *Jobs {
+		return newJobs(config, dir, newMemoryQueue, nil, letters, zap.NewNop())
+	}
+
+	// process starts jobs and a worker processing queue "test"
+	process := func(jobs *Jobs) <-chan *coreJobs.Job {
+		Expect(jobs.Start(ctx)).To(Succeed())
+		consumer := jobs.NewConsumer(1)
+		jobs.Process(1, "test", 1)
+		return consumer
+	}
+
+	It("should lease jobs to workers until they are acked", func() {
+		jobs := newTestJobs(JobsConfig{VisibilityTimeout: time.Millisecond * 100})
+		consumer := process(jobs)
+		Expect(jobs.Enqueue(&coreJobs.Job{Queue: "test"})).To(Succeed())
+
+		var job *coreJobs.Job
+		Eventually(consumer).Should(Receive(&job))
+		Expect(job.Attempt).To(Equal(1))
+		Expect(job.Lease).NotTo(BeEmpty())
+		jobs.Ack(job)
+
+		Consistently(consumer, "200ms").ShouldNot(Receive())
+		files, err := ioutil.ReadDir(filepath.Join(dir, "jobs"))
+		Expect(err).To(BeNil())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("should redeliver jobs not acked within visibility timeout", func() {
+		jobs := newTestJobs(JobsConfig{VisibilityTimeout: time.Millisecond * 100})
+		consumer := process(jobs)
+		Expect(jobs.Enqueue(&coreJobs.Job{Queue: "test", Retries: 1})).To(Succeed())
+
+		var first *coreJobs.Job
+		Eventually(consumer).Should(Receive(&first))
+		lease := first.Lease
+
+		var second *coreJobs.Job
+		Eventually(consumer).Should(Receive(&second))
+		Expect(second.ID).To(Equal(first.ID))
+		Expect(second.Attempt).To(Equal(2))
+		Expect(second.Error).To(Equal("visibility timeout"))
+		Expect(second.Lease).NotTo(Equal(lease))
+
+		// ack of expired lease doesn't ack the redelivery
+		jobs.Ack(&coreJobs.Job{ID: first.ID, Queue: "test", Lease: lease})
+		jobs.mu.Lock()
+		Expect(jobs.leases).To(HaveKey(second.Lease))
+		jobs.mu.Unlock()
+		jobs.Ack(second)
+		Consistently(consumer, "200ms").ShouldNot(Receive())
+	})
+
+	It("should record jobs out of retries as dead letters", func() {
+		jobs := newTestJobs(JobsConfig{Backoff: time.Millisecond})
+		consumer := process(jobs)
+		Expect(jobs.Enqueue(&coreJobs.Job{Queue: "test", Retries: 1})).To(Succeed())
+
+		for i := 1; i <= 2; i++ {
+			var job *coreJobs.Job
+			Eventually(consumer).Should(Receive(&job))
+			Expect(job.Attempt).To(Equal(i))
+			jobs.Fail(job, os.ErrInvalid)
+		}
+		Eventually(func() int {
+			list, _ := letters.List()
+			return len(list)
+		}).Should(Equal(1))
+		list, _ := letters.List()
+		Expect(list[0].Reason).To(Equal(DeadLetterRetriesExhausted))
+	})
+
+	It("should redeliver jobs right away once worker is back", func() {
+		jobs := newTestJobs(JobsConfig{VisibilityTimeout: time.Minute})
+		Expect(jobs.Start(ctx)).To(Succeed())
+		// worker hasn't started consuming
+		jobs.Process(1, "test", 1)
+		Expect(jobs.Enqueue(&coreJobs.Job{Queue: "test"})).To(Succeed())
+		time.Sleep(time.Millisecond * 50)
+
+		consumer := jobs.NewConsumer(1)
+		var job *coreJobs.Job
+		Eventually(consumer).Should(Receive(&job))
+		Expect(job.Attempt).To(Equal(1))
+	})
+
+	It("should take back leases of jobs on reset, even after restart", func() {
+		jobs := newTestJobs(JobsConfig{VisibilityTimeout: time.Minute})
+		Expect(jobs.load()).To(Succeed())
+		consumer := jobs.NewConsumer(1)
+		jobs.Process(1, "test", 1)
+		jobs.deliver(1, &coreJobs.Job{ID: "1", Queue: "test"})
+		Expect(consumer).To(Receive())
+		jobs.Reset()
+
+		// restarted before leases are redelivered
+		jobs = newTestJobs(JobsConfig{VisibilityTimeout: time.Minute})
+		consumer = process(jobs)
+		var job *coreJobs.Job
+		Eventually(consumer).Should(Receive(&job))
+		Expect(job.ID).To(Equal("1"))
+		Expect(job.Attempt).To(Equal(1))
+	})
+})
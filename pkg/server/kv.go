@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	coreKV "github.com/joesonw/drlee/pkg/core/kv"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultKVFlushInterval = time.Second
+	defaultKVTombstoneTTL  = time.Hour * 24
+	// maxKVValueSize keeps a single change within one gossip packet
+	maxKVValueSize = 1024
+)
+
+var _ memberlist.Broadcast = &KVBroadcast{}
+
+func (b KVBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*KVBroadcast); ok && o.Key == b.Key {
+		return b.newerThan(o)
+	}
+	return false
+}
+
+func (b KVBroadcast) Finished() {}
+
+// newerThan last writer wins, ties of version are broken by node name
+func (b *KVBroadcast) newerThan(other *KVBroadcast) bool {
+	if b.Version != other.Version {
+		return b.Version > other.Version
+	}
+	return b.NodeName > other.NodeName
+}
+
+// hybridClock hybrid logical clock, physical milliseconds in higher 48 bits and a logical counter in lower 16 bits
+type hybridClock struct {
+	mu   *sync.Mutex
+	last uint64
+}
+
+func (c *hybridClock) Now() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pt := uint64(time.Now().UnixNano()/int64(time.Millisecond)) << 16
+	if pt > c.last {
+		c.last = pt
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// Observe moves clock forward to version seen from peers
+func (c *hybridClock) Observe(version uint64) {
+	c.mu.Lock()
+	if version > c.last {
+		c.last = version
+	}
+	c.mu.Unlock()
+}
+
+func versionTime(version uint64) time.Time {
+	ms := int64(version >> 16)
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// KVStore cluster wide key/value store, replicated over gossip and persisted to a local file
+type KVStore struct {
+	mu       *sync.RWMutex
+	entries  map[string]*KVBroadcast
+	clock    *hybridClock
+	path     string
+	isDirty  bool
+	logger   *zap.Logger
+	watchers map[int]chan *coreKV.Entry
+}
+
+func newKVStore(path string, logger *zap.Logger) *KVStore {
+	return &KVStore{
+		mu:       &sync.RWMutex{},
+		entries:  map[string]*KVBroadcast{},
+		clock:    &hybridClock{mu: &sync.Mutex{}},
+		path:     path,
+		logger:   logger,
+		watchers: map[int]chan *coreKV.Entry{},
+	}
+}
+
+// Load merges entries persisted in file
+func (kv *KVStore) Load() error {
+	b, err := ioutil.ReadFile(kv.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []*KVBroadcast
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return fmt.Errorf("unable to load kv from %s: %w", kv.path, err)
+	}
+	for _, entry := range entries {
+		kv.Apply(entry)
+	}
+	return nil
+}
+
+// Flush writes entries to file if there are changes since last flush, expired tombstones are dropped
+func (kv *KVStore) Flush() error {
+	kv.mu.Lock()
+	if !kv.isDirty {
+		kv.mu.Unlock()
+		return nil
+	}
+	kv.isDirty = false
+	expiry := time.Now().Add(-defaultKVTombstoneTTL)
+	for key, entry := range kv.entries {
+		if entry.IsDeleted && versionTime(entry.Version).Before(expiry) {
+			delete(kv.entries, key)
+		}
+	}
+	b, err := json.Marshal(kv.list())
+	kv.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := kv.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, kv.path)
+}
+
+func (kv *KVStore) startFlush(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(defaultKVFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := kv.Flush(); err != nil {
+					kv.logger.Error("unable to persist kv", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+func (kv *KVStore) list() []*KVBroadcast {
+	list := make([]*KVBroadcast, 0, len(kv.entries))
+	for _, entry := range kv.entries {
+		list = append(list, entry)
+	}
+	return list
+}
+
+// List every entry including tombstones, sent along with local state
+func (kv *KVStore) List() []*KVBroadcast {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	return kv.list()
+}
+
+func (kv *KVStore) Get(key string) ([]byte, bool) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	entry, ok := kv.entries[key]
+	if !ok || entry.IsDeleted {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (kv *KVStore) Keys(prefix string) []string {
+	kv.mu.RLock()
+	var keys []string
+	for key, entry := range kv.entries {
+		if !entry.IsDeleted && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	kv.mu.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// Apply stores entry if it's newer than the current one of the same key, returns whether it's stored
+func (kv *KVStore) Apply(entry *KVBroadcast) bool {
+	kv.clock.Observe(entry.Version)
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if current, ok := kv.entries[entry.Key]; ok && !entry.newerThan(current) {
+		return false
+	}
+	kv.entries[entry.Key] = entry
+	kv.isDirty = true
+
+	change := &coreKV.Entry{
+		Key:       entry.Key,
+		Value:     entry.Value,
+		IsDeleted: entry.IsDeleted,
+	}
+	for id, ch := range kv.watchers {
+		select {
+		case ch <- change:
+		default:
+			kv.logger.Warn(fmt.Sprintf("kv change of \"%s\" is dropped for worker %d", entry.Key, id))
+		}
+	}
+	return true
+}
+
+func (kv *KVStore) NewWatcher(id int) <-chan *coreKV.Entry {
+	ch := make(chan *coreKV.Entry, 256)
+	kv.mu.Lock()
+	kv.watchers[id] = ch
+	kv.mu.Unlock()
+	return ch
+}
+
+// Reset closes watchers of workers
+func (kv *KVStore) Reset() {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	for _, ch := range kv.watchers {
+		close(ch)
+	}
+	kv.watchers = map[int]chan *coreKV.Entry{}
+}
+
+// handleKVBroadcast applies change from peer
+func (s *Server) handleKVBroadcast(broadcast *KVBroadcast) {
+	if s.kv.Apply(broadcast) {
+		s.logger.Sugar().Debugf("kv \"%s\" is changed by node %s", broadcast.Key, broadcast.NodeName)
+	}
+}
+
+func (s *Server) writeKV(key string, value []byte, isDeleted bool) error {
+	if len(value) > maxKVValueSize {
+		return fmt.Errorf("value of \"%s\" exceeds %d bytes", key, maxKVValueSize)
+	}
+	entry := &KVBroadcast{
+		NodeName:  s.members.LocalNode().Name,
+		Key:       key,
+		Value:     value,
+		Version:   s.kv.clock.Now(),
+		IsDeleted: isDeleted,
+	}
+	s.kv.Apply(entry)
+	s.broadcasts.QueueBroadcast(entry)
+	return nil
+}
+
+type luaKVEnv struct {
+	server  *Server
+	watcher <-chan *coreKV.Entry
+}
+
+func (env *luaKVEnv) Set(key string, value []byte) error {
+	return env.server.writeKV(key, value, false)
+}
+
+func (env *luaKVEnv) Delete(key string) error {
+	return env.server.writeKV(key, nil, true)
+}
+
+func (env *luaKVEnv) ReadChan() <-chan *coreKV.Entry {
+	return env.watcher
+}
+
+func (env *luaKVEnv) Build() *coreKV.Env {
+	return &coreKV.Env{
+		Get:      env.server.kv.Get,
+		Set:      env.Set,
+		Delete:   env.Delete,
+		Keys:     env.server.kv.Keys,
+		ReadChan: env.ReadChan,
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import coreCluster "github.com/joesonw/drlee/pkg/core/cluster"
+
+// nodeLabels returns labels gossiped by node, or configured labels of local node
+func (s *Server) nodeLabels(nodeName string) map[string]string {
+	if nodeName == s.members.LocalNode().Name {
+		return s.meta.Labels
+	}
+	s.endpointMu.RLock()
+	defer s.endpointMu.RUnlock()
+	return s.endpointMetas[nodeName].Labels
+}
+
+// matchLabels whether labels have every key/value of selector, empty selector matches everything
+func matchLabels(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// isSelected whether node has every label of selector
+func (s *Server) isSelected(nodeName string, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	return matchLabels(s.nodeLabels(nodeName), selector)
+}
+
+// isPreferred whether node shares the same value with local node for every given label key
+func (s *Server) isPreferred(nodeName string, keys []string) bool {
+	local := s.meta.Labels
+	labels := s.nodeLabels(nodeName)
+	for _, key := range keys {
+		if labels[key] != local[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterNodes lists alive nodes with their labels
+func (s *Server) clusterNodes() []*coreCluster.Node {
+	localNodeName := s.members.LocalNode().Name
+	var nodes []*coreCluster.Node
+	for _, member := range s.members.Members() {
+		nodes = append(nodes, &coreCluster.Node{
+			Name:    member.Name,
+			Addr:    member.Address(),
+			Labels:  s.nodeLabels(member.Name),
+			IsLocal: member.Name == localNodeName,
+		})
+	}
+	return nodes
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+const defaultLoadReportInterval = time.Second
+
+var _ memberlist.Broadcast = &LoadBroadcast{}
+
+func (b LoadBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*LoadBroadcast); ok {
+		return o.NodeName == b.NodeName
+	}
+	return false
+}
+
+func (b LoadBroadcast) Finished() {}
+
+// score pending requests per worker, lower is better
+func (b *LoadBroadcast) score() float64 {
+	workers := b.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	return float64(b.InboxDepth+b.InFlight) / float64(workers)
+}
+
+func (s *Server) loadReportInterval() time.Duration {
+	if interval := s.config.RPC.LoadReportInterval; interval > 0 {
+		return interval
+	}
+	return defaultLoadReportInterval
+}
+
+// startLoadReport periodically gossips local inbox backlog, in-flight requests and worker count
+func (s *Server) startLoadReport(ctx context.Context) {
+	ticker := time.NewTicker(s.loadReportInterval())
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.broadcasts.QueueBroadcast(s.localLoad())
+			}
+		}
+	}()
+}
+
+func (s *Server) localLoad() *LoadBroadcast {
+	return &LoadBroadcast{
+		NodeName:   s.members.LocalNode().Name,
+		Timestamp:  time.Now(),
+		InboxDepth: s.inbox.Depth(),
+		InFlight:   s.inbox.InFlight(),
+		Workers:    s.config.Concurrency,
+		Rejecting:  s.inbox.Admit() != nil,
+	}
+}
+
+// handleLoadBroadcast records load reported by peer
+func (s *Server) handleLoadBroadcast(broadcast *LoadBroadcast) {
+	s.loadsMu.Lock()
+	defer s.loadsMu.Unlock()
+	if prev, ok := s.loads[broadcast.NodeName]; ok && prev.Timestamp.After(broadcast.Timestamp) {
+		return
+	}
+	s.loads[broadcast.NodeName] = broadcast
+	if !broadcast.Rejecting {
+		delete(s.overloaded, broadcast.NodeName)
+	}
+}
+
+// getLoad returns last reported load of node, nil if unknown or outdated
+func (s *Server) getLoad(nodeName string) *LoadBroadcast {
+	s.loadsMu.RLock()
+	defer s.loadsMu.RUnlock()
+	load, ok := s.loads[nodeName]
+	if !ok || time.Since(load.Timestamp) > 3*s.loadReportInterval() {
+		return nil
+	}
+	return load
+}
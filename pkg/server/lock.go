@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
+	"go.uber.org/zap"
+)
+
+// releaseNodeLeases releases every lease held by workers of node which has left, so that they are handed over
+// without waiting for them to expire. Only the leader issues it, others would be rejected anyway.
+func (s *Server) releaseNodeLeases(name string) {
+	if s.raft == nil || s.raft.State() != raft.Leader {
+		return
+	}
+	res, err := s.applyConsensus(&coreConsensus.Command{
+		Op:   coreConsensus.OpReleaseNode,
+		Node: name,
+	})
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("unable to release leases of node %s", name), zap.Error(err))
+		return
+	}
+	if res.Swapped {
+		s.logger.Info(fmt.Sprintf("released leases of node %s", name))
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"time"
 
 	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
@@ -13,8 +12,12 @@ import (
 
 	"github.com/hashicorp/memberlist"
 	"github.com/joesonw/drlee/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+const cancelCallTimeout = time.Second * 5
+
 var _ memberlist.Broadcast = &RegistryBroadcast{}
 
 func (b RegistryBroadcast) Invalidates(other memberlist.Broadcast) bool {
@@ -27,150 +30,523 @@ func (b RegistryBroadcast) Invalidates(other memberlist.Broadcast) bool {
 func (b RegistryBroadcast) Finished() {}
 
 func (s *Server) luaRPCCall(ctx context.Context, req *coreRPC.Request) ([]byte, error) {
-	s.localServicesMu.RLock()
-	_, hasLocal := s.localServices[req.Name]
-	s.localServicesMu.RUnlock()
-	var timeout time.Duration
-	if exp := req.ExpiresAt; !exp.IsZero() {
-		timeout = time.Until(exp)
-	}
-	if hasLocal {
-		return s.callLuaRPCMethod(ctx, &RPCRequest{
-			ID:         uuid.NewV4().String(),
-			Name:       req.Name,
-			Body:       req.Body,
-			Timestamp:  time.Now(),
-			Timeout:    timeout,
-			IsLoopBack: true,
-		})
+	id := uuid.NewV4().String()
+	ch := s.replybox.Watch(id)
+	nodeName, err := s.dispatchCall(ctx, id, req)
+	if err != nil {
+		s.replybox.Delete(id)
+		return nil, err
 	}
+	return s.waitReply(ctx, nodeName, id, ch)
+}
 
-	s.servicesMu.RLock()
-	group, ok := s.services[req.Name]
-	if !ok {
-		s.servicesMu.RUnlock()
-		return nil, fmt.Errorf("service \"%s\" is not registered in cluster", req.Name)
+// luaRPCStream calls a streaming method, cb is called once per chunk in order, the last one is marked as end
+func (s *Server) luaRPCStream(ctx context.Context, req *coreRPC.Request, cb func(*coreRPC.Response)) {
+	id := uuid.NewV4().String()
+	stream := s.replybox.WatchStream(id)
+	defer s.replybox.DeleteStream(id)
+	nodeName, err := s.dispatchCall(ctx, id, req)
+	if err != nil {
+		cb(&coreRPC.Response{Error: err, IsEnd: true})
+		return
 	}
 
-	var totalWeight float64
-	for _, weight := range group {
-		totalWeight += weight
+	isReplied := false
+	for {
+		select {
+		case <-ctx.Done():
+			s.cancelCall(nodeName, id)
+			if !isReplied {
+				s.replied(nodeName, ctx.Err())
+			}
+			cb(&coreRPC.Response{Error: ctx.Err(), IsEnd: true})
+			return
+		case res := <-stream.Chunks():
+			if !isReplied {
+				isReplied = true
+				s.replied(nodeName, nil)
+			}
+			chunk := &coreRPC.Response{IsEnd: res.IsEnd}
+			if res.IsError {
+				chunk.Error = errors.New(string(res.Result))
+			} else {
+				chunk.Body = res.Result
+			}
+			cb(chunk)
+			if res.IsEnd {
+				return
+			}
+		}
 	}
+}
+
+// dispatchCall routes call and puts it into inbox of target node, the reply will be sent to id.
+// Delivery failures are retried on other nodes according to retry policy, nodes rejecting the call as overloaded
+// are skipped right away. Returns node accepted the call.
+func (s *Server) dispatchCall(ctx context.Context, id string, req *coreRPC.Request) (string, error) {
+	policy := s.retryPolicy(req.Retry)
+	failed := map[string]bool{}
+	// pinned node an idempotent call may have been accepted by, duplicates are only recognized there, so it's retried
+	// on that node only
+	pinned := ""
+	var lastErr error
+	for attempt := 1; ; {
+		nodeName := pinned
+		if nodeName == "" {
+			var err error
+			nodeName, err = s.routeCall(req, failed)
+			if err != nil {
+				if lastErr != nil {
+					return "", lastErr
+				}
+				return "", err
+			}
+		}
 
-	targetWeight := rand.Float64() * totalWeight
-	nodeName := ""
-	var currentWeight float64
-	for name, weight := range group {
-		currentWeight += weight
-		if currentWeight >= targetWeight {
-			nodeName = name
-			break
+		var err error
+		if nodeName == s.members.LocalNode().Name {
+			err = s.callLocal(id, req)
+		} else {
+			err = s.callRemote(ctx, nodeName, id, req)
+		}
+		if err == nil {
+			return nodeName, nil
+		}
+		lastErr = err
+		switch {
+		case status.Code(err) == codes.ResourceExhausted && isActorMessage(req.Name, req.Key):
+			// actor stays on its owner, messages rejected by it are retried there by policy
+		case status.Code(err) == codes.ResourceExhausted:
+			s.markOverloaded(nodeName)
+			if pinned == "" {
+				failed[nodeName] = true
+				s.logger.Sugar().Debugf("rpc call '%s' rejected by node %s, trying another one: %s", req.Name, nodeName, err)
+				continue
+			}
+		case req.IdempotencyKey != "" && (pinned != "" || mayBeAccepted(err)):
+			pinned = nodeName
+		default:
+			failed[nodeName] = true
+		}
+		if !policy.isRetryable(attempt, err) || !policy.wait(ctx, attempt, req.ExpiresAt) {
+			return "", err
 		}
+		attempt++
+		s.logger.Sugar().Debugf("retrying rpc call '%s' (attempt %d), node %s failed: %s", req.Name, attempt, nodeName, err)
 	}
-	s.servicesMu.RUnlock()
+}
 
+// mayBeAccepted whether call failed with err may have been accepted by node anyway, e.g. it timed out after being sent
+func mayBeAccepted(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// callLocal puts call into local inbox, unless it's over limits
+func (s *Server) callLocal(id string, req *coreRPC.Request) error {
+	if err := s.admit(req.Name, req.Key); err != nil {
+		return err
+	}
+	call := &RPCRequest{
+		ID:             id,
+		Name:           req.Name,
+		Body:           req.Body,
+		Timestamp:      time.Now(),
+		Timeout:        requestTimeout(req),
+		IsLoopBack:     true,
+		IsStream:       req.IsStream,
+		Codec:          req.Codec,
+		DeliverAt:      req.DeliverAt,
+		Priority:       req.Priority,
+		IdempotencyKey: req.IdempotencyKey,
+		Key:            req.Key,
+		IsOneWay:       req.IsOneWay,
+	}
+	if s.deduplicate(call, false) {
+		return nil
+	}
+	if err := s.inbox.Put(call); err != nil {
+		s.idempotency.abort(id)
+		return err
+	}
+	return nil
+}
+
+// unixNano zero time is sent as 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// timeFromUnixNano reverse of unixNano
+func timeFromUnixNano(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+func requestTimeout(req *coreRPC.Request) time.Duration {
+	if exp := req.ExpiresAt; !exp.IsZero() {
+		return time.Until(exp)
+	}
+	return 0
+}
+
+// callRemote puts call into inbox of remote node
+func (s *Server) callRemote(ctx context.Context, nodeName, id string, req *coreRPC.Request) error {
 	rpc := s.getRemoteRPC(nodeName)
 	if rpc == nil {
-		return nil, fmt.Errorf("service \"%s\" is not registered in cluster", req.Name)
+		return status.Errorf(codes.Unavailable, "remote \"%s\": not found", nodeName)
 	}
 
-	callRes, err := rpc.RPCCall(ctx, &proto.CallRequest{
+	_, err := rpc.RPCCall(ctx, &proto.CallRequest{
+		ID:                  id,
 		Name:                req.Name,
 		Body:                req.Body,
 		NodeName:            s.members.LocalNode().Name,
-		TimeoutMilliseconds: timeout.Milliseconds(),
+		TimeoutMilliseconds: requestTimeout(req).Milliseconds(),
+		IsStream:            req.IsStream,
+		Codec:               req.Codec,
+		DeliverAtUnixNano:   unixNano(req.DeliverAt),
+		Priority:            int32(req.Priority),
+		IdempotencyKey:      req.IdempotencyKey,
+		Key:                 req.Key,
+		IsOneWay:            req.IsOneWay,
 	})
-	if err != nil {
-		return nil, err
+	return err
+}
+
+// cancelCall tells node handling call that caller is no longer waiting for it
+func (s *Server) cancelCall(nodeName, id string) {
+	if nodeName == s.members.LocalNode().Name {
+		// loopback calls come from no node
+		_ = s.inbox.Cancel(id, "")
+		return
+	}
+
+	rpc := s.getRemoteRPC(nodeName)
+	if rpc == nil {
+		return
 	}
-	ch := s.replybox.Watch(callRes.ID)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cancelCallTimeout)
+		defer cancel()
+		_, err := rpc.RPCCancel(ctx, &proto.CancelRequest{
+			ID:       id,
+			NodeName: s.members.LocalNode().Name,
+		})
+		if err != nil {
+			s.logger.Sugar().Debugf("unable to cancel rpc call [%s] on node %s: %s", id, nodeName, err)
+		}
+	}()
+}
+
+func (s *Server) waitReply(ctx context.Context, nodeName, id string, ch chan *RPCResponse) ([]byte, error) {
 	select {
 	case <-ctx.Done():
-		s.replybox.Delete(callRes.ID)
+		s.replybox.Delete(id)
+		s.cancelCall(nodeName, id)
+		s.replied(nodeName, ctx.Err())
 		return nil, ctx.Err()
 	case res := <-ch:
+		s.replied(nodeName, nil)
 		if res.IsError {
-			return nil, errors.New(string(res.Result))
+			return nil, &errorReply{message: string(res.Result)}
 		}
 		return res.Result, nil
 	}
 }
 
+// errorReply error replied by handler, as opposed to failures of delivering call or waiting for its reply
+type errorReply struct {
+	message string
+}
+
+func (e *errorReply) Error() string {
+	return e.message
+}
+
+// routeCall chooses target node of call, requests with key stick to the node owning the key on hash ring,
+// otherwise local node is preferred. Nodes in exclude, cut off by circuit breakers or not matching label selector are skipped.
+func (s *Server) routeCall(req *coreRPC.Request, exclude map[string]bool) (string, error) {
+	if req.Key != "" {
+		nodeName := s.getRing(req.Name).Get(req.Key, func(nodeName string) bool {
+			return exclude[nodeName] || !s.isRoutable(nodeName) || !s.isSelected(nodeName, req.Labels)
+		})
+		if nodeName == "" {
+			return "", fmt.Errorf("service \"%s\" is not registered in cluster", req.Name)
+		}
+		return nodeName, nil
+	}
+
+	s.localServicesMu.RLock()
+	_, hasLocal := s.localServices[req.Name]
+	s.localServicesMu.RUnlock()
+	if localNodeName := s.members.LocalNode().Name; hasLocal && !exclude[localNodeName] && s.isSelected(localNodeName, req.Labels) {
+		return localNodeName, nil
+	}
+	return s.pickNode(req, exclude)
+}
+
+// pickNode chooses a remote node offering service with configured routing strategy,
+// nodes sharing preferred labels with local node are chosen if any is available
+func (s *Server) pickNode(req *coreRPC.Request, exclude map[string]bool) (string, error) {
+	name := req.Name
+	s.servicesMu.RLock()
+	group := s.services[name]
+	candidates := make([]*RouteCandidate, 0, len(group))
+	for nodeName, weight := range group {
+		if exclude[nodeName] {
+			continue
+		}
+		candidates = append(candidates, &RouteCandidate{
+			NodeName: nodeName,
+			Weight:   weight,
+		})
+	}
+	s.servicesMu.RUnlock()
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("service \"%s\" is not registered in cluster", name)
+	}
+	routable := candidates[:0]
+	for _, c := range candidates {
+		if s.isRoutable(c.NodeName) && s.isSelected(c.NodeName, req.Labels) {
+			c.Load = s.getLoad(c.NodeName)
+			routable = append(routable, c)
+		}
+	}
+	if len(routable) == 0 {
+		return "", status.Errorf(codes.Unavailable, "all nodes offering service \"%s\" are unavailable", name)
+	}
+	// overloaded nodes are only picked if every node is
+	var available []*RouteCandidate
+	for _, c := range routable {
+		if !s.isOverloaded(c.NodeName) {
+			available = append(available, c)
+		}
+	}
+	if len(available) > 0 {
+		routable = available
+	}
+	if len(req.Prefer) > 0 {
+		var preferred []*RouteCandidate
+		for _, c := range routable {
+			if s.isPreferred(c.NodeName, req.Prefer) {
+				preferred = append(preferred, c)
+			}
+		}
+		if len(preferred) > 0 {
+			routable = preferred
+		}
+	}
+	return s.router.Route(routable).NodeName, nil
+}
+
+// broadcastTarget a pending response of broadcast
+type broadcastTarget struct {
+	id       string
+	nodeName string
+}
+
+// broadcastProgress tells whether a broadcast with first/quorum has enough responses succeeded to complete early.
+// First counts responses, while quorum is a majority of target nodes, a node counts once any of its workers succeeded.
+type broadcastProgress struct {
+	isPartial bool
+	first     int
+	quorum    int
+	succeeded int
+	nodes     map[string]bool
+}
+
+func newBroadcastProgress(opts *coreRPC.BroadcastOptions, responses, nodes int) *broadcastProgress {
+	p := &broadcastProgress{
+		isPartial: opts.First > 0 || opts.Quorum,
+		first:     opts.First,
+		nodes:     map[string]bool{},
+	}
+	if p.first > responses {
+		p.first = responses
+	}
+	if opts.Quorum {
+		p.quorum = nodes/2 + 1
+	}
+	return p
+}
+
+func (p *broadcastProgress) succeed(nodeName string) {
+	p.succeeded++
+	p.nodes[nodeName] = true
+}
+
+func (p *broadcastProgress) isDone() bool {
+	if !p.isPartial {
+		return false
+	}
+	if p.first > 0 && p.succeeded >= p.first {
+		return true
+	}
+	return p.quorum > 0 && len(p.nodes) >= p.quorum
+}
+
+// luaRPCBroadcast fans out call to every worker of target nodes. It returns once all responses arrived,
+// enough responses succeeded for first/quorum, or ctx is done; responses still missing are reported as errors.
 func (s *Server) luaRPCBroadcast(ctx context.Context, req *coreRPC.Request) []*coreRPC.Response {
-	var responseIDList []string
-	var timeout time.Duration
-	if exp := req.ExpiresAt; !exp.IsZero() {
-		timeout = time.Until(exp)
+	var targets []broadcastTarget
+	var result []*coreRPC.Response
+	timeout := requestTimeout(req)
+	opts := req.Broadcast
+	if opts == nil {
+		opts = &coreRPC.BroadcastOptions{}
+	}
+	isTarget := func(nodeName string) bool {
+		if !s.isSelected(nodeName, req.Labels) {
+			return false
+		}
+		if len(opts.Nodes) == 0 {
+			return true
+		}
+		for _, name := range opts.Nodes {
+			if name == nodeName {
+				return true
+			}
+		}
+		return false
 	}
 
+	localNodeName := s.members.LocalNode().Name
 	s.localServicesMu.RLock()
 	_, hasLocal := s.localServices[req.Name]
 	s.localServicesMu.RUnlock()
-	if hasLocal {
-		ids := s.inbox.Broadcast(&RPCRequest{
+	if hasLocal && isTarget(localNodeName) {
+		ids, err := s.inbox.Broadcast(&RPCRequest{
 			ID:         uuid.NewV4().String(),
 			Name:       req.Name,
 			Body:       req.Body,
 			Timestamp:  time.Now(),
 			Timeout:    timeout,
 			IsLoopBack: true,
+			Codec:      req.Codec,
+			DeliverAt:  req.DeliverAt,
 		})
-		responseIDList = append(responseIDList, ids...)
+		if err != nil {
+			result = append(result, &coreRPC.Response{
+				Error:    err,
+				NodeName: localNodeName,
+			})
+		}
+		for _, id := range ids {
+			targets = append(targets, broadcastTarget{id: id, nodeName: localNodeName})
+		}
 	}
 
 	s.servicesMu.RLock()
-	group, ok := s.services[req.Name]
+	var nodeNames []string
+	for nodeName := range s.services[req.Name] {
+		if isTarget(nodeName) {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	}
 	s.servicesMu.RUnlock()
 
-	if ok {
-		for nodeName := range group {
-			rpc := s.getRemoteRPC(nodeName)
-			if rpc == nil {
-				id := uuid.NewV4().String()
-				responseIDList = append(responseIDList, id)
-				s.replybox.Insert(&RPCResponse{
-					ID:        id,
-					Result:    []byte(fmt.Sprintf("service \"%s\" is not registered in cluster", req.Name)),
-					Timestamp: time.Now(),
-					IsError:   true,
-				})
-				continue
-			}
-
-			res, err := rpc.RPCBroadcast(ctx, &proto.BroadcastRequest{
-				Name:                req.Name,
-				Body:                req.Body,
-				NodeName:            s.members.LocalNode().Name,
-				TimeoutMilliseconds: timeout.Milliseconds(),
+	for _, nodeName := range nodeNames {
+		rpc := s.getRemoteRPC(nodeName)
+		if rpc == nil {
+			result = append(result, &coreRPC.Response{
+				Error:    fmt.Errorf("service \"%s\" is not registered in cluster", req.Name),
+				NodeName: nodeName,
 			})
-			if err != nil {
-				id := uuid.NewV4().String()
-				responseIDList = append(responseIDList, id)
-				s.replybox.Insert(&RPCResponse{
-					ID:        id,
-					Result:    []byte(err.Error()),
-					Timestamp: time.Now(),
-					IsError:   true,
-				})
-				continue
-			}
-			responseIDList = append(responseIDList, res.IDLst...)
+			continue
 		}
-	}
 
-	var result []*coreRPC.Response
-	for _, id := range responseIDList {
-		res := <-s.replybox.Watch(id)
-		if res.IsError {
+		res, err := rpc.RPCBroadcast(ctx, &proto.BroadcastRequest{
+			Name:                req.Name,
+			Body:                req.Body,
+			NodeName:            localNodeName,
+			TimeoutMilliseconds: timeout.Milliseconds(),
+			Codec:               req.Codec,
+			DeliverAtUnixNano:   unixNano(req.DeliverAt),
+		})
+		if err != nil {
 			result = append(result, &coreRPC.Response{
-				Error: errors.New(string(res.Result)),
+				Error:    err,
+				NodeName: nodeName,
 			})
-		} else {
+			continue
+		}
+		for _, id := range res.IDLst {
+			targets = append(targets, broadcastTarget{id: id, nodeName: nodeName})
+		}
+	}
+
+	nodes := map[string]bool{}
+	for _, res := range result {
+		nodes[res.NodeName] = true
+	}
+	for _, target := range targets {
+		nodes[target.nodeName] = true
+	}
+	progress := newBroadcastProgress(opts, len(result)+len(targets), len(nodes))
+
+	type broadcastReply struct {
+		target broadcastTarget
+		res    *RPCResponse
+	}
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	defer stopWaiting()
+	replies := make(chan broadcastReply, len(targets))
+	pending := map[string]broadcastTarget{}
+	for _, target := range targets {
+		pending[target.id] = target
+		go func(target broadcastTarget, ch chan *RPCResponse) {
+			select {
+			case res := <-ch:
+				replies <- broadcastReply{target: target, res: res}
+			case <-waitCtx.Done():
+			}
+		}(target, s.replybox.Watch(target.id))
+	}
+
+	for len(pending) > 0 && !progress.isDone() {
+		select {
+		case <-ctx.Done():
+			for _, target := range pending {
+				s.replybox.Delete(target.id)
+				s.cancelCall(target.nodeName, target.id)
+				result = append(result, &coreRPC.Response{
+					Error:    ctx.Err(),
+					NodeName: target.nodeName,
+				})
+			}
+			return result
+		case reply := <-replies:
+			delete(pending, reply.target.id)
+			if reply.res.IsError {
+				result = append(result, &coreRPC.Response{
+					Error:    errors.New(string(reply.res.Result)),
+					NodeName: reply.target.nodeName,
+				})
+				continue
+			}
+			progress.succeed(reply.target.nodeName)
 			result = append(result, &coreRPC.Response{
-				Body: res.Result,
+				Body:     reply.res.Result,
+				NodeName: reply.target.nodeName,
 			})
 		}
 	}
+
+	// enough responses succeeded, the rest is no longer waited
+	for _, target := range pending {
+		s.replybox.Delete(target.id)
+		s.cancelCall(target.nodeName, target.id)
+	}
 	return result
 }
 
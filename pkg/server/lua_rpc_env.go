@@ -2,24 +2,28 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
-	"github.com/joesonw/drlee/pkg/utils"
 	"go.uber.org/zap"
 )
 
+var errRequestCancelled = errors.New("request is cancelled")
+
 type luaRPCEnv struct {
 	server        *Server
 	inboxConsumer <-chan *coreRPC.Request
 	logger        *zap.Logger
 }
 
-func (env *luaRPCEnv) Register(name string) {
+func (env *luaRPCEnv) Register(name string, opts *coreRPC.RegisterOptions) {
 	env.server.localServicesMu.Lock()
 	env.server.localServices[name] = 1
+	env.server.localCodecs[name] = opts.Codec
 	env.server.localServicesMu.Unlock()
+	env.server.invalidateRings(name)
 }
 func (env *luaRPCEnv) Call(ctx context.Context, req *coreRPC.Request, cb func(*coreRPC.Response)) {
 	go func() {
@@ -30,6 +34,9 @@ func (env *luaRPCEnv) Call(ctx context.Context, req *coreRPC.Request, cb func(*c
 		})
 	}()
 }
+func (env *luaRPCEnv) Stream(ctx context.Context, req *coreRPC.Request, cb func(*coreRPC.Response)) {
+	go env.server.luaRPCStream(ctx, req, cb)
+}
 func (env *luaRPCEnv) Broadcast(ctx context.Context, req *coreRPC.Request, cb func([]*coreRPC.Response)) {
 	go func() {
 		list := env.server.luaRPCBroadcast(ctx, req)
@@ -37,32 +44,19 @@ func (env *luaRPCEnv) Broadcast(ctx context.Context, req *coreRPC.Request, cb fu
 	}()
 }
 func (env *luaRPCEnv) Reply(id, nodeName string, isLoopBack bool, res *coreRPC.Response) {
-	r := &RPCResponse{
-		ID:        id,
-		Timestamp: time.Now(),
-		NodeName:  nodeName,
-	}
-	if res.Error != nil {
-		r.IsError = true
-		r.Result = []byte(res.Error.Error())
-	} else {
-		r.Result = res.Body
+	if err := env.server.replyCall(id, nodeName, isLoopBack, res, env.logger); err != nil {
+		env.logger.Error("unable to reply rpc call", zap.Error(err))
 	}
-
-	if isLoopBack {
-		env.server.replybox.Insert(r)
-		return
-	}
-
-	b, err := utils.MarshalGOB(&r)
-	if err != nil {
-		env.logger.Fatal("unable to marshal GOB", zap.Error(err))
-		return
+}
+func (env *luaRPCEnv) ReplyStream(req *coreRPC.Request, seq int64, res *coreRPC.Response) error {
+	running := env.server.inbox.Running(req.ID)
+	if res.IsEnd {
+		running = env.server.inbox.Done(req.ID)
 	}
-
-	if err := env.server.outboxQueue.Put(b); err != nil {
-		env.logger.Fatal("unable to put outbox queue", zap.Error(err))
+	if !running {
+		return errRequestCancelled
 	}
+	return env.server.replyStream(req, seq, res)
 }
 func (env *luaRPCEnv) ReadChan() <-chan *coreRPC.Request {
 	return env.inboxConsumer
@@ -76,6 +70,7 @@ func (env *luaRPCEnv) Start() {
 			Timestamp: time.Now(),
 			Name:      name,
 			Weight:    weight,
+			Codec:     env.server.localCodecs[name],
 		})
 		env.logger.Info(fmt.Sprintf("broadcasted service \"%s\"", name))
 	}
@@ -85,11 +80,75 @@ func (env *luaRPCEnv) Start() {
 
 func (env *luaRPCEnv) Build() *coreRPC.Env {
 	return &coreRPC.Env{
-		Register:  env.Register,
-		Call:      env.Call,
-		Broadcast: env.Broadcast,
-		Reply:     env.Reply,
-		ReadChan:  env.ReadChan,
-		Start:     env.Start,
+		Register:    env.Register,
+		Call:        env.Call,
+		Broadcast:   env.Broadcast,
+		Reply:       env.Reply,
+		ReadChan:    env.ReadChan,
+		Start:       env.Start,
+		Stream:      env.Stream,
+		ReplyStream: env.ReplyStream,
+		Codec:       env.server.serviceCodec,
+		Failed:      env.server.luaRPCFailed,
+	}
+}
+
+// replyCall sends reply of request handed to worker back to caller
+func (s *Server) replyCall(id, nodeName string, isLoopBack bool, res *coreRPC.Response, logger *zap.Logger) error {
+	r := &RPCResponse{
+		ID:        id,
+		Timestamp: time.Now(),
+		NodeName:  nodeName,
+		ExpiresAt: s.inbox.Deadline(id),
+	}
+	if res.Error != nil {
+		r.IsError = true
+		r.Result = []byte(res.Error.Error())
+	} else {
+		r.Result = res.Body
+	}
+	// reply is cached even if caller has given up, duplicates may still be waiting for it
+	s.completeIdempotent(id, r.Result, r.IsError)
+	if !s.inbox.Done(id) {
+		logger.Sugar().Debugf("dropped reply [%s], request is no longer running", id)
+		return nil
+	}
+	return s.queueReply(r, isLoopBack)
+}
+
+// queueReply hands reply to local caller, or queues it to node of remote caller. Reply failed to be queued is recorded
+// as dead letter.
+func (s *Server) queueReply(r *RPCResponse, isLoopBack bool) error {
+	if isLoopBack {
+		s.replybox.Insert(r)
+		return nil
+	}
+	if err := s.outbox.Put(r); err != nil {
+		s.deadLetters.RecordReply(r, DeadLetterUndelivered, err)
+		return fmt.Errorf("unable to queue reply [%s]: %w", r.ID, err)
+	}
+	return nil
+}
+
+// giveUpCall handles call given up by inbox sweep, duplicates waiting for it are queued again. Caller still waiting
+// is replied with an error.
+func (s *Server) giveUpCall(overdue *inboxOverdue) {
+	s.abandonIdempotent([]string{overdue.id})
+	if overdue.expired {
+		s.logger.Debug(fmt.Sprintf("gave up rpc call [%s], caller has timed out", overdue.id))
+		return
+	}
+	msg := fmt.Sprintf("rpc call [%s] wasn't replied within %s", overdue.id, s.config.Queue.Inbox.HandleTimeout)
+	s.logger.Warn(msg)
+	r := &RPCResponse{
+		ID:        overdue.id,
+		Timestamp: time.Now(),
+		NodeName:  overdue.nodeName,
+		IsError:   true,
+		Result:    []byte(msg),
+	}
+	// loopback requests have no origin
+	if err := s.queueReply(r, overdue.nodeName == ""); err != nil {
+		s.logger.Error("unable to reply rpc call", zap.Error(err))
 	}
 }
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/memberlist"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	"github.com/joesonw/drlee/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Broadcast", func() {
+	It("should reach quorum by nodes rather than workers", func() {
+		p := newBroadcastProgress(&coreRPC.BroadcastOptions{Quorum: true}, 6, 3)
+		for i := 0; i < 4; i++ {
+			p.succeed("a")
+		}
+		Expect(p.isDone()).To(BeFalse())
+		p.succeed("b")
+		Expect(p.isDone()).To(BeTrue())
+	})
+
+	It("should complete once first responses succeeded", func() {
+		p := newBroadcastProgress(&coreRPC.BroadcastOptions{First: 2}, 6, 3)
+		p.succeed("a")
+		Expect(p.isDone()).To(BeFalse())
+		p.succeed("a")
+		Expect(p.isDone()).To(BeTrue())
+
+		p = newBroadcastProgress(&coreRPC.BroadcastOptions{First: 5, Quorum: true}, 4, 2)
+		p.succeed("a")
+		Expect(p.isDone()).To(BeFalse())
+		p.succeed("b")
+		Expect(p.isDone()).To(BeTrue())
+	})
+
+	It("should wait for all responses without first or quorum", func() {
+		p := newBroadcastProgress(&coreRPC.BroadcastOptions{}, 2, 2)
+		p.succeed("a")
+		p.succeed("b")
+		Expect(p.isDone()).To(BeFalse())
+	})
+})
+
+var _ = Describe("dispatchCall", func() {
+	var members *memberlist.Memberlist
+	var remotes map[string]*fakeRPCClient
+	var s *Server
+
+	BeforeEach(func() {
+		members = newTestMembers("local")[0]
+		remotes = map[string]*fakeRPCClient{"b": {}, "c": {}}
+		endpoints := map[string]proto.RPCClient{}
+		for nodeName, rpc := range remotes {
+			endpoints[nodeName] = rpc
+		}
+		s = &Server{
+			config: &Config{RPC: RPCConfig{Retry: RetryConfig{
+				Attempts: 3,
+				On:       []string{"unavailable", "deadline_exceeded"},
+			}}},
+			members:         members,
+			endpointRPCs:    endpoints,
+			endpointMu:      &sync.RWMutex{},
+			services:        map[string]map[string]float64{"test": {"a": 1, "b": 1, "c": 1}},
+			servicesMu:      &sync.RWMutex{},
+			localServicesMu: &sync.RWMutex{},
+			loadsMu:         &sync.RWMutex{},
+			logger:          zap.NewNop(),
+			// nodes are tried in order of their names
+			router: RouterFunc(func(candidates []*RouteCandidate) *RouteCandidate {
+				sort.Slice(candidates, func(i, j int) bool {
+					return candidates[i].NodeName < candidates[j].NodeName
+				})
+				return candidates[0]
+			}),
+		}
+	})
+
+	AfterEach(func() {
+		_ = members.Shutdown()
+	})
+
+	It("should try another node if idempotent call couldn't reach node", func() {
+		nodeName, err := s.dispatchCall(context.Background(), "1", &coreRPC.Request{Name: "test", IdempotencyKey: "order-1"})
+		Expect(err).To(BeNil())
+		Expect(nodeName).To(Equal("b"))
+	})
+
+	It("should try another node if idempotent call is refused by node", func() {
+		remotes["b"].err = status.Error(codes.Unavailable, "connection refused")
+		nodeName, err := s.dispatchCall(context.Background(), "1", &coreRPC.Request{Name: "test", IdempotencyKey: "order-1"})
+		Expect(err).To(BeNil())
+		Expect(nodeName).To(Equal("c"))
+	})
+
+	It("should only retry idempotent call on node it may have been accepted by", func() {
+		delete(s.services["test"], "a")
+		remotes["b"].err = status.Error(codes.DeadlineExceeded, "timed out")
+		_, err := s.dispatchCall(context.Background(), "1", &coreRPC.Request{Name: "test", IdempotencyKey: "order-1"})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+		Expect(remotes["b"].calls).To(Equal(3))
+		Expect(remotes["c"].calls).To(BeZero())
+	})
+})
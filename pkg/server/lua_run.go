@@ -17,18 +17,28 @@ import (
 	redis "github.com/go-redis/redis/v8"
 	"github.com/gobuffalo/packr"
 	"github.com/joesonw/drlee/pkg/core"
+	coreActor "github.com/joesonw/drlee/pkg/core/actor"
+	coreCluster "github.com/joesonw/drlee/pkg/core/cluster"
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
+	coreCRDT "github.com/joesonw/drlee/pkg/core/crdt"
+	coreCron "github.com/joesonw/drlee/pkg/core/cron"
 	coreEnv "github.com/joesonw/drlee/pkg/core/env"
 	coreFS "github.com/joesonw/drlee/pkg/core/fs"
 	coreGlobal "github.com/joesonw/drlee/pkg/core/global"
 	coreHTTP "github.com/joesonw/drlee/pkg/core/http"
+	coreJobs "github.com/joesonw/drlee/pkg/core/jobs"
 	coreJSON "github.com/joesonw/drlee/pkg/core/json"
+	coreKV "github.com/joesonw/drlee/pkg/core/kv"
+	coreLock "github.com/joesonw/drlee/pkg/core/lock"
 	coreLog "github.com/joesonw/drlee/pkg/core/log"
 	coreNetwork "github.com/joesonw/drlee/pkg/core/network"
+	corePubSub "github.com/joesonw/drlee/pkg/core/pubsub"
 	coreRedis "github.com/joesonw/drlee/pkg/core/redis"
 	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
 	coreSQL "github.com/joesonw/drlee/pkg/core/sql"
 	coreTime "github.com/joesonw/drlee/pkg/core/time"
 	coreWebsocket "github.com/joesonw/drlee/pkg/core/websocket"
+	coreWorkflow "github.com/joesonw/drlee/pkg/core/workflow"
 	"github.com/joesonw/drlee/pkg/runtime"
 	lua "github.com/yuin/gopher-lua"
 	"github.com/yuin/gopher-lua/parse"
@@ -96,8 +106,17 @@ func (s *Server) StopLua(timeout time.Duration) error {
 	timer.Stop()
 
 	s.listeners.Reset()
-	s.inbox.Reset()
+	s.abandonIdempotent(s.inbox.Reset())
 	s.replybox.Reset()
+	s.kv.Reset()
+	for _, topic := range s.topics.Reset() {
+		s.broadcastSubscription(topic, true)
+	}
+	for _, queue := range s.jobs.Reset() {
+		s.broadcastJobQueue(queue, true)
+	}
+	s.workflows.Reset()
+	s.actors.Reset()
 	s.luaExitChannelGroup = nil
 	s.localServicesMu.RLock()
 	for name := range s.localServices {
@@ -110,6 +129,7 @@ func (s *Server) StopLua(timeout time.Duration) error {
 		})
 	}
 	s.localServicesMu.RUnlock()
+	s.invalidateRings()
 
 	return nil
 }
@@ -143,7 +163,9 @@ func (s *Server) runLua(L *lua.LState, box packr.Box, dir, name string, id int,
 		WorkerID: id,
 		WorkDir:  workDir,
 		Args:     s.config.ScriptArgs,
+		Labels:   s.meta.Labels,
 	})
+	coreCluster.Open(L, s.clusterNodes)
 	coreGlobal.Open(L, ec, dir)
 	coreFS.Open(L, ec, func(name string, flag, perm int) (coreFS.File, error) {
 		return os.OpenFile(name, flag, os.FileMode(perm))
@@ -162,8 +184,53 @@ func (s *Server) runLua(L *lua.LState, box packr.Box, dir, name string, id int,
 		logger:        logger,
 	}
 	coreRPC.Open(L, ec, env.Build())
+	pubSubEnv := luaPubSubEnv{
+		server:   s,
+		id:       id,
+		consumer: s.topics.NewConsumer(id),
+		logger:   logger,
+	}
+	corePubSub.Open(L, ec, pubSubEnv.Build())
+	kvEnv := luaKVEnv{
+		server:  s,
+		watcher: s.kv.NewWatcher(id),
+	}
+	coreKV.Open(L, ec, kvEnv.Build())
+	crdtEnv := luaCRDTEnv{server: s}
+	coreCRDT.Open(L, crdtEnv.Build())
+	coreConsensus.Open(L, ec, &coreConsensus.Env{
+		Apply: s.consensusApply,
+	})
+	coreLock.Open(L, ec, &coreLock.Env{
+		NodeName: s.members.LocalNode().Name,
+		WorkerID: id,
+		Apply:    s.consensusApply,
+	})
 	coreSQL.Open(L, ec, sql.Open)
 	coreTime.Open(L, ec, time.Now)
+	cronEnv := luaCronEnv{
+		server: s,
+		id:     id,
+	}
+	coreCron.Open(L, ec, cronEnv.Build())
+	jobsEnv := luaJobsEnv{
+		server:   s,
+		id:       id,
+		consumer: s.jobs.NewConsumer(id),
+		logger:   logger,
+	}
+	coreJobs.Open(L, ec, jobsEnv.Build())
+	workflowEnv := luaWorkflowEnv{
+		server: s,
+	}
+	coreWorkflow.Open(L, ec, workflowEnv.Build())
+	actorEnv := luaActorEnv{
+		server:   s,
+		id:       id,
+		consumer: s.actors.NewConsumer(id),
+		logger:   logger,
+	}
+	coreActor.Open(L, ec, actorEnv.Build())
 	for _, plugin := range s.plugins {
 		plugin.Open(L, ec)
 	}
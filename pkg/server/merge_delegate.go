@@ -1,7 +1,10 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
 )
 
 // MergeDelegate is used to involve a client in
@@ -16,7 +19,9 @@ import (
 // the return value is non-nil, the merge is canceled.
 func (s *Server) NotifyMerge(peers []*memberlist.Node) error {
 	for _, peer := range peers {
-		s.handleNode(peer)
+		if _, err := s.handleNode(peer); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to handle peer %s(%s)", peer.Name, peer.Addr), zap.Error(err))
+		}
 	}
 	return nil
 }
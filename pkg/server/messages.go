@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"encoding/json"
 	"time"
+
+	coreCRDT "github.com/joesonw/drlee/pkg/core/crdt"
 )
 
 type MessageType byte
 
 const (
-	TypeRegistryBroadcast MessageType = 'r'
+	TypeRegistryBroadcast     MessageType = 'r'
+	TypeLoadBroadcast         MessageType = 'l'
+	TypeSubscriptionBroadcast MessageType = 's'
+	TypeKVBroadcast           MessageType = 'k'
+	TypeCRDTBroadcast         MessageType = 'c'
+	TypeJobQueueBroadcast     MessageType = 'j'
 )
 
 func marshalMessage(typ MessageType, in interface{}) []byte {
@@ -29,9 +36,79 @@ type RegistryBroadcast struct {
 	Timestamp time.Time `json:"Timestamp,omitempty"`
 	Name      string    `json:"Name,omitempty"`
 	Weight    float64   `json:"Weight,omitempty"`
+	Codec     string    `json:"Codec,omitempty"`
 	IsDeleted bool      `json:"IsDeleted,omitempty"`
 }
 
 func (b *RegistryBroadcast) Message() []byte {
 	return marshalMessage(TypeRegistryBroadcast, b)
 }
+
+type LoadBroadcast struct {
+	NodeName   string    `json:"NodeName,omitempty"`
+	Timestamp  time.Time `json:"Timestamp,omitempty"`
+	InboxDepth int64     `json:"InboxDepth,omitempty"`
+	InFlight   int64     `json:"InFlight,omitempty"`
+	Workers    int       `json:"Workers,omitempty"`
+	// Rejecting inbox limits are exceeded, calls are rejected
+	Rejecting bool `json:"Rejecting,omitempty"`
+}
+
+func (b *LoadBroadcast) Message() []byte {
+	return marshalMessage(TypeLoadBroadcast, b)
+}
+
+type SubscriptionBroadcast struct {
+	NodeName  string    `json:"NodeName,omitempty"`
+	Timestamp time.Time `json:"Timestamp,omitempty"`
+	Topic     string    `json:"Topic,omitempty"`
+	IsDeleted bool      `json:"IsDeleted,omitempty"`
+}
+
+func (b *SubscriptionBroadcast) Message() []byte {
+	return marshalMessage(TypeSubscriptionBroadcast, b)
+}
+
+// JobQueueBroadcast node starts or stops processing jobs of queue
+type JobQueueBroadcast struct {
+	NodeName  string    `json:"NodeName,omitempty"`
+	Timestamp time.Time `json:"Timestamp,omitempty"`
+	Queue     string    `json:"Queue,omitempty"`
+	IsDeleted bool      `json:"IsDeleted,omitempty"`
+}
+
+func (b *JobQueueBroadcast) Message() []byte {
+	return marshalMessage(TypeJobQueueBroadcast, b)
+}
+
+type KVBroadcast struct {
+	NodeName  string `json:"NodeName,omitempty"`
+	Key       string `json:"Key,omitempty"`
+	Value     []byte `json:"Value,omitempty"`
+	Version   uint64 `json:"Version,omitempty"`
+	IsDeleted bool   `json:"IsDeleted,omitempty"`
+}
+
+func (b *KVBroadcast) Message() []byte {
+	return marshalMessage(TypeKVBroadcast, b)
+}
+
+type CRDTBroadcast struct {
+	NodeName string          `json:"NodeName,omitempty"`
+	Name     string          `json:"Name,omitempty"`
+	Kind     coreCRDT.Kind   `json:"Kind,omitempty"`
+	Data     json.RawMessage `json:"Data,omitempty"`
+}
+
+func (b *CRDTBroadcast) Message() []byte {
+	return marshalMessage(TypeCRDTBroadcast, b)
+}
+
+// RemoteState state exchanged in push/pull, older nodes send services only as an array
+type RemoteState struct {
+	Services      []*RegistryBroadcast     `json:"services"`
+	Subscriptions []*SubscriptionBroadcast `json:"subscriptions,omitempty"`
+	KV            []*KVBroadcast           `json:"kv,omitempty"`
+	CRDTs         []*coreCRDT.State        `json:"crdts,omitempty"`
+	JobQueues     []*JobQueueBroadcast     `json:"job_queues,omitempty"`
+}
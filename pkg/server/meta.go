@@ -1,21 +1,56 @@
 package server
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// metaVersionJSON version byte followed by json encoded Meta
+const metaVersionJSON byte = 1
 
 type Meta struct {
-	RPCPort int32
+	RPCPort  int32 `json:"rpc_port"`
+	RaftPort int32 `json:"raft_port,omitempty"`
+	// RaftBootstrapped whether node has raft state, nodes joining later join its raft group instead of bootstrapping
+	RaftBootstrapped bool              `json:"raft_bootstrapped,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
 }
 
 var metaEndian = binary.LittleEndian
 
-func DecodeMeta(b []byte) Meta {
-	rpcPort := metaEndian.Uint32(b[0:4])
-	return Meta{
-		RPCPort: int32(rpcPort),
+// DecodeMeta decodes versioned meta, unversioned 4 bytes rpc port sent by older nodes is also accepted
+func DecodeMeta(b []byte) (Meta, error) {
+	if len(b) == 4 {
+		return Meta{
+			RPCPort: int32(metaEndian.Uint32(b[0:4])),
+		}, nil
+	}
+	if len(b) == 0 {
+		return Meta{}, errors.New("empty meta")
+	}
+
+	var m Meta
+	switch b[0] {
+	case metaVersionJSON:
+		if err := json.Unmarshal(b[1:], &m); err != nil {
+			return m, err
+		}
+		return m, nil
 	}
+	return m, errors.New("unknown meta version")
 }
 
+// Encode encodes meta with the latest version
 func (m Meta) Encode() []byte {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return m.encodeLegacy()
+	}
+	return append([]byte{metaVersionJSON}, b...)
+}
+
+func (m Meta) encodeLegacy() []byte {
 	b := make([]byte, 4)
 	metaEndian.PutUint32(b[0:4], uint32(m.RPCPort))
 	return b
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/pkg/utils"
+	"github.com/nsqio/go-diskqueue"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultReplyBackoff    = time.Millisecond * 500
+	defaultReplyMaxBackoff = time.Second * 30
+	defaultReplyMaxAge     = time.Minute * 10
+	// replySendTimeout timeout of a single attempt of sending reply
+	replySendTimeout = time.Second * 10
+)
+
+var errRemoteNotFound = errors.New("not found")
+
+// Outbox replies to remote callers, each node has its own queue and workers so an unreachable node only holds back
+// replies to itself. Replies failed to be sent are put back to the end of queue, and the node is retried with
+// exponential backoff until callers give up.
+type Outbox struct {
+	mu           *sync.Mutex
+	config       ReplyRetryConfig
+	concurrency  int
+	dir          string
+	newQueue     QueueFactory
+	legacy       diskqueue.Interface
+	send         func(ctx context.Context, res *RPCResponse) error
+	deadLetters  *DeadLetters
+	logger       *zap.Logger
+	destinations map[string]*outboxDestination
+	started      bool
+}
+
+type outboxDestination struct {
+	diskqueue.Interface
+	nodeName string
+	mu       *sync.Mutex
+	// wake is closed once node joins again, so workers waiting for backoff retry right away
+	wake     chan struct{}
+	failures int
+	retryAt  time.Time
+	lastErr  error
+	sending  int
+	sent     int64
+	retried  int64
+	dead     int64
+}
+
+func newOutbox(config ReplyRetryConfig, concurrency int, dir string, newQueue QueueFactory, legacy diskqueue.Interface, send func(ctx context.Context, res *RPCResponse) error, deadLetters *DeadLetters, logger *zap.Logger) *Outbox {
+	if config.Backoff <= 0 {
+		config.Backoff = defaultReplyBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultReplyMaxBackoff
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultReplyMaxAge
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Outbox{
+		mu:           &sync.Mutex{},
+		config:       config,
+		concurrency:  concurrency,
+		dir:          dir,
+		newQueue:     newQueue,
+		legacy:       legacy,
+		send:         send,
+		deadLetters:  deadLetters,
+		logger:       logger,
+		destinations: map[string]*outboxDestination{},
+	}
+}
+
+// Put queues reply to its node
+func (o *Outbox) Put(res *RPCResponse) error {
+	b, err := utils.MarshalGOB(res)
+	if err != nil {
+		return err
+	}
+	return o.destination(res.NodeName).Put(b)
+}
+
+// destination gets or opens queue of node, workers are started once outbox is started
+func (o *Outbox) destination(nodeName string) *outboxDestination {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name := safeQueueName(nodeName)
+	if dest, ok := o.destinations[name]; ok {
+		return dest
+	}
+	dest := &outboxDestination{
+		Interface: o.newQueue("outbox." + name),
+		nodeName:  nodeName,
+		mu:        &sync.Mutex{},
+		wake:      make(chan struct{}),
+	}
+	o.destinations[name] = dest
+	if o.started {
+		o.startWorkers(dest)
+	}
+	return dest
+}
+
+// Start opens queues left by previous runs and starts workers of every node,
+// replies in the shared queue of previous versions are moved to queues of their nodes.
+func (o *Outbox) Start() error {
+	files, err := filepath.Glob(filepath.Join(o.dir, "outbox.*"+inboxQueueSuffix))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		o.destination(strings.TrimPrefix(strings.TrimSuffix(filepath.Base(file), inboxQueueSuffix), "outbox."))
+	}
+
+	o.mu.Lock()
+	o.started = true
+	for _, dest := range o.destinations {
+		o.startWorkers(dest)
+	}
+	o.mu.Unlock()
+	go o.drainLegacy()
+	return nil
+}
+
+func (o *Outbox) startWorkers(dest *outboxDestination) {
+	for i := 0; i < o.concurrency; i++ {
+		go o.work(dest)
+	}
+}
+
+func (o *Outbox) drainLegacy() {
+	for data := range o.legacy.ReadChan() {
+		res := &RPCResponse{}
+		if err := utils.UnmarshalGOB(data, res); err != nil {
+			o.recordUndecodable(data, err)
+			continue
+		}
+		if err := o.Put(res); err != nil {
+			o.deadLetters.RecordReply(res, DeadLetterUndelivered, err)
+		}
+	}
+}
+
+// Wake retries replies to node right away, it's called once node joins
+func (o *Outbox) Wake(nodeName string) {
+	o.mu.Lock()
+	dest, ok := o.destinations[safeQueueName(nodeName)]
+	o.mu.Unlock()
+	if !ok {
+		return
+	}
+	dest.mu.Lock()
+	defer dest.mu.Unlock()
+	dest.retryAt = time.Time{}
+	close(dest.wake)
+	dest.wake = make(chan struct{})
+}
+
+func (o *Outbox) work(dest *outboxDestination) {
+	for data := range dest.ReadChan() {
+		res := &RPCResponse{}
+		if err := utils.UnmarshalGOB(data, res); err != nil {
+			o.recordUndecodable(data, err)
+			continue
+		}
+		dest.mu.Lock()
+		dest.sending++
+		dest.mu.Unlock()
+		o.deliver(dest, res)
+		dest.mu.Lock()
+		dest.sending--
+		dest.mu.Unlock()
+	}
+}
+
+// deliver sends reply once node is due to be retried, reply failed to be sent is put back to the end of queue.
+// Replies whose callers have given up are recorded as dead letters.
+func (o *Outbox) deliver(dest *outboxDestination, res *RPCResponse) {
+	for {
+		if reason, ok := o.expired(dest, res); ok {
+			dest.mu.Lock()
+			dest.dead++
+			err := dest.lastErr
+			dest.mu.Unlock()
+			o.deadLetters.RecordReply(res, reason, err)
+			return
+		}
+		dest.mu.Lock()
+		wait := time.Until(dest.retryAt)
+		wake := dest.wake
+		dest.mu.Unlock()
+		if wait <= 0 {
+			break
+		}
+		if !res.ExpiresAt.IsZero() && time.Until(res.ExpiresAt) < wait {
+			wait = time.Until(res.ExpiresAt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-wake:
+		}
+		timer.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replySendTimeout)
+	err := o.send(ctx, res)
+	cancel()
+	dest.mu.Lock()
+	if err == nil {
+		dest.sent++
+		dest.failures = 0
+		dest.retryAt = time.Time{}
+		dest.lastErr = nil
+		dest.mu.Unlock()
+		return
+	}
+	dest.retried++
+	dest.failures++
+	dest.lastErr = err
+	backoff := o.backoff(dest.failures)
+	dest.retryAt = time.Now().Add(backoff)
+	dest.mu.Unlock()
+
+	o.logger.Sugar().Debugf("unable to reply [%s] to node %s (attempt %d), retrying in %s: %s", res.ID, res.NodeName, res.Attempts+1, backoff, err)
+	res.Attempts++
+	b, err := utils.MarshalGOB(res)
+	if err == nil {
+		err = dest.Put(b)
+	}
+	if err != nil {
+		o.deadLetters.RecordReply(res, DeadLetterUndelivered, err)
+	}
+}
+
+// expired replies are given up once deadline of request has passed, or after max age if caller waits without timeout
+func (o *Outbox) expired(dest *outboxDestination, res *RPCResponse) (DeadLetterReason, bool) {
+	if !res.ExpiresAt.IsZero() {
+		return DeadLetterExpired, time.Now().After(res.ExpiresAt)
+	}
+	if time.Since(res.Timestamp) < o.config.MaxAge {
+		return "", false
+	}
+	dest.mu.Lock()
+	defer dest.mu.Unlock()
+	if errors.Is(dest.lastErr, errRemoteNotFound) {
+		return DeadLetterUnknownNode, true
+	}
+	return DeadLetterUndelivered, true
+}
+
+func (o *Outbox) backoff(failures int) time.Duration {
+	backoff := o.config.Backoff << uint(failures-1)
+	if backoff > o.config.MaxBackoff || backoff <= 0 {
+		backoff = o.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (o *Outbox) recordUndecodable(data []byte, err error) {
+	o.deadLetters.Record(&DeadLetter{
+		Reason:  DeadLetterDecodeError,
+		Error:   err.Error(),
+		Kind:    DeadLetterReply,
+		Payload: data,
+	})
+}
+
+// Pending number of replies not yet sent
+func (o *Outbox) Pending() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var pending int64
+	for _, dest := range o.destinations {
+		dest.mu.Lock()
+		pending += dest.Depth() + int64(dest.sending)
+		dest.mu.Unlock()
+	}
+	return pending
+}
+
+// describe pending, sent, retried and dead replies of every node, preceded by totals
+func (o *Outbox) describe() string {
+	total := fmt.Sprintf("outbox: pending=%d", o.Pending())
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	lines := make([]string, 0, len(o.destinations))
+	for _, dest := range o.destinations {
+		dest.mu.Lock()
+		line := fmt.Sprintf("%s: pending=%d sent=%d retried=%d dead=%d", dest.nodeName, dest.Depth()+int64(dest.sending), dest.sent, dest.retried, dest.dead)
+		if dest.lastErr != nil {
+			line += fmt.Sprintf(" failures=%d", dest.failures)
+			if wait := time.Until(dest.retryAt); wait > 0 {
+				line += fmt.Sprintf(" retry_in=%s", wait.Round(time.Millisecond))
+			}
+			line += fmt.Sprintf(" error=%s", dest.lastErr)
+		}
+		dest.mu.Unlock()
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return strings.Join(append([]string{total}, lines...), "\n")
+}
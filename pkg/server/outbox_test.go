@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	diskqueue "github.com/nsqio/go-diskqueue"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// failingQueue diskqueue refusing every message
+type failingQueue struct {
+	diskqueue.Interface
+}
+
+func (q *failingQueue) Put([]byte) error {
+	return errors.New("disk is full")
+}
+
+func (q *failingQueue) ReadChan() <-chan []byte {
+	return nil
+}
+
+var _ = Describe("Outbox", func() {
+	var dir string
+	var letters *DeadLetters
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-outbox")
+		Expect(err).To(BeNil())
+		letters = newDeadLetters(filepath.Join(dir, "dead-letters"), nil, zap.NewNop())
+		Expect(letters.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	newTestOutbox := func(config ReplyRetryConfig, concurrency int, send func(ctx context.Context, res *RPCResponse) error) *Outbox {
+		o := newOutbox(config, concurrency, dir, newMemoryQueue, newLegacyDeadLetterQueue(), send, letters, zap.NewNop())
+		Expect(o.Start()).To(Succeed())
+		return o
+	}
+
+	deadLetters := func() []*DeadLetter {
+		list, err := letters.List()
+		Expect(err).To(BeNil())
+		return list
+	}
+
+	It("should retry node with exponential backoff until reply is sent", func() {
+		var mu sync.Mutex
+		var attempts []time.Time
+		sent := make(chan *RPCResponse, 1)
+		o := newTestOutbox(ReplyRetryConfig{Backoff: time.Millisecond * 20, MaxBackoff: time.Second}, 1, func(ctx context.Context, res *RPCResponse) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, time.Now())
+			if len(attempts) < 3 {
+				return errors.New("unavailable")
+			}
+			sent <- res
+			return nil
+		})
+		Expect(o.Put(&RPCResponse{ID: "1", NodeName: "a", Timestamp: time.Now()})).To(Succeed())
+
+		var res *RPCResponse
+		Eventually(sent).Should(Receive(&res))
+		Expect(res.ID).To(Equal("1"))
+		Expect(res.Attempts).To(Equal(2))
+		mu.Lock()
+		Expect(attempts[1].Sub(attempts[0])).To(BeNumerically(">=", time.Millisecond*20))
+		Expect(attempts[2].Sub(attempts[1])).To(BeNumerically(">=", time.Millisecond*40))
+		mu.Unlock()
+		Expect(deadLetters()).To(BeEmpty())
+	})
+
+	It("should send at most concurrency replies to a node at the same time", func() {
+		sending := atomic.NewInt32(0)
+		maxSending := atomic.NewInt32(0)
+		release := make(chan struct{})
+		sent := atomic.NewInt32(0)
+		o := newTestOutbox(ReplyRetryConfig{}, 2, func(ctx context.Context, res *RPCResponse) error {
+			n := sending.Inc()
+			for {
+				max := maxSending.Load()
+				if n <= max || maxSending.CAS(max, n) {
+					break
+				}
+			}
+			<-release
+			sending.Dec()
+			sent.Inc()
+			return nil
+		})
+		for i := 0; i < 5; i++ {
+			Expect(o.Put(&RPCResponse{ID: fmt.Sprint(i), NodeName: "a", Timestamp: time.Now()})).To(Succeed())
+		}
+
+		Eventually(sending.Load).Should(Equal(int32(2)))
+		Consistently(sending.Load, "50ms").Should(Equal(int32(2)))
+		close(release)
+		Eventually(sent.Load).Should(Equal(int32(5)))
+		Expect(maxSending.Load()).To(Equal(int32(2)))
+		Expect(o.Pending()).To(BeZero())
+	})
+
+	It("should record replies as dead letters once callers have given up", func() {
+		o := newTestOutbox(ReplyRetryConfig{Backoff: time.Millisecond * 10}, 1, func(ctx context.Context, res *RPCResponse) error {
+			return errors.New("unavailable")
+		})
+		Expect(o.Put(&RPCResponse{ID: "1", NodeName: "a", Timestamp: time.Now(), ExpiresAt: time.Now().Add(time.Millisecond * 100)})).To(Succeed())
+
+		Eventually(deadLetters).Should(HaveLen(1))
+		letter := deadLetters()[0]
+		Expect(letter.MessageID).To(Equal("1"))
+		Expect(letter.Reason).To(Equal(DeadLetterExpired))
+		Expect(letter.Error).To(Equal("unavailable"))
+	})
+
+	It("should record replies to unknown node as dead letters after max age", func() {
+		o := newTestOutbox(ReplyRetryConfig{Backoff: time.Millisecond * 10, MaxAge: time.Millisecond * 100}, 1, func(ctx context.Context, res *RPCResponse) error {
+			return fmt.Errorf("remote %s: %w", res.NodeName, errRemoteNotFound)
+		})
+		Expect(o.Put(&RPCResponse{ID: "1", NodeName: "a", Timestamp: time.Now()})).To(Succeed())
+
+		Eventually(deadLetters).Should(HaveLen(1))
+		Expect(deadLetters()[0].Reason).To(Equal(DeadLetterUnknownNode))
+	})
+
+	It("should record replies failed to be queued as dead letters", func() {
+		o := newOutbox(ReplyRetryConfig{}, 1, dir, func(string) diskqueue.Interface {
+			return &failingQueue{}
+		}, newLegacyDeadLetterQueue(), nil, letters, zap.NewNop())
+		s := &Server{outbox: o, deadLetters: letters}
+
+		err := s.queueReply(&RPCResponse{ID: "1", NodeName: "a", Timestamp: time.Now()}, false)
+		Expect(err).NotTo(BeNil())
+		Expect(deadLetters()).To(HaveLen(1))
+		Expect(deadLetters()[0].Reason).To(Equal(DeadLetterUndelivered))
+	})
+})
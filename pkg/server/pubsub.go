@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	corePubSub "github.com/joesonw/drlee/pkg/core/pubsub"
+	"github.com/joesonw/drlee/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	publishTimeout = time.Second * 5
+	// publishConcurrency messages being delivered at the same time, to local workers or remote nodes
+	publishConcurrency = 16
+	// publishQueueSize deliveries waiting for a publisher, messages are dropped once it's full
+	publishQueueSize = 1024
+)
+
+var _ memberlist.Broadcast = &SubscriptionBroadcast{}
+
+func (b SubscriptionBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if o, ok := other.(*SubscriptionBroadcast); ok && o.NodeName == b.NodeName && o.Topic == b.Topic {
+		return o.Timestamp.After(b.Timestamp)
+	}
+	return false
+}
+
+func (b SubscriptionBroadcast) Finished() {}
+
+// Topics topics subscribed by local workers
+type Topics struct {
+	mu          *sync.RWMutex
+	consumers   map[int]*topicConsumer
+	subscribers map[string]map[int]bool
+	// sending held by deliveries while sending to consumers, so that queues are closed only once they are done
+	sending *sync.RWMutex
+}
+
+// topicConsumer queue of a worker, done is closed on reset to let deliveries waiting for room go
+type topicConsumer struct {
+	ch   chan *corePubSub.Message
+	done chan struct{}
+}
+
+func newTopics() *Topics {
+	return &Topics{
+		mu:          &sync.RWMutex{},
+		consumers:   map[int]*topicConsumer{},
+		subscribers: map[string]map[int]bool{},
+		sending:     &sync.RWMutex{},
+	}
+}
+
+func (t *Topics) NewConsumer(id int) <-chan *corePubSub.Message {
+	consumer := &topicConsumer{
+		ch:   make(chan *corePubSub.Message, 64),
+		done: make(chan struct{}),
+	}
+	t.mu.Lock()
+	t.consumers[id] = consumer
+	t.mu.Unlock()
+	return consumer.ch
+}
+
+// Subscribe subscribes worker to topic, returns true if it's the first subscriber on local node
+func (t *Topics) Subscribe(id int, topic string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, ok := t.subscribers[topic]
+	if !ok {
+		group = map[int]bool{}
+		t.subscribers[topic] = group
+	}
+	group[id] = true
+	return !ok
+}
+
+// Unsubscribe unsubscribes worker from topic, returns true if it was the last subscriber on local node
+func (t *Topics) Unsubscribe(id int, topic string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	group, ok := t.subscribers[topic]
+	if !ok {
+		return false
+	}
+	delete(group, id)
+	if len(group) > 0 {
+		return false
+	}
+	delete(t.subscribers, topic)
+	return true
+}
+
+// List topics having at least one local subscriber
+func (t *Topics) List() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	topics := make([]string, 0, len(t.subscribers))
+	for topic := range t.subscribers {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Deliver hands message to every local worker subscribed to its topic, waits for room in worker queues until ctx is
+// done. Topics are not locked while waiting, so workers can still subscribe and unsubscribe.
+func (t *Topics) Deliver(ctx context.Context, msg *corePubSub.Message) {
+	t.mu.RLock()
+	consumers := make([]*topicConsumer, 0, len(t.subscribers[msg.Topic]))
+	for id := range t.subscribers[msg.Topic] {
+		if consumer, ok := t.consumers[id]; ok {
+			consumers = append(consumers, consumer)
+		}
+	}
+	t.mu.RUnlock()
+
+	t.sending.RLock()
+	defer t.sending.RUnlock()
+	for _, consumer := range consumers {
+		select {
+		case <-ctx.Done():
+			return
+		case <-consumer.done:
+		case consumer.ch <- msg:
+		}
+	}
+}
+
+// Reset drops every subscription and closes worker queues, returns topics that were subscribed
+func (t *Topics) Reset() []string {
+	topics := t.List()
+	t.mu.Lock()
+	consumers := t.consumers
+	t.consumers = map[int]*topicConsumer{}
+	t.subscribers = map[string]map[int]bool{}
+	t.mu.Unlock()
+
+	for _, consumer := range consumers {
+		close(consumer.done)
+	}
+	t.sending.Lock()
+	defer t.sending.Unlock()
+	for _, consumer := range consumers {
+		close(consumer.ch)
+	}
+	return topics
+}
+
+// handleSubscriptionBroadcast records topics subscribed by peer
+func (s *Server) handleSubscriptionBroadcast(broadcast *SubscriptionBroadcast) {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+	if broadcast.IsDeleted {
+		delete(s.subscriptions[broadcast.Topic], broadcast.NodeName)
+		if len(s.subscriptions[broadcast.Topic]) == 0 {
+			delete(s.subscriptions, broadcast.Topic)
+		}
+		s.logger.Sugar().Debugf("node %s unsubscribed topic \"%s\"", broadcast.NodeName, broadcast.Topic)
+		return
+	}
+	if _, ok := s.subscriptions[broadcast.Topic]; !ok {
+		s.subscriptions[broadcast.Topic] = map[string]bool{}
+	}
+	s.subscriptions[broadcast.Topic][broadcast.NodeName] = true
+	s.logger.Sugar().Debugf("node %s subscribed topic \"%s\"", broadcast.NodeName, broadcast.Topic)
+}
+
+func (s *Server) broadcastSubscription(topic string, isDeleted bool) {
+	s.broadcasts.QueueBroadcast(&SubscriptionBroadcast{
+		NodeName:  s.members.LocalNode().Name,
+		Timestamp: time.Now(),
+		Topic:     topic,
+		IsDeleted: isDeleted,
+	})
+}
+
+// localSubscriptions subscriptions of local node, sent along with local state
+func (s *Server) localSubscriptions() []*SubscriptionBroadcast {
+	nodeName := s.members.LocalNode().Name
+	var list []*SubscriptionBroadcast
+	for _, topic := range s.topics.List() {
+		list = append(list, &SubscriptionBroadcast{
+			NodeName:  nodeName,
+			Timestamp: time.Now(),
+			Topic:     topic,
+		})
+	}
+	return list
+}
+
+// pendingPublish message waiting to be delivered to a node
+type pendingPublish struct {
+	nodeName string
+	msg      *corePubSub.Message
+}
+
+// startPublishers delivers published messages with a fixed number of publishers
+func (s *Server) startPublishers(ctx context.Context) {
+	for i := 0; i < publishConcurrency; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case p := <-s.publishes:
+					s.deliverPublish(p)
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) deliverPublish(p *pendingPublish) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if p.nodeName == s.members.LocalNode().Name {
+		s.topics.Deliver(ctx, p.msg)
+		return
+	}
+	rpc := s.getRemoteRPC(p.nodeName)
+	if rpc == nil {
+		return
+	}
+	_, err := rpc.RPCPublish(ctx, &proto.PublishRequest{
+		Topic:    p.msg.Topic,
+		Body:     p.msg.Body,
+		Codec:    p.msg.Codec,
+		NodeName: p.msg.NodeName,
+	})
+	if err != nil {
+		s.logger.Sugar().Debugf("unable to publish to topic \"%s\" on node %s: %s", p.msg.Topic, p.nodeName, err)
+	}
+}
+
+// publish delivers message to local subscribers and every node subscribed to its topic, without waiting for them.
+// Deliveries are dropped if publishers are too far behind.
+func (s *Server) publish(msg *corePubSub.Message) {
+	msg.NodeName = s.members.LocalNode().Name
+	nodeNames := []string{msg.NodeName}
+	s.subscriptionsMu.RLock()
+	for nodeName := range s.subscriptions[msg.Topic] {
+		if nodeName != msg.NodeName {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	}
+	s.subscriptionsMu.RUnlock()
+
+	for _, nodeName := range nodeNames {
+		select {
+		case s.publishes <- &pendingPublish{nodeName: nodeName, msg: msg}:
+		default:
+			s.logger.Warn(fmt.Sprintf("too many messages being published, dropped message to topic \"%s\" for node %s", msg.Topic, nodeName))
+		}
+	}
+}
+
+func (s *Server) RPCPublish(ctx context.Context, req *proto.PublishRequest) (*proto.PublishResponse, error) {
+	s.topics.Deliver(ctx, &corePubSub.Message{
+		Topic:    req.Topic,
+		Body:     req.Body,
+		Codec:    req.Codec,
+		NodeName: req.NodeName,
+	})
+	return &proto.PublishResponse{}, nil
+}
+
+type luaPubSubEnv struct {
+	server   *Server
+	id       int
+	consumer <-chan *corePubSub.Message
+	logger   *zap.Logger
+}
+
+func (env *luaPubSubEnv) Subscribe(topic string) {
+	if env.server.topics.Subscribe(env.id, topic) {
+		env.server.broadcastSubscription(topic, false)
+		env.logger.Info(fmt.Sprintf("subscribed topic \"%s\"", topic))
+	}
+}
+
+func (env *luaPubSubEnv) Unsubscribe(topic string) {
+	if env.server.topics.Unsubscribe(env.id, topic) {
+		env.server.broadcastSubscription(topic, true)
+		env.logger.Info(fmt.Sprintf("unsubscribed topic \"%s\"", topic))
+	}
+}
+
+func (env *luaPubSubEnv) Publish(ctx context.Context, msg *corePubSub.Message) error {
+	env.server.publish(msg)
+	return nil
+}
+
+func (env *luaPubSubEnv) ReadChan() <-chan *corePubSub.Message {
+	return env.consumer
+}
+
+func (env *luaPubSubEnv) Build() *corePubSub.Env {
+	return &corePubSub.Env{
+		Subscribe:   env.Subscribe,
+		Unsubscribe: env.Unsubscribe,
+		Publish:     env.Publish,
+		ReadChan:    env.ReadChan,
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	corePubSub "github.com/joesonw/drlee/pkg/core/pubsub"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Topics", func() {
+	It("should let workers subscribe while delivery waits for them", func() {
+		t := newTopics()
+		ch := t.NewConsumer(1)
+		t.Subscribe(1, "chat")
+		for i := 0; i < cap(ch); i++ {
+			t.Deliver(context.Background(), &corePubSub.Message{Topic: "chat"})
+		}
+
+		delivered := make(chan struct{})
+		go func() {
+			t.Deliver(context.Background(), &corePubSub.Message{Topic: "chat", Body: []byte("last")})
+			close(delivered)
+		}()
+		subscribed := make(chan struct{})
+		go func() {
+			t.Subscribe(1, "news")
+			t.Unsubscribe(1, "news")
+			close(subscribed)
+		}()
+		Eventually(subscribed).Should(BeClosed())
+		Consistently(delivered, 50*time.Millisecond).ShouldNot(BeClosed())
+		<-ch
+		Eventually(delivered).Should(BeClosed())
+	})
+
+	It("should let delivery go on reset", func() {
+		t := newTopics()
+		ch := t.NewConsumer(1)
+		t.Subscribe(1, "chat")
+		for i := 0; i < cap(ch); i++ {
+			t.Deliver(context.Background(), &corePubSub.Message{Topic: "chat"})
+		}
+		delivered := make(chan struct{})
+		go func() {
+			t.Deliver(context.Background(), &corePubSub.Message{Topic: "chat"})
+			close(delivered)
+		}()
+		Consistently(delivered, 50*time.Millisecond).ShouldNot(BeClosed())
+
+		reset := make(chan []string)
+		go func() {
+			reset <- t.Reset()
+		}()
+		Eventually(reset).Should(Receive(Equal([]string{"chat"})))
+		Eventually(delivered).Should(BeClosed())
+		n := 0
+		for range ch {
+			n++
+		}
+		Expect(n).To(Equal(cap(ch)))
+	})
+})
@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
+	"github.com/joesonw/drlee/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRaftApplyTimeout = time.Second * 5
+	raftReconcileInterval   = time.Second * 5
+	raftSnapshotRetain      = 2
+	raftTransportTimeout    = time.Second * 10
+	raftTransportMaxPool    = 3
+	raftMetaUpdateTimeout   = time.Second * 5
+)
+
+var (
+	errConsensusDisabled = errors.New("consensus is not enabled, raft port is not configured")
+	errNoRaftLeader      = errors.New("raft leader is not elected")
+)
+
+type raftFSM struct {
+	state *coreConsensus.State
+}
+
+func (f *raftFSM) Apply(log *raft.Log) interface{} {
+	cmd := &coreConsensus.Command{}
+	if err := json.Unmarshal(log.Data, cmd); err != nil {
+		return err
+	}
+	res, err := f.state.Apply(cmd)
+	if err != nil {
+		return err
+	}
+	return res
+}
+
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &raftSnapshot{state: f.state.Clone()}, nil
+}
+
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	return f.state.Decode(rc)
+}
+
+type raftSnapshot struct {
+	state *coreConsensus.State
+}
+
+func (s *raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.state.Encode(sink); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *raftSnapshot) Release() {}
+
+// startRaft starts raft group if raft port is configured, logs and snapshots are kept in queue dir
+func (s *Server) startRaft(ctx context.Context) error {
+	config := s.config.Raft
+	if !config.IsEnabled() {
+		return nil
+	}
+	dir := filepath.Join(s.config.Queue.Dir, "raft")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	local := s.members.LocalNode()
+	logOutput := zap.NewStdLog(s.logger.Named("raft")).Writer()
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(local.Name)
+	raftConfig.LogOutput = logOutput
+	if config.SnapshotInterval > 0 {
+		raftConfig.SnapshotInterval = config.SnapshotInterval
+	}
+	if config.SnapshotThreshold > 0 {
+		raftConfig.SnapshotThreshold = config.SnapshotThreshold
+	}
+
+	advertise := &net.TCPAddr{IP: local.Addr, Port: int(config.Port)}
+	transport, err := s.newRaftTransport(fmt.Sprintf("%s:%d", config.Addr, config.Port), advertise, logOutput)
+	if err != nil {
+		return err
+	}
+	store, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		return err
+	}
+	logs, err := raft.NewLogCache(512, store)
+	if err != nil {
+		return err
+	}
+	snapshots, err := raft.NewFileSnapshotStore(dir, raftSnapshotRetain, logOutput)
+	if err != nil {
+		return err
+	}
+	hasState, err := raft.HasExistingState(logs, store, snapshots)
+	if err != nil {
+		return err
+	}
+	r, err := raft.NewRaft(raftConfig, &raftFSM{state: s.raftState}, logs, store, snapshots, transport)
+	if err != nil {
+		return err
+	}
+	s.raft = r
+	s.raftStore = store
+	if hasState {
+		s.markRaftBootstrapped()
+	}
+
+	go s.reconcileRaft(ctx, !hasState && config.BootstrapExpect > 0)
+	return nil
+}
+
+// newRaftTransport raft transport over tcp, it's served over tls with the same certificates as rpc port if configured
+func (s *Server) newRaftTransport(bindAddr string, advertise net.Addr, logOutput io.Writer) (raft.Transport, error) {
+	if s.certs == nil {
+		return raft.NewTCPTransport(bindAddr, advertise, raftTransportMaxPool, raftTransportTimeout, logOutput)
+	}
+	listener, err := tls.Listen("tcp", bindAddr, s.certs.serverConfig())
+	if err != nil {
+		return nil, err
+	}
+	stream := &raftTLSStreamLayer{
+		Listener:  listener,
+		advertise: advertise,
+		server:    s,
+	}
+	return raft.NewNetworkTransport(stream, raftTransportMaxPool, raftTransportTimeout, logOutput), nil
+}
+
+// raftTLSStreamLayer raft stream layer over tls, peers are verified as rpc peers are
+type raftTLSStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	server    *Server
+}
+
+func (l *raftTLSStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+func (l *raftTLSStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	serverName := ""
+	if l.server.config.RPC.TLS.VerifyNodeName {
+		serverName = l.server.raftNodeName(address)
+		if serverName == "" {
+			return nil, fmt.Errorf("unable to verify raft peer %s, it's not a known member", address)
+		}
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), l.server.certs.clientConfig(serverName))
+}
+
+// raftNodeName name of member serving raft at address, empty if there isn't one
+func (s *Server) raftNodeName(address raft.ServerAddress) string {
+	for _, server := range s.raftMembers() {
+		if server.Address == address {
+			return string(server.ID)
+		}
+	}
+	return ""
+}
+
+// markRaftBootstrapped gossips that local node has raft state, so that nodes joining later won't bootstrap another
+// raft group
+func (s *Server) markRaftBootstrapped() {
+	if !s.raftBootstrapped.CAS(false, true) {
+		return
+	}
+	if err := s.members.UpdateNode(raftMetaUpdateTimeout); err != nil {
+		s.logger.Error("unable to gossip raft bootstrapped", zap.Error(err))
+	}
+}
+
+func (s *Server) stopRaft() error {
+	if s.raft == nil {
+		return nil
+	}
+	if err := s.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	return s.raftStore.Close()
+}
+
+// triggerRaftReconcile reconciles voters with membership soon
+func (s *Server) triggerRaftReconcile() {
+	select {
+	case s.raftReconcile <- struct{}{}:
+	default:
+	}
+}
+
+// reconcileRaft bootstraps raft group once enough nodes are discovered, then keeps voters following membership
+// while local node is the leader
+func (s *Server) reconcileRaft(ctx context.Context, needBootstrap bool) {
+	ticker := time.NewTicker(raftReconcileInterval)
+	defer ticker.Stop()
+	for {
+		if needBootstrap {
+			needBootstrap = !s.bootstrapRaft()
+		}
+		if s.raft.Leader() != "" {
+			s.markRaftBootstrapped()
+		}
+		if s.raft.State() == raft.Leader {
+			s.reconcileRaftVoters()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.raftReconcile:
+		case <-s.raft.LeaderCh():
+		}
+	}
+}
+
+// raftMembers alive nodes having raft enabled
+func (s *Server) raftMembers() []raft.Server {
+	var servers []raft.Server
+	for _, member := range s.members.Members() {
+		meta, err := DecodeMeta(member.Meta)
+		if err != nil || meta.RaftPort <= 0 {
+			continue
+		}
+		servers = append(servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(member.Name),
+			Address:  raft.ServerAddress(net.JoinHostPort(member.Addr.String(), fmt.Sprint(meta.RaftPort))),
+		})
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID < servers[j].ID
+	})
+	return servers
+}
+
+// bootstrapRaft bootstraps with every discovered node once there are as many as expected, returns whether it's done.
+// It's skipped if any peer already has raft state, local node is then added by the leader of that group instead.
+func (s *Server) bootstrapRaft() bool {
+	if name := s.bootstrappedRaftPeer(); name != "" {
+		s.logger.Info(fmt.Sprintf("skipped bootstrapping raft, node %s already has raft state", name))
+		return true
+	}
+	servers := s.raftMembers()
+	if len(servers) < s.config.Raft.BootstrapExpect {
+		return false
+	}
+	err := s.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if err != nil && err != raft.ErrCantBootstrap {
+		s.logger.Error("unable to bootstrap raft", zap.Error(err))
+		return false
+	}
+	s.logger.Info(fmt.Sprintf("bootstrapped raft with %d voters", len(servers)))
+	s.markRaftBootstrapped()
+	return true
+}
+
+// bootstrappedRaftPeer name of a peer gossiping that it has raft state, empty if there isn't one
+func (s *Server) bootstrappedRaftPeer() string {
+	localName := s.members.LocalNode().Name
+	for _, member := range s.members.Members() {
+		if member.Name == localName {
+			continue
+		}
+		meta, err := DecodeMeta(member.Meta)
+		if err == nil && meta.RaftBootstrapped {
+			return member.Name
+		}
+	}
+	return ""
+}
+
+func (s *Server) reconcileRaftVoters() {
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		s.logger.Error("unable to get raft configuration", zap.Error(err))
+		return
+	}
+	current := map[raft.ServerID]raft.ServerAddress{}
+	for _, server := range future.Configuration().Servers {
+		current[server.ID] = server.Address
+	}
+
+	members := s.raftMembers()
+	alive := map[raft.ServerID]bool{}
+	for _, member := range members {
+		alive[member.ID] = true
+		if addr, ok := current[member.ID]; ok && addr == member.Address {
+			continue
+		}
+		if err := s.raft.AddVoter(member.ID, member.Address, 0, 0).Error(); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to add raft voter %s", member.ID), zap.Error(err))
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("added raft voter %s(%s)", member.ID, member.Address))
+	}
+
+	localID := raft.ServerID(s.members.LocalNode().Name)
+	for id := range current {
+		if alive[id] || id == localID {
+			continue
+		}
+		if err := s.raft.RemoveServer(id, 0, 0).Error(); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to remove raft voter %s", id), zap.Error(err))
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("removed raft voter %s", id))
+	}
+}
+
+// raftLeaderName node name of current leader, empty if there isn't one
+func (s *Server) raftLeaderName() string {
+	addr := s.raft.Leader()
+	if addr == "" {
+		return ""
+	}
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return ""
+	}
+	for _, server := range future.Configuration().Servers {
+		if server.Address == addr {
+			return string(server.ID)
+		}
+	}
+	return ""
+}
+
+// consensusApply applies command on leader, it's forwarded if local node is not the leader
+func (s *Server) consensusApply(ctx context.Context, cmd *coreConsensus.Command) (*coreConsensus.Result, error) {
+	if s.raft == nil {
+		return nil, errConsensusDisabled
+	}
+	if s.raft.State() == raft.Leader {
+		return s.applyConsensus(cmd)
+	}
+
+	leader := s.raftLeaderName()
+	if leader == "" {
+		return nil, errNoRaftLeader
+	}
+	rpc := s.getRemoteRPC(leader)
+	if rpc == nil {
+		return nil, fmt.Errorf("raft leader %s is not reachable", leader)
+	}
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	res, err := rpc.RPCConsensus(ctx, &proto.ConsensusRequest{Command: b, NodeName: s.members.LocalNode().Name})
+	if err != nil {
+		return nil, err
+	}
+	result := &coreConsensus.Result{}
+	if err := json.Unmarshal(res.Result, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyConsensus applies command as leader, time of leader is attached so that every replica expires leases the same way
+func (s *Server) applyConsensus(cmd *coreConsensus.Command) (*coreConsensus.Result, error) {
+	cmd.Now = time.Now().UnixNano() / int64(time.Millisecond)
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	timeout := s.config.Raft.ApplyTimeout
+	if timeout <= 0 {
+		timeout = defaultRaftApplyTimeout
+	}
+	future := s.raft.Apply(b, timeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	switch res := future.Response().(type) {
+	case error:
+		return nil, res
+	case *coreConsensus.Result:
+		return res, nil
+	}
+	return nil, errors.New("unexpected consensus result")
+}
+
+// RPCConsensus applies command forwarded by followers, it's not forwarded again if local node is not the leader either
+func (s *Server) RPCConsensus(ctx context.Context, req *proto.ConsensusRequest) (*proto.ConsensusResponse, error) {
+	if s.raft == nil {
+		return nil, status.Error(codes.FailedPrecondition, errConsensusDisabled.Error())
+	}
+	if s.raft.State() != raft.Leader {
+		return nil, status.Error(codes.FailedPrecondition, "not raft leader")
+	}
+	cmd := &coreConsensus.Command{}
+	if err := json.Unmarshal(req.Command, cmd); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	res, err := s.applyConsensus(cmd)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ConsensusResponse{Result: b}, nil
+}
+
+var raftStatKeys = []string{"state", "term", "last_log_index", "last_log_term", "commit_index", "applied_index", "last_snapshot_index", "last_snapshot_term", "num_peers"}
+
+func (s *Server) describeRaft() string {
+	if s.raft == nil {
+		return errConsensusDisabled.Error()
+	}
+	lines := []string{fmt.Sprintf("leader: %s(%s)", s.raftLeaderName(), s.raft.Leader())}
+	stats := s.raft.Stats()
+	for _, key := range raftStatKeys {
+		lines = append(lines, fmt.Sprintf("%s: %s", key, stats[key]))
+	}
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err == nil {
+		for _, server := range future.Configuration().Servers {
+			lines = append(lines, fmt.Sprintf("%s: %s(%s)", strings.ToLower(server.Suffrage.String()), server.ID, server.Address))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,6 +1,11 @@
 package server
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
 
 type replyBoxWatch struct {
 	id string
@@ -13,6 +18,9 @@ type ReplyBox struct {
 	watchCh  chan replyBoxWatch
 	replies  map[string]replyBoxWatch
 	watchMu  *sync.RWMutex
+
+	streams   map[string]*ReplyStream
+	streamsMu *sync.RWMutex
 }
 
 func newReplyBox() *ReplyBox {
@@ -22,6 +30,9 @@ func newReplyBox() *ReplyBox {
 		watchCh:  make(chan replyBoxWatch, 64),
 		replies:  map[string]replyBoxWatch{},
 		watchMu:  &sync.RWMutex{},
+
+		streams:   map[string]*ReplyStream{},
+		streamsMu: &sync.RWMutex{},
 	}
 
 	go func() {
@@ -79,6 +90,13 @@ func (b *ReplyBox) Reset() {
 	}
 	b.watchMu.RUnlock()
 	b.replies = map[string]replyBoxWatch{}
+
+	b.streamsMu.Lock()
+	for _, st := range b.streams {
+		st.close()
+	}
+	b.streams = map[string]*ReplyStream{}
+	b.streamsMu.Unlock()
 }
 
 func (b *ReplyBox) Delete(id string) {
@@ -88,3 +106,106 @@ func (b *ReplyBox) Delete(id string) {
 func (b *ReplyBox) Insert(res *RPCResponse) {
 	b.insertCh <- res
 }
+
+const (
+	replyStreamBufferSize = 16
+	// replyStreamMaxPending chunks arrived ahead of sequence held at most, the rest are rejected to be sent again
+	replyStreamMaxPending = 64
+)
+
+var (
+	errReplyStreamClosed = errors.New("reply stream is closed")
+	errReplyStreamFull   = errors.New("reply stream has too many chunks ahead of sequence")
+)
+
+// ReplyStream ordered chunks of a streaming reply
+type ReplyStream struct {
+	ch      chan *RPCResponse
+	done    chan struct{}
+	once    *sync.Once
+	mu      *sync.Mutex
+	next    int64
+	pending map[int64]*RPCResponse
+}
+
+func newReplyStream() *ReplyStream {
+	return &ReplyStream{
+		ch:      make(chan *RPCResponse, replyStreamBufferSize),
+		done:    make(chan struct{}),
+		once:    &sync.Once{},
+		mu:      &sync.Mutex{},
+		pending: map[int64]*RPCResponse{},
+	}
+}
+
+// Chunks returns chunks in order of sequence
+func (st *ReplyStream) Chunks() <-chan *RPCResponse {
+	return st.ch
+}
+
+func (st *ReplyStream) close() {
+	st.once.Do(func() {
+		close(st.done)
+	})
+}
+
+// push delivers chunk and any buffered successors, chunk ahead of sequence is held until its predecessors arrive
+func (st *ReplyStream) push(ctx context.Context, res *RPCResponse) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if res.Seq < st.next {
+		return nil
+	}
+	if res.Seq > st.next {
+		if _, ok := st.pending[res.Seq]; !ok && len(st.pending) >= replyStreamMaxPending {
+			return errReplyStreamFull
+		}
+		st.pending[res.Seq] = res
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-st.done:
+			return errReplyStreamClosed
+		case st.ch <- res:
+		}
+		st.next++
+		next, ok := st.pending[st.next]
+		if !ok {
+			return nil
+		}
+		delete(st.pending, st.next)
+		res = next
+	}
+}
+
+func (b *ReplyBox) WatchStream(id string) *ReplyStream {
+	st := newReplyStream()
+	b.streamsMu.Lock()
+	b.streams[id] = st
+	b.streamsMu.Unlock()
+	return st
+}
+
+func (b *ReplyBox) DeleteStream(id string) {
+	b.streamsMu.Lock()
+	st, ok := b.streams[id]
+	delete(b.streams, id)
+	b.streamsMu.Unlock()
+	if ok {
+		st.close()
+	}
+}
+
+// PushStream delivers a chunk to the watching stream, blocks until there is room in stream buffer
+func (b *ReplyBox) PushStream(ctx context.Context, res *RPCResponse) error {
+	b.streamsMu.RLock()
+	st, ok := b.streams[res.ID]
+	b.streamsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("reply stream \"%s\" not found", res.ID)
+	}
+	return st.push(ctx, res)
+}
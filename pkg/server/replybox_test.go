@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReplyStream", func() {
+	It("should deliver chunks in order", func() {
+		st := newReplyStream()
+		Expect(st.push(context.Background(), &RPCResponse{Seq: 1})).To(Succeed())
+		Expect(st.push(context.Background(), &RPCResponse{Seq: 0})).To(Succeed())
+		Expect((<-st.Chunks()).Seq).To(Equal(int64(0)))
+		Expect((<-st.Chunks()).Seq).To(Equal(int64(1)))
+	})
+
+	It("should bound chunks ahead of sequence", func() {
+		st := newReplyStream()
+		for seq := int64(1); seq <= replyStreamMaxPending; seq++ {
+			Expect(st.push(context.Background(), &RPCResponse{Seq: seq})).To(Succeed())
+		}
+		Expect(st.push(context.Background(), &RPCResponse{Seq: replyStreamMaxPending + 1})).To(Equal(errReplyStreamFull))
+		Expect(st.push(context.Background(), &RPCResponse{Seq: 1})).To(Succeed())
+	})
+})
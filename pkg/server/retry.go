@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryableCodes error classes can be used in retry policy, by names of coreRPC.RetryErrors
+var retryableCodes = map[string]codes.Code{
+	"unknown":            codes.Unknown,
+	"deadline_exceeded":  codes.DeadlineExceeded,
+	"resource_exhausted": codes.ResourceExhausted,
+	"aborted":            codes.Aborted,
+	"internal":           codes.Internal,
+	"unavailable":        codes.Unavailable,
+}
+
+var defaultRetryOn = []string{"unavailable", "resource_exhausted", "aborted"}
+
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	on         map[codes.Code]bool
+}
+
+// retryPolicy merges policy of call with default policy from config
+func (s *Server) retryPolicy(override *coreRPC.RetryPolicy) *retryPolicy {
+	config := s.config.RPC.Retry
+	attempts := config.Attempts
+	backoff := config.Backoff
+	maxBackoff := config.MaxBackoff
+	on := config.On
+	if override != nil {
+		if override.Attempts > 0 {
+			attempts = override.Attempts
+		}
+		if override.Backoff > 0 {
+			backoff = override.Backoff
+		}
+		if override.MaxBackoff > 0 {
+			maxBackoff = override.MaxBackoff
+		}
+		if len(override.On) > 0 {
+			on = override.On
+		}
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	if len(on) == 0 {
+		on = defaultRetryOn
+	}
+
+	p := &retryPolicy{
+		attempts:   attempts,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		on:         map[codes.Code]bool{},
+	}
+	for _, name := range on {
+		if code, ok := retryableCodes[strings.ToLower(name)]; ok {
+			p.on[code] = true
+		}
+	}
+	return p
+}
+
+func (p *retryPolicy) isRetryable(attempt int, err error) bool {
+	if attempt >= p.attempts {
+		return false
+	}
+	return p.on[status.Code(err)]
+}
+
+// wait sleeps exponential backoff before next attempt, returns false if the wait would exceed deadline of request
+func (p *retryPolicy) wait(ctx context.Context, attempt int, expiresAt time.Time) bool {
+	backoff := p.backoff << uint(attempt-1)
+	if p.maxBackoff > 0 && (backoff > p.maxBackoff || backoff <= 0) {
+		backoff = p.maxBackoff
+	}
+	if !expiresAt.IsZero() && time.Now().Add(backoff).After(expiresAt) {
+		return false
+	}
+	if backoff <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
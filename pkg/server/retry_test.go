@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Retry", func() {
+	newServer := func(config RetryConfig) *Server {
+		return &Server{config: &Config{RPC: RPCConfig{Retry: config}}}
+	}
+
+	It("should merge policy of call with config", func() {
+		s := newServer(RetryConfig{Attempts: 2, Backoff: time.Second, MaxBackoff: time.Minute, On: []string{"internal"}})
+		p := s.retryPolicy(nil)
+		Expect(p.attempts).To(Equal(2))
+		Expect(p.backoff).To(Equal(time.Second))
+		Expect(p.maxBackoff).To(Equal(time.Minute))
+		Expect(p.on).To(Equal(map[codes.Code]bool{codes.Internal: true}))
+
+		p = s.retryPolicy(&coreRPC.RetryPolicy{Attempts: 5, Backoff: time.Millisecond, On: []string{"Unavailable", "aborted"}})
+		Expect(p.attempts).To(Equal(5))
+		Expect(p.backoff).To(Equal(time.Millisecond))
+		Expect(p.maxBackoff).To(Equal(time.Minute))
+		Expect(p.on).To(Equal(map[codes.Code]bool{codes.Unavailable: true, codes.Aborted: true}))
+
+		p = newServer(RetryConfig{}).retryPolicy(nil)
+		Expect(p.attempts).To(Equal(1))
+		Expect(p.on).To(Equal(map[codes.Code]bool{codes.Unavailable: true, codes.ResourceExhausted: true, codes.Aborted: true}))
+	})
+
+	It("should retry errors it's on until attempts are used up", func() {
+		p := newServer(RetryConfig{Attempts: 3}).retryPolicy(nil)
+		unavailable := status.Error(codes.Unavailable, "unavailable")
+		Expect(p.isRetryable(1, unavailable)).To(BeTrue())
+		Expect(p.isRetryable(2, unavailable)).To(BeTrue())
+		Expect(p.isRetryable(3, unavailable)).To(BeFalse())
+		Expect(p.isRetryable(1, status.Error(codes.InvalidArgument, "invalid"))).To(BeFalse())
+		Expect(p.isRetryable(1, errors.New("plain"))).To(BeFalse())
+	})
+
+	It("should back off exponentially up to max backoff", func() {
+		p := newServer(RetryConfig{Attempts: 5, Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}).retryPolicy(nil)
+		var waited []time.Duration
+		for attempt := 1; attempt <= 4; attempt++ {
+			start := time.Now()
+			Expect(p.wait(context.Background(), attempt, time.Time{})).To(BeTrue())
+			waited = append(waited, time.Since(start))
+		}
+		Expect(waited[0]).To(BeNumerically(">=", 10*time.Millisecond))
+		Expect(waited[1]).To(BeNumerically(">=", 20*time.Millisecond))
+		Expect(waited[2]).To(BeNumerically(">=", 30*time.Millisecond))
+		Expect(waited[3]).To(BeNumerically("<", 40*time.Millisecond))
+	})
+
+	It("should not wait past deadline or after cancel", func() {
+		p := newServer(RetryConfig{Attempts: 5, Backoff: time.Second}).retryPolicy(nil)
+		start := time.Now()
+		Expect(p.wait(context.Background(), 1, time.Now().Add(500*time.Millisecond))).To(BeFalse())
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		Expect(p.wait(ctx, 1, time.Time{})).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+	})
+
+	It("should stop retrying loop once error is not retryable", func() {
+		p := newServer(RetryConfig{Attempts: 5}).retryPolicy(nil)
+		errs := []error{
+			status.Error(codes.Unavailable, "unavailable"),
+			status.Error(codes.Aborted, "aborted"),
+			status.Error(codes.NotFound, "not found"),
+			nil,
+		}
+		attempts := 0
+		for attempt := 1; ; attempt++ {
+			attempts++
+			err := errs[attempt-1]
+			if err == nil || !p.isRetryable(attempt, err) || !p.wait(context.Background(), attempt, time.Time{}) {
+				break
+			}
+		}
+		Expect(attempts).To(Equal(3))
+	})
+})
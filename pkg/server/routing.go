@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// RouteCandidate a node offering the requested service
+type RouteCandidate struct {
+	NodeName string
+	Weight   float64
+	Load     *LoadBroadcast
+}
+
+func (c *RouteCandidate) score() float64 {
+	if c.Load == nil {
+		return 0
+	}
+	return c.Load.score()
+}
+
+// Router picks target node for a rpc call among candidates, candidates are never empty
+type Router interface {
+	Route(candidates []*RouteCandidate) *RouteCandidate
+}
+
+type RouterFunc func(candidates []*RouteCandidate) *RouteCandidate
+
+func (f RouterFunc) Route(candidates []*RouteCandidate) *RouteCandidate {
+	return f(candidates)
+}
+
+const (
+	RoutingRandom      = "random"
+	RoutingLeastLoaded = "least-loaded"
+	RoutingP2C         = "p2c"
+	RoutingWeighted    = "weighted"
+)
+
+func NewRouter(name string) (Router, error) {
+	switch name {
+	case "", RoutingRandom:
+		return RouterFunc(routeRandom), nil
+	case RoutingLeastLoaded:
+		return RouterFunc(routeLeastLoaded), nil
+	case RoutingP2C:
+		return RouterFunc(routeP2C), nil
+	case RoutingWeighted:
+		return RouterFunc(routeWeighted), nil
+	}
+	return nil, fmt.Errorf("unknown routing strategy \"%s\"", name)
+}
+
+func pickWeighted(candidates []*RouteCandidate, weight func(*RouteCandidate) float64) *RouteCandidate {
+	var totalWeight float64
+	for _, c := range candidates {
+		totalWeight += weight(c)
+	}
+
+	targetWeight := rand.Float64() * totalWeight
+	var currentWeight float64
+	for _, c := range candidates {
+		currentWeight += weight(c)
+		if currentWeight >= targetWeight {
+			return c
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// routeRandom random choice by registered weight
+func routeRandom(candidates []*RouteCandidate) *RouteCandidate {
+	return pickWeighted(candidates, func(c *RouteCandidate) float64 {
+		return c.Weight
+	})
+}
+
+// routeWeighted random choice by registered weight, discounted by reported load
+func routeWeighted(candidates []*RouteCandidate) *RouteCandidate {
+	return pickWeighted(candidates, func(c *RouteCandidate) float64 {
+		return c.Weight / (1 + c.score())
+	})
+}
+
+// routeLeastLoaded picks the node with lowest reported load, ties are broken randomly
+func routeLeastLoaded(candidates []*RouteCandidate) *RouteCandidate {
+	offset := rand.Intn(len(candidates))
+	best := candidates[offset]
+	for i := 1; i < len(candidates); i++ {
+		c := candidates[(offset+i)%len(candidates)]
+		if c.score() < best.score() {
+			best = c
+		}
+	}
+	return best
+}
+
+// routeP2C power of two choices, picks the less loaded one out of two random nodes
+func routeP2C(candidates []*RouteCandidate) *RouteCandidate {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	if candidates[j].score() < candidates[i].score() {
+		return candidates[j]
+	}
+	return candidates[i]
+}
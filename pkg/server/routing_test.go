@@ -0,0 +1,111 @@
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Router", func() {
+	const rounds = 10000
+
+	loaded := func(name string, weight float64, depth int64) *RouteCandidate {
+		return &RouteCandidate{
+			NodeName: name,
+			Weight:   weight,
+			Load:     &LoadBroadcast{NodeName: name, InboxDepth: depth, Workers: 1},
+		}
+	}
+
+	count := func(router Router, candidates []*RouteCandidate) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < rounds; i++ {
+			counts[router.Route(candidates).NodeName]++
+		}
+		return counts
+	}
+
+	newRouter := func(name string) Router {
+		router, err := NewRouter(name)
+		Expect(err).To(BeNil())
+		return router
+	}
+
+	It("should reject unknown strategies", func() {
+		_, err := NewRouter("round-robin")
+		Expect(err).NotTo(BeNil())
+		Expect((&Config{RPC: RPCConfig{Routing: "least-load"}}).Validate()).NotTo(Succeed())
+		Expect((&Config{RPC: RPCConfig{Retry: RetryConfig{On: []string{"timeout"}}}}).Validate()).NotTo(Succeed())
+		Expect((&Config{RPC: RPCConfig{Routing: RoutingP2C, Retry: RetryConfig{On: []string{"Unavailable"}}}}).Validate()).To(Succeed())
+		Expect((&Config{}).Validate()).To(Succeed())
+	})
+
+	It("should pick by registered weight randomly", func() {
+		counts := count(newRouter(RoutingRandom), []*RouteCandidate{
+			loaded("a", 1, 100),
+			loaded("b", 3, 0),
+		})
+		Expect(float64(counts["b"]) / rounds).To(BeNumerically("~", 0.75, 0.05))
+	})
+
+	It("should discount weight by load", func() {
+		counts := count(newRouter(RoutingWeighted), []*RouteCandidate{
+			loaded("a", 1, 0),
+			loaded("b", 1, 1),
+		})
+		// weights are 1 and 1/2
+		Expect(float64(counts["a"]) / rounds).To(BeNumerically("~", 2.0/3, 0.05))
+	})
+
+	It("should pick the least loaded node", func() {
+		counts := count(newRouter(RoutingLeastLoaded), []*RouteCandidate{
+			loaded("a", 1, 5),
+			loaded("b", 1, 1),
+			loaded("c", 1, 3),
+		})
+		Expect(counts).To(Equal(map[string]int{"b": rounds}))
+	})
+
+	It("should pick the less loaded one of two", func() {
+		counts := count(newRouter(RoutingP2C), []*RouteCandidate{
+			loaded("a", 1, 5),
+			loaded("b", 1, 1),
+			loaded("c", 1, 3),
+		})
+		// the most loaded node loses every pair it's in
+		Expect(counts["a"]).To(BeZero())
+		// the least loaded node wins every pair it's in, 2 out of 3 pairs
+		Expect(float64(counts["b"]) / rounds).To(BeNumerically("~", 2.0/3, 0.05))
+	})
+
+	It("should spread equal loads evenly", func() {
+		for _, name := range []string{RoutingLeastLoaded, RoutingP2C, RoutingWeighted} {
+			counts := count(newRouter(name), []*RouteCandidate{
+				loaded("a", 1, 2),
+				loaded("b", 1, 2),
+			})
+			Expect(float64(counts["a"])/rounds).To(BeNumerically("~", 0.5, 0.05), name)
+		}
+	})
+
+	It("should treat nodes without load report as idle", func() {
+		candidates := []*RouteCandidate{
+			loaded("a", 1, 1),
+			{NodeName: "b", Weight: 1},
+		}
+		Expect(count(newRouter(RoutingLeastLoaded), candidates)).To(Equal(map[string]int{"b": rounds}))
+		Expect(count(newRouter(RoutingP2C), candidates)).To(Equal(map[string]int{"b": rounds}))
+	})
+
+	It("should pick the only candidate", func() {
+		for _, name := range []string{RoutingRandom, RoutingLeastLoaded, RoutingP2C, RoutingWeighted} {
+			Expect(newRouter(name).Route([]*RouteCandidate{loaded("a", 1, 9)}).NodeName).To(Equal("a"), name)
+		}
+	})
+
+	It("should still pick a node when every weight is zero", func() {
+		candidates := []*RouteCandidate{loaded("a", 0, 0), loaded("b", 0, 0)}
+		for _, name := range []string{RoutingRandom, RoutingWeighted} {
+			Expect(newRouter(name).Route(candidates)).NotTo(BeNil(), name)
+		}
+	})
+})
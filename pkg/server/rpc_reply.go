@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/joesonw/drlee/pkg/utils"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
 	"github.com/joesonw/drlee/proto"
 	"go.uber.org/zap"
 )
@@ -19,6 +19,20 @@ type RPCRequest struct {
 	Timeout    time.Duration
 	NodeName   string
 	IsLoopBack bool
+	IsStream   bool
+	Codec      string
+	// DeliverAt request is kept in delayed inbox until then, zero means immediately
+	DeliverAt time.Time
+	// Priority requests of higher priority are handed to workers first
+	Priority coreRPC.Priority
+	// IdempotencyKey duplicate calls of the same method and key get reply of the first one
+	IdempotencyKey string
+	// Key request was routed by, actor messages are handed to mailbox of actor of key
+	Key string
+	// IsOneWay caller doesn't wait for reply
+	IsOneWay bool
+	// BroadcastIDs ids of requests handed to each worker, they are assigned before a delayed broadcast is persisted
+	BroadcastIDs []string
 }
 
 type RPCResponse struct {
@@ -27,6 +41,13 @@ type RPCResponse struct {
 	Timestamp time.Time
 	NodeName  string
 	IsError   bool
+	IsStream  bool
+	Seq       int64
+	IsEnd     bool
+	// ExpiresAt caller gives up waiting for reply, zero if it waits without timeout
+	ExpiresAt time.Time
+	// Attempts failed attempts of sending reply
+	Attempts int
 }
 
 //nolint:gochecknoinits
@@ -35,38 +56,18 @@ func init() {
 	gob.Register(&RPCResponse{})
 }
 
+// StartReplyWorkers starts sending replies queued in outbox
 func (s *Server) StartReplyWorkers() {
-	concurrency := s.config.RPC.ReplyConcurrency
-	if concurrency < 1 {
-		concurrency = 1
-	}
-	for i := 0; i < concurrency; i++ {
-		go s.replyWorker(i)
+	if err := s.outbox.Start(); err != nil {
+		s.logger.Error("unable to start outbox", zap.Error(err))
 	}
 }
 
-func (s *Server) replyWorker(i int) {
-	logger := s.logger.Named(fmt.Sprintf("reply-%d", i))
-	logger.Info("reply worker started")
-	ch := s.outboxQueue.ReadChan()
-	for data := range ch {
-		if err := s.doReply(context.TODO(), logger, data); err != nil {
-			logger.Error("unable to do reply", zap.Error(err))
-		}
-	}
-}
-
-func (s *Server) doReply(ctx context.Context, logger *zap.Logger, data []byte) error {
-	res := &RPCResponse{}
-	if err := utils.UnmarshalGOB(data, res); err != nil {
-		return err
-	}
-
-	logger.Sugar().Debugf("reply worker received rpc %s to node %s", res.ID, res.NodeName)
+// sendReply sends reply to caller node
+func (s *Server) sendReply(ctx context.Context, res *RPCResponse) error {
 	rpc := s.getRemoteRPC(res.NodeName)
 	if rpc == nil {
-		logger.Warn(fmt.Sprintf("remote \"%s\": not found", res.NodeName))
-		return nil
+		return fmt.Errorf("remote \"%s\": %w", res.NodeName, errRemoteNotFound)
 	}
 
 	_, err := rpc.RPCReply(ctx, &proto.ReplyRequest{
@@ -74,6 +75,53 @@ func (s *Server) doReply(ctx context.Context, logger *zap.Logger, data []byte) e
 		Result:        res.Result,
 		TimestampNano: res.Timestamp.UnixNano(),
 		IsError:       res.IsError,
+		NodeName:      s.members.LocalNode().Name,
+	})
+	return err
+}
+
+// replyStream sends a chunk of streaming reply directly to caller, bypassing outbox so that it's ordered and
+// blocked by caller's consumption.
+func (s *Server) replyStream(req *coreRPC.Request, seq int64, res *coreRPC.Response) error {
+	r := &RPCResponse{
+		ID:        req.ID,
+		Timestamp: time.Now(),
+		NodeName:  req.NodeName,
+		IsStream:  true,
+		Seq:       seq,
+		IsEnd:     res.IsEnd,
+	}
+	if res.Error != nil {
+		r.IsError = true
+		r.Result = []byte(res.Error.Error())
+	} else {
+		r.Result = res.Body
+	}
+
+	ctx := context.Background()
+	if exp := req.ExpiresAt; !exp.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, exp)
+		defer cancel()
+	}
+
+	if req.IsLoopBack {
+		return s.replybox.PushStream(ctx, r)
+	}
+
+	rpc := s.getRemoteRPC(req.NodeName)
+	if rpc == nil {
+		return fmt.Errorf("remote \"%s\": not found", req.NodeName)
+	}
+	_, err := rpc.RPCReply(ctx, &proto.ReplyRequest{
+		ID:            r.ID,
+		Result:        r.Result,
+		TimestampNano: r.Timestamp.UnixNano(),
+		IsError:       r.IsError,
+		IsStream:      true,
+		Seq:           r.Seq,
+		IsEnd:         r.IsEnd,
+		NodeName:      s.members.LocalNode().Name,
 	})
 	return err
 }
@@ -4,23 +4,45 @@ import (
 	"context"
 	"time"
 
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
 	"github.com/joesonw/drlee/proto"
 	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (s *Server) RPCCall(ctx context.Context, req *proto.CallRequest) (res *proto.CallResponse, err error) {
+	if err = s.admit(req.Name, req.Key); err != nil {
+		s.logger.Sugar().Debugf("rejected RPCCall [%s] '%s' from node (%s): %s", req.ID, req.Name, req.NodeName, err)
+		return nil, err
+	}
+	id := req.ID
+	if id == "" {
+		id = uuid.NewV4().String()
+	}
 	call := &RPCRequest{
-		ID:        uuid.NewV4().String(),
-		Name:      req.Name,
-		Body:      req.Body,
-		Timestamp: time.Now(),
-		Timeout:   time.Millisecond * time.Duration(req.TimeoutMilliseconds),
-		NodeName:  req.NodeName,
+		ID:             id,
+		Name:           req.Name,
+		Body:           req.Body,
+		Timestamp:      time.Now(),
+		Timeout:        time.Millisecond * time.Duration(req.TimeoutMilliseconds),
+		NodeName:       req.NodeName,
+		IsStream:       req.IsStream,
+		Codec:          req.Codec,
+		DeliverAt:      timeFromUnixNano(req.DeliverAtUnixNano),
+		Priority:       coreRPC.Priority(req.Priority),
+		IdempotencyKey: req.IdempotencyKey,
+		Key:            req.Key,
+		IsOneWay:       req.IsOneWay,
 	}
 	s.logger.Sugar().Debugf("received RPCCall [%s] '%s' from node (%s)", call.ID, req.NodeName, req.NodeName)
-	err = s.inbox.Put(call)
-	if err != nil {
-		return
+	// duplicates are acknowledged, they are replied with reply of the original call
+	if !s.deduplicate(call, false) {
+		err = s.inbox.Put(call)
+		if err != nil {
+			s.idempotency.abort(call.ID)
+			return
+		}
 	}
 
 	res = &proto.CallResponse{
@@ -35,13 +57,18 @@ func (s *Server) RPCBroadcast(ctx context.Context, req *proto.BroadcastRequest)
 		TimestampNano: time.Now().UnixNano(),
 	}
 
-	res.IDLst = s.inbox.Broadcast(&RPCRequest{
+	res.IDLst, err = s.inbox.Broadcast(&RPCRequest{
 		Name:      req.Name,
 		Body:      req.Body,
 		Timestamp: time.Now(),
 		Timeout:   time.Millisecond * time.Duration(req.TimeoutMilliseconds),
 		NodeName:  req.NodeName,
+		Codec:     req.Codec,
+		DeliverAt: timeFromUnixNano(req.DeliverAtUnixNano),
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return
 }
@@ -50,12 +77,37 @@ func (s *Server) RPCReply(ctx context.Context, req *proto.ReplyRequest) (res *pr
 	res = &proto.ReplyResponse{}
 	s.logger.Sugar().Debugf("received RPCReply [%s]", req.ID)
 
-	s.replybox.Insert(&RPCResponse{
+	reply := &RPCResponse{
 		ID:        req.ID,
 		Result:    req.Result,
 		Timestamp: time.Unix(0, req.TimestampNano),
 		IsError:   req.IsError,
-	})
+		IsStream:  req.IsStream,
+		Seq:       req.Seq,
+		IsEnd:     req.IsEnd,
+	}
+	if reply.IsStream {
+		// blocks until caller consumes the chunk, which applies backpressure on the streaming node
+		if err = s.replybox.PushStream(ctx, reply); err != nil {
+			if err == errReplyStreamFull {
+				return nil, status.Error(codes.ResourceExhausted, err.Error())
+			}
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return
+	}
+	s.replybox.Insert(reply)
 
 	return
 }
+
+func (s *Server) RPCCancel(ctx context.Context, req *proto.CancelRequest) (res *proto.CancelResponse, err error) {
+	s.logger.Sugar().Debugf("received RPCCancel [%s] from node (%s)", req.ID, req.NodeName)
+	if req.NodeName == "" {
+		return nil, status.Error(codes.PermissionDenied, "cancel names no node")
+	}
+	if err := s.inbox.Cancel(req.ID, req.NodeName); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return &proto.CancelResponse{}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,9 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
 	"github.com/joesonw/drlee/proto"
 	diskqueue "github.com/nsqio/go-diskqueue"
 	"go.uber.org/zap"
@@ -31,26 +35,55 @@ func _() {
 
 // Server Dr.LEE server handles lua execution environment, rpc debugging and metrics, etc.
 type Server struct {
-	config      *Config
-	meta        Meta
-	members     *memberlist.Memberlist
-	broadcasts  *memberlist.TransmitLimitedQueue
-	outboxQueue diskqueue.Interface
-	logger      *zap.Logger
-	plugins     []plugin.Interface
+	config     *Config
+	meta       Meta
+	members    *memberlist.Memberlist
+	broadcasts *memberlist.TransmitLimitedQueue
+	logger     *zap.Logger
+	plugins    []plugin.Interface
+	certs      *Certificates
 
 	deferredMembers func() *memberlist.Memberlist
 	endpoints       map[string]*grpc.ClientConn
 	endpointRPCs    map[string]proto.RPCClient
+	endpointMetas   map[string]Meta
+	breakers        map[string]*CircuitBreaker
 	endpointMu      *sync.RWMutex
 	services        map[string]map[string]float64
+	serviceCodecs   map[string]map[string]string
 	servicesMu      *sync.RWMutex
 	localServices   map[string]float64
+	localCodecs     map[string]string
 	localServicesMu *sync.RWMutex
+	loads           map[string]*LoadBroadcast
+	overloaded      map[string]time.Time
+	loadsMu         *sync.RWMutex
+	router          Router
+	rings           map[string]*HashRing
+	ringsMu         *sync.Mutex
+	subscriptions   map[string]map[string]bool
+	subscriptionsMu *sync.RWMutex
+	publishes       chan *pendingPublish
 
-	replybox  *ReplyBox
-	inbox     *Inbox
-	listeners *ListenerManager
+	replybox    *ReplyBox
+	inbox       *Inbox
+	outbox      *Outbox
+	deadLetters *DeadLetters
+	topics      *Topics
+	kv          *KVStore
+	crdts       *CRDTs
+	idempotency *IdempotencyTable
+	jobs        *Jobs
+	workflows   *Workflows
+	actors      *Actors
+
+	raft          *raft.Raft
+	raftStore     *raftboltdb.BoltStore
+	raftState     *coreConsensus.State
+	raftReconcile chan struct{}
+	// raftBootstrapped whether local node has raft state, gossiped in meta
+	raftBootstrapped *atomic.Bool
+	listeners        *ListenerManager
 
 	luaRunWg            *sync.WaitGroup
 	luaScript           string
@@ -61,37 +94,77 @@ type Server struct {
 }
 
 //nolint:gocritic
-// New creates an new Server
-func New(config *Config, deferredMembers func() *memberlist.Memberlist, inboxQueue diskqueue.Interface, outboxQueue diskqueue.Interface, logger *zap.Logger, plugins []plugin.Interface) *Server {
+// New creates an new Server out of validated config, certs is nil if rpc port is not served over tls
+func New(config *Config, deferredMembers func() *memberlist.Memberlist, newQueue QueueFactory, outboxQueue diskqueue.Interface, deadLetterQueue diskqueue.Interface, logger *zap.Logger, plugins []plugin.Interface, certs *Certificates) *Server {
 	if config.Concurrency < 1 {
 		config.Concurrency = 1
 	}
-	return &Server{
+	deadLetters := newDeadLetters(filepath.Join(config.Queue.Dir, "dead-letters"), deadLetterQueue, logger.Named("dead-letters"))
+	// routing is validated along with config, see Config.Validate
+	router, err := NewRouter(config.RPC.Routing)
+	if err != nil {
+		logger.Error("falling back to random routing", zap.Error(err))
+		router, _ = NewRouter(RoutingRandom)
+	}
+	s := &Server{
 		config: config,
 		meta: Meta{
-			RPCPort: config.RPC.Port,
+			RPCPort:  config.RPC.Port,
+			RaftPort: config.Raft.Port,
+			Labels:   config.Labels,
 		},
-		outboxQueue: outboxQueue,
-		logger:      logger,
-		plugins:     plugins,
+		logger:  logger,
+		plugins: plugins,
+		certs:   certs,
 
 		deferredMembers: deferredMembers,
 		endpoints:       map[string]*grpc.ClientConn{},
 		endpointRPCs:    map[string]proto.RPCClient{},
+		endpointMetas:   map[string]Meta{},
+		breakers:        map[string]*CircuitBreaker{},
 		endpointMu:      &sync.RWMutex{},
 		services:        map[string]map[string]float64{},
+		serviceCodecs:   map[string]map[string]string{},
 		servicesMu:      &sync.RWMutex{},
 		localServices:   map[string]float64{},
+		localCodecs:     map[string]string{},
 		localServicesMu: &sync.RWMutex{},
+		loads:           map[string]*LoadBroadcast{},
+		overloaded:      map[string]time.Time{},
+		loadsMu:         &sync.RWMutex{},
+		router:          router,
+		rings:           map[string]*HashRing{},
+		ringsMu:         &sync.Mutex{},
+		subscriptions:   map[string]map[string]bool{},
+		subscriptionsMu: &sync.RWMutex{},
+		publishes:       make(chan *pendingPublish, publishQueueSize),
 
-		replybox:  newReplyBox(),
-		inbox:     newInbox(inboxQueue),
-		listeners: newListenerManager(logger),
+		replybox:    newReplyBox(),
+		inbox:       newInbox(config.Queue.Inbox, config.Queue.Dir, newQueue, newDelayedInbox(filepath.Join(config.Queue.Dir, "delayed"), logger), deadLetters),
+		deadLetters: deadLetters,
+		topics:      newTopics(),
+		kv:          newKVStore(filepath.Join(config.Queue.Dir, "kv.json"), logger),
+		crdts:       newCRDTs(filepath.Join(config.Queue.Dir, "crdt.json"), logger),
+		idempotency: newIdempotencyTable(config.RPC.Idempotency, filepath.Join(config.Queue.Dir, "idempotency.json"), logger),
+
+		raftState:        coreConsensus.NewState(),
+		raftReconcile:    make(chan struct{}, 1),
+		raftBootstrapped: atomic.NewBool(false),
+		listeners:        newListenerManager(logger),
 
 		luaRunWg:       &sync.WaitGroup{},
 		isLuaReloading: atomic.NewBool(false),
 		isDebug:        strings.EqualFold(os.Getenv("DEBUG"), "true"),
 	}
+	s.outbox = newOutbox(config.RPC.ReplyRetry, config.RPC.ReplyConcurrency, config.Queue.Dir, newQueue, outboxQueue, s.sendReply, deadLetters, logger.Named("outbox"))
+	s.jobs = newJobs(config.Queue.Jobs, config.Queue.Dir, newQueue, s.forwardJob, deadLetters, logger.Named("jobs"))
+	s.workflows = newWorkflows(config.Queue.Workflow, config.Queue.Dir, newQueue, s.luaRPCCall, logger.Named("workflows"))
+	s.actors = newActors(config.RPC.Actor, s.inbox, s.isActorOwner, logger.Named("actors"))
+	s.inbox.route = s.actors.Put
+	s.inbox.deduplicate = func(req *RPCRequest) bool {
+		return s.deduplicate(req, true)
+	}
+	return s
 }
 
 // Start start the server
@@ -101,13 +174,67 @@ func (s *Server) Start(ctx context.Context) error {
 		NumNodes:       s.members.NumMembers,
 		RetransmitMult: 3,
 	}
+	if err := s.deadLetters.Start(); err != nil {
+		return err
+	}
+	s.startLoadReport(ctx)
+	s.startPublishers(ctx)
+	if err := s.kv.Load(); err != nil {
+		return err
+	}
+	s.kv.startFlush(ctx)
+	if err := s.crdts.Load(); err != nil {
+		return err
+	}
+	s.crdts.startFlush(ctx)
+	if err := s.idempotency.Load(); err != nil {
+		return err
+	}
+	s.idempotency.startFlush(ctx)
+	if err := s.inbox.startDispatch(ctx); err != nil {
+		return err
+	}
+	if err := s.inbox.startDelayed(ctx); err != nil {
+		return err
+	}
+	s.inbox.startSweep(ctx, s.giveUpCall)
+	if err := s.jobs.Start(ctx); err != nil {
+		return err
+	}
+	if s.config.Raft.IsEnabled() {
+		s.workflows.replica = &workflowReplica{
+			nodeName: s.members.LocalNode().Name,
+			apply:    s.consensusApply,
+			entries:  s.raftState.Entries,
+			isAlive:  s.isAlive,
+		}
+	}
+	if err := s.workflows.Start(ctx); err != nil {
+		return err
+	}
+	s.actors.startSweep(ctx)
+	if err := s.startRaft(ctx); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // Stop stop the server
 func (s *Server) Stop(ctx context.Context) error {
-	return nil
+	if s.certs != nil {
+		s.certs.Close()
+	}
+	if err := s.stopRaft(); err != nil {
+		return err
+	}
+	if err := s.kv.Flush(); err != nil {
+		return err
+	}
+	if err := s.idempotency.Flush(); err != nil {
+		return err
+	}
+	return s.crdts.Flush()
 }
 
 // handleRegistryBroadcast parse registry broadcast from peer
@@ -118,34 +245,59 @@ func (s *Server) handleRegistryBroadcast(broadcast *RegistryBroadcast) {
 	}
 	if broadcast.IsDeleted {
 		delete(s.services[broadcast.Name], broadcast.NodeName)
+		s.deleteServiceCodec(broadcast.Name, broadcast.NodeName)
 		s.logger.Info(fmt.Sprintf("removed service \"%s\" on node %s", broadcast.Name, broadcast.NodeName))
 	} else {
 		s.services[broadcast.Name][broadcast.NodeName] = broadcast.Weight
+		if broadcast.Codec != "" {
+			if _, ok := s.serviceCodecs[broadcast.Name]; !ok {
+				s.serviceCodecs[broadcast.Name] = map[string]string{}
+			}
+			s.serviceCodecs[broadcast.Name][broadcast.NodeName] = broadcast.Codec
+		} else {
+			s.deleteServiceCodec(broadcast.Name, broadcast.NodeName)
+		}
 		s.logger.Info(fmt.Sprintf("discovered service \"%s\" on node %s with weight %f", broadcast.Name, broadcast.NodeName, broadcast.Weight))
 	}
 	s.servicesMu.Unlock()
+	s.invalidateRings(broadcast.Name)
 }
 
-func (s *Server) handleNode(node *memberlist.Node) *Endpoint {
+// handleNode dials rpc service of node, nodes whose meta can't be decoded are not dialed
+func (s *Server) handleNode(node *memberlist.Node) (*Endpoint, error) {
 	s.endpointMu.Lock()
 	defer s.endpointMu.Unlock()
+	meta, err := DecodeMeta(node.Meta)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode meta of node %s: %w", node.Name, err)
+	}
 	ep := &Endpoint{
 		Name: node.Name,
 		Addr: node.Address(),
-		Meta: DecodeMeta(node.Meta),
+		Meta: meta,
 	}
 	if cc, ok := s.endpoints[node.Name]; ok {
 		if err := cc.Close(); err != nil {
 			s.logger.Error("unable to close grpc connection", zap.Error(err))
 		}
 	}
-	cc, err := grpc.Dial(fmt.Sprintf("%s:%d", node.Addr.String(), ep.Meta.RPCPort), grpc.WithInsecure())
+	cc, err := grpc.Dial(fmt.Sprintf("%s:%d", node.Addr.String(), ep.Meta.RPCPort), s.dialOption(node.Name))
 	if err != nil {
-		s.logger.Fatal("unable to dial remote rpc service", zap.Error(err))
+		return nil, fmt.Errorf("unable to dial rpc service of node %s: %w", node.Name, err)
+	}
+	breaker, ok := s.breakers[node.Name]
+	if !ok {
+		breaker = NewCircuitBreaker(s.config.RPC.CircuitBreaker.Threshold, s.config.RPC.CircuitBreaker.Cooldown)
+		s.breakers[node.Name] = breaker
 	}
 	s.endpoints[node.Name] = cc
-	s.endpointRPCs[node.Name] = proto.NewRPCClient(cc)
-	return ep
+	s.endpointMetas[node.Name] = meta
+	s.endpointRPCs[node.Name] = &breakerRPCClient{
+		RPCClient: proto.NewRPCClient(cc),
+		nodeName:  node.Name,
+		breaker:   breaker,
+	}
+	return ep, nil
 }
 
 func (s *Server) getRemoteRPC(nodeName string) proto.RPCClient {
@@ -153,3 +305,32 @@ func (s *Server) getRemoteRPC(nodeName string) proto.RPCClient {
 	defer s.endpointMu.RUnlock()
 	return s.endpointRPCs[nodeName]
 }
+
+// isAlive whether node is local node or a peer not detected to have left
+func (s *Server) isAlive(nodeName string) bool {
+	return nodeName == s.members.LocalNode().Name || s.getRemoteRPC(nodeName) != nil
+}
+
+// serviceCodec codec registered with service, by local node if it offers the service
+func (s *Server) serviceCodec(name string) string {
+	s.localServicesMu.RLock()
+	codec, ok := s.localCodecs[name]
+	s.localServicesMu.RUnlock()
+	if ok {
+		return codec
+	}
+	s.servicesMu.RLock()
+	defer s.servicesMu.RUnlock()
+	for _, codec := range s.serviceCodecs[name] {
+		return codec
+	}
+	return ""
+}
+
+// deleteServiceCodec forgets codec of service registered by node, services must be locked
+func (s *Server) deleteServiceCodec(name, nodeName string) {
+	delete(s.serviceCodecs[name], nodeName)
+	if len(s.serviceCodecs[name]) == 0 {
+		delete(s.serviceCodecs, name)
+	}
+}
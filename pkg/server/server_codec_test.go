@@ -0,0 +1,33 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Service codecs", func() {
+	It("should forget codecs of services removed", func() {
+		s := &Server{
+			logger:          zap.NewNop(),
+			services:        map[string]map[string]float64{},
+			serviceCodecs:   map[string]map[string]string{},
+			servicesMu:      &sync.RWMutex{},
+			localCodecs:     map[string]string{},
+			localServicesMu: &sync.RWMutex{},
+			rings:           map[string]*HashRing{},
+			ringsMu:         &sync.Mutex{},
+		}
+		s.handleRegistryBroadcast(&RegistryBroadcast{Name: "hello", NodeName: "a", Codec: "msgpack", Timestamp: time.Now()})
+		s.handleRegistryBroadcast(&RegistryBroadcast{Name: "hello", NodeName: "b", Codec: "msgpack", Timestamp: time.Now()})
+		Expect(s.serviceCodec("hello")).To(Equal("msgpack"))
+		s.handleRegistryBroadcast(&RegistryBroadcast{Name: "hello", NodeName: "a", IsDeleted: true, Timestamp: time.Now()})
+		Expect(s.serviceCodec("hello")).To(Equal("msgpack"))
+		s.handleRegistryBroadcast(&RegistryBroadcast{Name: "hello", NodeName: "b", Timestamp: time.Now()})
+		Expect(s.serviceCodec("hello")).To(BeEmpty())
+		Expect(s.serviceCodecs).To(BeEmpty())
+	})
+})
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/joesonw/drlee/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const defaultTLSReloadInterval = time.Minute
+
+// Certificates certificate, key and CA of rpc port, reloaded from disk once files are modified
+type Certificates struct {
+	config  TLSConfig
+	mu      *sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	exit    chan struct{}
+	once    *sync.Once
+}
+
+// NewCertificates loads certificates described by config
+func NewCertificates(config TLSConfig) (*Certificates, error) {
+	if config.VerifyNodeName && !config.IsMutual() {
+		return nil, errors.New("verify-node-name requires a tls ca to verify peers with")
+	}
+	c := &Certificates{
+		config: config,
+		mu:     &sync.RWMutex{},
+		exit:   make(chan struct{}),
+		once:   &sync.Once{},
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// latestModTime latest modification time among configured files
+func (c *Certificates) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.config.CAFile, c.config.CertFile, c.config.KeyFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *Certificates) load() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if c.config.CertFile != "" || c.config.KeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to load tls key pair: %w", err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if c.config.CAFile != "" {
+		b, err := ioutil.ReadFile(c.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read tls ca: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificate found in tls ca \"%s\"", c.config.CAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.cert = cert
+	c.pool = pool
+	c.modTime = modTime
+	c.mu.Unlock()
+	return nil
+}
+
+// Watch reloads certificates once any of the files is modified, until closed
+func (c *Certificates) Watch(logger *zap.Logger) {
+	interval := c.config.ReloadInterval
+	if interval <= 0 {
+		interval = defaultTLSReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.exit:
+				return
+			case <-ticker.C:
+				modTime, err := c.latestModTime()
+				if err != nil {
+					logger.Error("unable to stat tls certificates", zap.Error(err))
+					continue
+				}
+				c.mu.RLock()
+				changed := modTime.After(c.modTime)
+				c.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				if err := c.load(); err != nil {
+					logger.Error("unable to reload tls certificates, keep using previous ones", zap.Error(err))
+					continue
+				}
+				logger.Info("reloaded tls certificates")
+			}
+		}
+	}()
+}
+
+// Close stops watching
+func (c *Certificates) Close() {
+	c.once.Do(func() {
+		close(c.exit)
+	})
+}
+
+func (c *Certificates) certificate() (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		return nil, errors.New("no tls certificate configured")
+	}
+	return c.cert, nil
+}
+
+func (c *Certificates) certPool() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pool
+}
+
+// verify verifies chain of peer against current CA, and that it's issued for name if given
+func (c *Certificates) verify(rawCerts [][]byte, usage x509.ExtKeyUsage, name string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no tls certificate presented by peer")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         c.certPool(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return err
+	}
+	if name != "" {
+		return verifyPeerName(certs[0], name)
+	}
+	return nil
+}
+
+// verifyPeerName whether certificate is issued for name, either as a SAN or the common name
+func verifyPeerName(cert *x509.Certificate, name string) error {
+	if cert.Subject.CommonName == name {
+		return nil
+	}
+	return cert.VerifyHostname(name)
+}
+
+// ServerCredentials credentials of rpc port, with CA configured peers must present a certificate issued by it
+func (c *Certificates) ServerCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(c.serverConfig("h2"))
+}
+
+// ClientCredentials credentials to dial rpc port of a peer, its certificate is expected to be issued for serverName if given
+func (c *Certificates) ClientCredentials(serverName string) credentials.TransportCredentials {
+	return credentials.NewTLS(c.clientConfig(serverName))
+}
+
+// serverConfig tls config to accept connections from peers, with CA configured they must present a certificate issued
+// by it
+func (c *Certificates) serverConfig(nextProtos ...string) *tls.Config {
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return c.certificate()
+	}
+	if !c.config.IsMutual() {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     nextProtos,
+			GetCertificate: getCertificate,
+		}
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		// CA is reloadable, config is taken per connection
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     nextProtos,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      c.certPool(),
+				GetCertificate: getCertificate,
+			}, nil
+		},
+	}
+}
+
+// clientConfig tls config to dial a peer, its certificate is expected to be issued for serverName if given
+func (c *Certificates) clientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// chain is verified against reloadable CA below
+		InsecureSkipVerify: true, //nolint:gosec
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			if c.cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return c.cert, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verify(rawCerts, x509.ExtKeyUsageServerAuth, serverName)
+		},
+	}
+}
+
+// peerNamed requests naming the calling node
+type peerNamed interface {
+	GetNodeName() string
+}
+
+// UnaryServerInterceptor rejects calls not authorized by client certificate of the connection
+func (c *Certificates) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := c.authorize(ctx, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams not authorized by client certificate of the connection
+func (c *Certificates) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, err := peerCertificate(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, certs: c})
+	}
+}
+
+// authorizedStream authorizes every message received
+type authorizedStream struct {
+	grpc.ServerStream
+	certs *Certificates
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.certs.authorize(s.Context(), m)
+}
+
+// authorize requires a client certificate. With VerifyNodeName, it must be issued for the node named by request, or
+// for one of admin names if it's a debug request; requests naming no node are rejected.
+func (c *Certificates) authorize(ctx context.Context, req interface{}) error {
+	cert, err := peerCertificate(ctx)
+	if err != nil {
+		return err
+	}
+	if !c.config.VerifyNodeName {
+		return nil
+	}
+	switch r := req.(type) {
+	case *proto.DebugRequest:
+		for _, name := range c.config.AdminNames {
+			if verifyPeerName(cert, name) == nil {
+				return nil
+			}
+		}
+		return status.Error(codes.PermissionDenied, "tls certificate is not issued for an admin")
+	case peerNamed:
+		nodeName := r.GetNodeName()
+		if nodeName == "" {
+			return status.Error(codes.PermissionDenied, "request names no node")
+		}
+		if err := verifyPeerName(cert, nodeName); err != nil {
+			return status.Errorf(codes.PermissionDenied, "tls certificate is not issued for node \"%s\": %s", nodeName, err)
+		}
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "request %T names no node", req)
+}
+
+// peerCertificate certificate presented by peer of the connection
+func peerCertificate(ctx context.Context) (*x509.Certificate, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unknown peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no tls certificate presented by peer")
+	}
+	return info.State.PeerCertificates[0], nil
+}
+
+// dialOption transport of connection to peer node
+func (s *Server) dialOption(nodeName string) grpc.DialOption {
+	if s.certs == nil {
+		return grpc.WithInsecure()
+	}
+	serverName := ""
+	if s.config.RPC.TLS.VerifyNodeName {
+		serverName = nodeName
+	}
+	return grpc.WithTransportCredentials(s.certs.ClientCredentials(serverName))
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/joesonw/drlee/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).To(BeNil())
+	ca := &testCA{dir: dir, cert: cert, key: key}
+	ca.write("ca.crt", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name, kind string, der []byte) string {
+	file := filepath.Join(ca.dir, name)
+	Expect(ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)).To(Succeed())
+	return file
+}
+
+// issue writes certificate and key issued for name, returns config using them
+func (ca *testCA) issue(name string) TLSConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).To(BeNil())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(BeNil())
+	return TLSConfig{
+		CAFile:   filepath.Join(ca.dir, "ca.crt"),
+		CertFile: ca.write(name+".crt", "CERTIFICATE", der),
+		KeyFile:  ca.write(name+".key", "EC PRIVATE KEY", keyDer),
+	}
+}
+
+type tlsTestRPCServer struct {
+	proto.UnimplementedRPCServer
+}
+
+func (tlsTestRPCServer) RPCCall(context.Context, *proto.CallRequest) (*proto.CallResponse, error) {
+	return &proto.CallResponse{}, nil
+}
+
+func (tlsTestRPCServer) RPCReply(context.Context, *proto.ReplyRequest) (*proto.ReplyResponse, error) {
+	return &proto.ReplyResponse{}, nil
+}
+
+func (tlsTestRPCServer) RPCDebug(context.Context, *proto.DebugRequest) (*proto.DebugResponse, error) {
+	return &proto.DebugResponse{}, nil
+}
+
+func (tlsTestRPCServer) RPCDebugStream(req *proto.DebugRequest, stream proto.RPC_RPCDebugStreamServer) error {
+	return stream.Send(&proto.DebugResponse{})
+}
+
+var _ = Describe("TLS", func() {
+	var dir string
+	var ca *testCA
+	var addr string
+	var grpcServer *grpc.Server
+	var conns []*grpc.ClientConn
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-tls")
+		Expect(err).To(BeNil())
+		ca = newTestCA(dir)
+		config := ca.issue("a")
+		config.VerifyNodeName = true
+		config.AdminNames = []string{"admin"}
+		certs, err := NewCertificates(config)
+		Expect(err).To(BeNil())
+		grpcServer = grpc.NewServer(
+			grpc.Creds(certs.ServerCredentials()),
+			grpc.UnaryInterceptor(certs.UnaryServerInterceptor()),
+			grpc.StreamInterceptor(certs.StreamServerInterceptor()))
+		proto.RegisterRPCServer(grpcServer, &tlsTestRPCServer{})
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		addr = lis.Addr().String()
+		go func(server *grpc.Server) {
+			_ = server.Serve(lis)
+		}(grpcServer)
+	})
+
+	AfterEach(func() {
+		for _, cc := range conns {
+			cc.Close()
+		}
+		conns = nil
+		grpcServer.Stop()
+		os.RemoveAll(dir)
+	})
+
+	dial := func(config TLSConfig) proto.RPCClient {
+		certs, err := NewCertificates(config)
+		Expect(err).To(BeNil())
+		cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(certs.ClientCredentials("a")))
+		Expect(err).To(BeNil())
+		conns = append(conns, cc)
+		return proto.NewRPCClient(cc)
+	}
+
+	codeOf := func(_ interface{}, err error) codes.Code {
+		return status.Code(err)
+	}
+
+	It("should require node name of request to match certificate", func() {
+		rpc := dial(ca.issue("b"))
+		ctx := context.Background()
+		Expect(codeOf(rpc.RPCCall(ctx, &proto.CallRequest{NodeName: "b"}))).To(Equal(codes.OK))
+		Expect(codeOf(rpc.RPCCall(ctx, &proto.CallRequest{NodeName: "c"}))).To(Equal(codes.PermissionDenied))
+		Expect(codeOf(rpc.RPCCall(ctx, &proto.CallRequest{}))).To(Equal(codes.PermissionDenied))
+		Expect(codeOf(rpc.RPCReply(ctx, &proto.ReplyRequest{NodeName: "b"}))).To(Equal(codes.OK))
+		Expect(codeOf(rpc.RPCReply(ctx, &proto.ReplyRequest{}))).To(Equal(codes.PermissionDenied))
+	})
+
+	It("should only let admins debug", func() {
+		ctx := context.Background()
+		rpc := dial(ca.issue("b"))
+		Expect(codeOf(rpc.RPCDebug(ctx, &proto.DebugRequest{Name: "reload"}))).To(Equal(codes.PermissionDenied))
+		stream, err := rpc.RPCDebugStream(ctx, &proto.DebugRequest{Name: "logs"})
+		Expect(err).To(BeNil())
+		Expect(codeOf(stream.Recv())).To(Equal(codes.PermissionDenied))
+
+		rpc = dial(ca.issue("admin"))
+		Expect(codeOf(rpc.RPCDebug(ctx, &proto.DebugRequest{Name: "reload"}))).To(Equal(codes.OK))
+		stream, err = rpc.RPCDebugStream(ctx, &proto.DebugRequest{Name: "logs"})
+		Expect(err).To(BeNil())
+		Expect(codeOf(stream.Recv())).To(Equal(codes.OK))
+	})
+
+	It("should reject peers presenting no certificate or one of another CA", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rpc := dial(TLSConfig{CAFile: filepath.Join(dir, "ca.crt")})
+		Expect(codeOf(rpc.RPCCall(ctx, &proto.CallRequest{NodeName: "b"}))).NotTo(Equal(codes.OK))
+
+		otherDir, err := ioutil.TempDir("", "drlee-tls")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(otherDir)
+		other := newTestCA(otherDir).issue("b")
+		other.CAFile = filepath.Join(dir, "ca.crt")
+		rpc = dial(other)
+		Expect(codeOf(rpc.RPCCall(ctx, &proto.CallRequest{NodeName: "b"}))).NotTo(Equal(codes.OK))
+	})
+
+	It("should require CA to verify node names", func() {
+		_, err := NewCertificates(TLSConfig{VerifyNodeName: true})
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("should serve raft over tls to peers of the same CA only", func() {
+		certs, err := NewCertificates(ca.issue("a"))
+		Expect(err).To(BeNil())
+		server := &Server{config: &Config{}, certs: certs}
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", certs.serverConfig())
+		Expect(err).To(BeNil())
+		stream := &raftTLSStreamLayer{Listener: listener, advertise: listener.Addr(), server: server}
+		defer stream.Close()
+		go func() {
+			for {
+				conn, err := stream.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_, _ = io.Copy(conn, conn)
+				}()
+			}
+		}()
+
+		echo := func(config TLSConfig) error {
+			peerCerts, err := NewCertificates(config)
+			Expect(err).To(BeNil())
+			peer := &raftTLSStreamLayer{server: &Server{config: &Config{}, certs: peerCerts}}
+			conn, err := peer.Dial(raft.ServerAddress(listener.Addr().String()), time.Second)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			Expect(conn.SetDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				return err
+			}
+			b := make([]byte, 4)
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return err
+			}
+			Expect(string(b)).To(Equal("ping"))
+			return nil
+		}
+		Expect(echo(ca.issue("b"))).To(Succeed())
+
+		otherDir, err := ioutil.TempDir("", "drlee-tls")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(otherDir)
+		other := newTestCA(otherDir).issue("b")
+		other.CAFile = filepath.Join(dir, "ca.crt")
+		Expect(echo(other)).NotTo(Succeed())
+	})
+})
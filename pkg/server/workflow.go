@@ -0,0 +1,843 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	coreWorkflow "github.com/joesonw/drlee/pkg/core/workflow"
+	"github.com/nsqio/go-diskqueue"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWorkflowConcurrency         = 16
+	defaultWorkflowStepTimeout         = time.Minute
+	defaultWorkflowBackoff             = time.Second
+	defaultWorkflowMaxBackoff          = time.Minute * 10
+	defaultWorkflowCompensationRetries = 3
+	defaultWorkflowRetention           = time.Hour * 24
+	// workflowPruneInterval finished instances past retention are removed this often
+	workflowPruneInterval = time.Minute
+	// workflowTakeOverInterval instances replicated by nodes no longer alive are claimed this often
+	workflowTakeOverInterval = time.Second * 30
+	workflowReplicateTimeout = time.Second * 5
+	workflowReplicaPrefix    = "workflows/"
+)
+
+// errWorkflowTakenOver instance is claimed by another node while local node was considered gone
+var errWorkflowTakenOver = errors.New("workflow instance is taken over by another node")
+
+// WorkflowStatus of an instance, running and compensating ones are resumed on restart
+type WorkflowStatus string
+
+const (
+	WorkflowRunning      WorkflowStatus = "running"
+	WorkflowCompensating WorkflowStatus = "compensating"
+	// WorkflowCompleted every step succeeded
+	WorkflowCompleted WorkflowStatus = "completed"
+	// WorkflowCompensated a step failed, completed steps were compensated
+	WorkflowCompensated WorkflowStatus = "compensated"
+	// WorkflowFailed a compensation failed too, instance is left for inspection until resumed
+	WorkflowFailed WorkflowStatus = "failed"
+)
+
+func (status WorkflowStatus) isFinished() bool {
+	return status != WorkflowRunning && status != WorkflowCompensating
+}
+
+// WorkflowInstance state of a workflow, it's checkpointed to its own file every time a step is done. Steps are copied
+// from definition at start, so instance is resumed the same way even if definition has changed.
+type WorkflowInstance struct {
+	ID    string
+	Name  string
+	Steps []*coreWorkflow.Step
+	Input json.RawMessage
+	// Results of completed steps by name, removed once compensated
+	Results map[string]json.RawMessage
+	Status  WorkflowStatus
+	// Step index of step to be run next, or step to be compensated next while compensating
+	Step int
+	// Attempt failed attempts of current step
+	Attempt int
+	// Failures errors replied by steps so far, it's part of idempotency keys so that calls retried aren't replied with
+	// the cached error. Calls timed out keep their key, a late reply of the previous attempt is taken instead.
+	Failures int
+	Error    string
+	// NodeName node running instance, it's set only if checkpoints are replicated
+	NodeName  string `json:",omitempty"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// workflowStepMessage body steps and compensations are called with
+type workflowStepMessage struct {
+	Workflow string                     `json:"workflow"`
+	Name     string                     `json:"name"`
+	Step     string                     `json:"step"`
+	Input    json.RawMessage            `json:"input"`
+	Results  map[string]json.RawMessage `json:"results"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// Workflows instances of workflows started on local node. Ids of instances to be run wait in a diskqueue, runners
+// call their steps one by one and checkpoint each result. Instances interrupted are resumed from their last
+// checkpoint on restart, so a step may be called again: calls carry an idempotency key to have duplicates replied
+// with the first reply. If raft is enabled checkpoints are replicated as well, instances of nodes gone are taken over
+// by survivors.
+type Workflows struct {
+	mu          *sync.Mutex
+	config      WorkflowConfig
+	dir         string
+	queue       diskqueue.Interface
+	definitions map[string]*coreWorkflow.Definition
+	instances   map[string]*WorkflowInstance
+	running     map[string]bool
+	call        func(ctx context.Context, req *coreRPC.Request) ([]byte, error)
+	// replica nil if checkpoints are not replicated
+	replica *workflowReplica
+	// replicated checkpoints last replicated by local node, expected by the next one
+	replicated map[string][]byte
+	takeOver   chan struct{}
+	logger     *zap.Logger
+}
+
+// workflowReplica replicated state checkpoints are kept in besides local files
+type workflowReplica struct {
+	nodeName string
+	apply    func(ctx context.Context, cmd *coreConsensus.Command) (*coreConsensus.Result, error)
+	// entries reads local replica of state
+	entries func(prefix string) map[string][]byte
+	isAlive func(nodeName string) bool
+}
+
+func newWorkflows(config WorkflowConfig, dir string, newQueue QueueFactory, call func(ctx context.Context, req *coreRPC.Request) ([]byte, error), logger *zap.Logger) *Workflows {
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultWorkflowConcurrency
+	}
+	if config.StepTimeout <= 0 {
+		config.StepTimeout = defaultWorkflowStepTimeout
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultWorkflowBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultWorkflowMaxBackoff
+	}
+	if config.CompensationRetries <= 0 {
+		config.CompensationRetries = defaultWorkflowCompensationRetries
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultWorkflowRetention
+	}
+	return &Workflows{
+		mu:          &sync.Mutex{},
+		config:      config,
+		dir:         filepath.Join(dir, "workflows"),
+		queue:       newQueue("workflows"),
+		definitions: map[string]*coreWorkflow.Definition{},
+		instances:   map[string]*WorkflowInstance{},
+		running:     map[string]bool{},
+		call:        call,
+		replicated:  map[string][]byte{},
+		takeOver:    make(chan struct{}, 1),
+		logger:      logger,
+	}
+}
+
+func (w *Workflows) path(id string) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%x.json", sha1.Sum([]byte(id))))
+}
+
+// Define registers definition of workflow, a previous one of the same name is replaced
+func (w *Workflows) Define(def *coreWorkflow.Definition) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.definitions[def.Name] = def
+}
+
+// Reset forgets definitions, instances keep running with steps they were started with
+func (w *Workflows) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.definitions = map[string]*coreWorkflow.Definition{}
+}
+
+// StartInstance persists a new instance of workflow and queues it, an existing instance of id is left as is, even
+// one running on another node if checkpoints are replicated
+func (w *Workflows) StartInstance(name, id string, input []byte) (string, error) {
+	w.mu.Lock()
+	def, ok := w.definitions[name]
+	if !ok {
+		w.mu.Unlock()
+		return "", fmt.Errorf("workflow \"%s\" is not defined", name)
+	}
+	if id == "" {
+		id = uuid.NewV4().String()
+	}
+	if _, ok := w.instances[id]; ok {
+		w.mu.Unlock()
+		return id, nil
+	}
+	now := time.Now()
+	instance := &WorkflowInstance{
+		ID:        id,
+		Name:      name,
+		Steps:     def.Steps,
+		Input:     input,
+		Results:   map[string]json.RawMessage{},
+		Status:    WorkflowRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if w.replica != nil {
+		instance.NodeName = w.replica.nodeName
+	}
+	w.instances[id] = instance
+	b, err := json.Marshal(instance)
+	w.mu.Unlock()
+	if err == nil {
+		err = w.replicate(id, b)
+	}
+	if errors.Is(err, errWorkflowTakenOver) {
+		w.mu.Lock()
+		delete(w.instances, id)
+		w.mu.Unlock()
+		return id, nil
+	}
+	if err == nil {
+		err = w.write(id, b)
+	}
+	if err == nil {
+		err = w.queue.Put([]byte(id))
+	}
+	if err != nil {
+		w.mu.Lock()
+		delete(w.instances, id)
+		w.mu.Unlock()
+		_ = os.Remove(w.path(id))
+		return "", err
+	}
+	return id, nil
+}
+
+// Status state of instance, nil if it's not found
+func (w *Workflows) Status(id string) *coreWorkflow.Instance {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	instance, ok := w.instances[id]
+	if !ok {
+		return nil
+	}
+	status := &coreWorkflow.Instance{
+		ID:      instance.ID,
+		Name:    instance.Name,
+		Status:  string(instance.Status),
+		Error:   instance.Error,
+		Results: map[string][]byte{},
+	}
+	if !instance.Status.isFinished() && instance.Step >= 0 && instance.Step < len(instance.Steps) {
+		status.Step = instance.Steps[instance.Step].Name
+	}
+	for name, result := range instance.Results {
+		status.Results[name] = result
+	}
+	return status
+}
+
+// Resume retries compensations of a failed instance
+func (w *Workflows) Resume(id string) error {
+	w.mu.Lock()
+	instance, ok := w.instances[id]
+	if !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("workflow instance \"%s\" not found", id)
+	}
+	if instance.Status != WorkflowFailed {
+		w.mu.Unlock()
+		return fmt.Errorf("workflow instance \"%s\" is %s", id, instance.Status)
+	}
+	w.mu.Unlock()
+	if err := w.checkpoint(instance, func() {
+		instance.Status = WorkflowCompensating
+		instance.Attempt = 0
+	}); err != nil {
+		return err
+	}
+	return w.queue.Put([]byte(id))
+}
+
+// checkpoint applies change to instance and persists it, instance is forgotten if it's taken over by another node
+func (w *Workflows) checkpoint(instance *WorkflowInstance, change func()) error {
+	w.mu.Lock()
+	change()
+	instance.UpdatedAt = time.Now()
+	b, err := json.Marshal(instance)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := w.replicate(instance.ID, b); err != nil {
+		if errors.Is(err, errWorkflowTakenOver) {
+			w.forget(instance.ID)
+		}
+		return err
+	}
+	return w.write(instance.ID, b)
+}
+
+// replicate swaps replicated checkpoint of instance with b, nil removes it. Instance keeps running on local checkpoints
+// if raft is not available, they are replicated along with the next one.
+func (w *Workflows) replicate(id string, b []byte) error {
+	if w.replica == nil {
+		return nil
+	}
+	w.mu.Lock()
+	expected := w.replicated[id]
+	w.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), workflowReplicateTimeout)
+	defer cancel()
+	// expected is unknown after restart, or stale if a swap timed out but was applied anyway
+	for i := 0; i < 3; i++ {
+		res, err := w.replica.apply(ctx, &coreConsensus.Command{
+			Op:       coreConsensus.OpCAS,
+			Key:      workflowReplicaPrefix + id,
+			Expected: expected,
+			Value:    b,
+		})
+		if err != nil {
+			w.logger.Warn(fmt.Sprintf("unable to replicate workflow [%s]", id), zap.Error(err))
+			return nil
+		}
+		if res.Swapped {
+			w.mu.Lock()
+			if b == nil {
+				delete(w.replicated, id)
+			} else {
+				w.replicated[id] = b
+			}
+			w.mu.Unlock()
+			return nil
+		}
+		if res.Exists && workflowOwner(res.Value) != w.replica.nodeName {
+			return errWorkflowTakenOver
+		}
+		expected = res.Value
+	}
+	return fmt.Errorf("workflow instance \"%s\" is changed concurrently", id)
+}
+
+// workflowOwner node name of instance replicated
+func workflowOwner(b []byte) string {
+	instance := &WorkflowInstance{}
+	if err := json.Unmarshal(b, instance); err != nil {
+		return ""
+	}
+	return instance.NodeName
+}
+
+// forget removes instance taken over by another node, it's no longer run or pruned by local node
+func (w *Workflows) forget(id string) {
+	w.mu.Lock()
+	delete(w.instances, id)
+	delete(w.replicated, id)
+	w.mu.Unlock()
+	if err := os.Remove(w.path(id)); err != nil && !os.IsNotExist(err) {
+		w.logger.Error(fmt.Sprintf("unable to remove workflow instance [%s]", id), zap.Error(err))
+	}
+}
+
+func (w *Workflows) write(id string, b []byte) error {
+	path := w.path(id)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Start loads instances persisted, queues those unfinished again and starts runners
+func (w *Workflows) Start(ctx context.Context) error {
+	resumed, err := w.load()
+	if err != nil {
+		return err
+	}
+	for _, id := range resumed {
+		if err := w.queue.Put([]byte(id)); err != nil {
+			return err
+		}
+	}
+	if len(resumed) > 0 {
+		w.logger.Info(fmt.Sprintf("resuming %d workflow instances", len(resumed)))
+	}
+	for i := 0; i < w.config.Concurrency; i++ {
+		go w.run(ctx)
+	}
+	go w.runPrune(ctx)
+	if w.replica != nil {
+		go w.runTakeOver(ctx)
+	}
+	return nil
+}
+
+// load reads instances persisted, returns ids of unfinished ones
+func (w *Workflows) load() ([]string, error) {
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var resumed []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(w.dir, file.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		instance := &WorkflowInstance{}
+		if err := json.Unmarshal(b, instance); err != nil {
+			w.logger.Error(fmt.Sprintf("unable to load workflow instance %s, removing", path), zap.Error(err))
+			_ = os.Remove(path)
+			continue
+		}
+		if instance.Results == nil {
+			instance.Results = map[string]json.RawMessage{}
+		}
+		w.instances[instance.ID] = instance
+		if !instance.Status.isFinished() {
+			resumed = append(resumed, instance.ID)
+		}
+	}
+	return resumed, nil
+}
+
+// run drives instances read from queue, ids of instances already running or finished are skipped, they are
+// queued more than once if resumed while still waiting in queue
+func (w *Workflows) run(ctx context.Context) {
+	for {
+		var id string
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-w.queue.ReadChan():
+			id = string(data)
+		}
+
+		w.mu.Lock()
+		instance, ok := w.instances[id]
+		if !ok || w.running[id] || instance.Status.isFinished() {
+			w.mu.Unlock()
+			continue
+		}
+		w.running[id] = true
+		w.mu.Unlock()
+
+		w.drive(ctx, instance)
+
+		w.mu.Lock()
+		delete(w.running, id)
+		w.mu.Unlock()
+	}
+}
+
+// drive calls steps of instance from its checkpoint on, until it's finished or node stops. Failed steps are retried
+// after backoff, once out of retries completed steps are compensated in reverse order.
+func (w *Workflows) drive(ctx context.Context, instance *WorkflowInstance) {
+	for {
+		w.mu.Lock()
+		status := instance.Status
+		index := instance.Step
+		attempt := instance.Attempt
+		w.mu.Unlock()
+
+		var err error
+		switch status {
+		case WorkflowRunning:
+			if index >= len(instance.Steps) {
+				err = w.checkpoint(instance, func() {
+					instance.Status = WorkflowCompleted
+				})
+				break
+			}
+			step := instance.Steps[index]
+			result, callErr := w.callStep(ctx, instance, step, step.Method, "")
+			if ctx.Err() != nil {
+				return
+			}
+			isReplied := isErrorReply(callErr)
+			if callErr == nil {
+				err = w.checkpoint(instance, func() {
+					instance.Results[step.Name] = result
+					instance.Step++
+					instance.Attempt = 0
+				})
+				break
+			}
+			if attempt < step.Retries {
+				w.logger.Sugar().Debugf("workflow [%s] '%s' retrying step \"%s\": %s", instance.ID, instance.Name, step.Name, callErr)
+				err = w.checkpoint(instance, func() {
+					instance.Attempt++
+					if isReplied {
+						instance.Failures++
+					}
+				})
+				if err == nil && !w.wait(ctx, step, attempt) {
+					return
+				}
+				break
+			}
+			w.logger.Info(fmt.Sprintf("workflow [%s] '%s' failed at step \"%s\", compensating", instance.ID, instance.Name, step.Name), zap.Error(callErr))
+			err = w.checkpoint(instance, func() {
+				instance.Status = WorkflowCompensating
+				instance.Error = fmt.Sprintf("step \"%s\": %s", step.Name, callErr)
+				instance.Step--
+				instance.Attempt = 0
+				if isReplied {
+					instance.Failures++
+				}
+			})
+		case WorkflowCompensating:
+			if index < 0 {
+				err = w.checkpoint(instance, func() {
+					instance.Status = WorkflowCompensated
+				})
+				break
+			}
+			step := instance.Steps[index]
+			w.mu.Lock()
+			_, isDone := instance.Results[step.Name]
+			w.mu.Unlock()
+			if step.Compensate == "" || !isDone {
+				err = w.checkpoint(instance, func() {
+					instance.Step--
+				})
+				break
+			}
+			_, callErr := w.callStep(ctx, instance, step, step.Compensate, instance.Error)
+			if ctx.Err() != nil {
+				return
+			}
+			isReplied := isErrorReply(callErr)
+			if callErr == nil {
+				err = w.checkpoint(instance, func() {
+					delete(instance.Results, step.Name)
+					instance.Step--
+					instance.Attempt = 0
+				})
+				break
+			}
+			retries := step.Retries
+			if retries < w.config.CompensationRetries {
+				retries = w.config.CompensationRetries
+			}
+			if attempt < retries {
+				w.logger.Sugar().Debugf("workflow [%s] '%s' retrying compensation of step \"%s\": %s", instance.ID, instance.Name, step.Name, callErr)
+				err = w.checkpoint(instance, func() {
+					instance.Attempt++
+					if isReplied {
+						instance.Failures++
+					}
+				})
+				if err == nil && !w.wait(ctx, step, attempt) {
+					return
+				}
+				break
+			}
+			w.logger.Error(fmt.Sprintf("workflow [%s] '%s' failed to compensate step \"%s\"", instance.ID, instance.Name, step.Name), zap.Error(callErr))
+			err = w.checkpoint(instance, func() {
+				instance.Status = WorkflowFailed
+				instance.Error += fmt.Sprintf("; compensate \"%s\": %s", step.Name, callErr)
+				if isReplied {
+					instance.Failures++
+				}
+			})
+		default:
+			return
+		}
+		if errors.Is(err, errWorkflowTakenOver) {
+			w.logger.Info(fmt.Sprintf("workflow [%s] '%s' is taken over by another node", instance.ID, instance.Name))
+			return
+		}
+		if err != nil {
+			// instance is resumed from the last checkpoint persisted on restart
+			w.logger.Error(fmt.Sprintf("unable to checkpoint workflow [%s] '%s'", instance.ID, instance.Name), zap.Error(err))
+			return
+		}
+	}
+}
+
+// callStep calls method with input of instance and results so far, keyed by instance so that a step called again
+// after being interrupted is deduplicated by the node handled it
+func (w *Workflows) callStep(ctx context.Context, instance *WorkflowInstance, step *coreWorkflow.Step, method, reason string) (json.RawMessage, error) {
+	w.mu.Lock()
+	message := &workflowStepMessage{
+		Workflow: instance.ID,
+		Name:     instance.Name,
+		Step:     step.Name,
+		Input:    instance.Input,
+		Results:  map[string]json.RawMessage{},
+		Error:    reason,
+	}
+	key := fmt.Sprintf("%s/%s/%d", instance.ID, step.Name, instance.Failures)
+	for name, result := range instance.Results {
+		message.Results[name] = result
+	}
+	w.mu.Unlock()
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = w.config.StepTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := w.call(ctx, &coreRPC.Request{
+		Name:           method,
+		Body:           body,
+		Codec:          coreWorkflow.Codec,
+		ExpiresAt:      time.Now().Add(timeout),
+		Key:            instance.ID,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		result = []byte("null")
+	}
+	return result, nil
+}
+
+// isErrorReply whether call failed with error replied by handler, such error is cached under idempotency key of call
+func isErrorReply(err error) bool {
+	var reply *errorReply
+	return errors.As(err, &reply)
+}
+
+// wait backoff of step before the next attempt, it doubles every attempt. Returns false if node is stopping
+func (w *Workflows) wait(ctx context.Context, step *coreWorkflow.Step, attempt int) bool {
+	backoff := step.Backoff
+	if backoff <= 0 {
+		backoff = w.config.Backoff
+	}
+	for i := 0; i < attempt && backoff < w.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > w.config.MaxBackoff {
+		backoff = w.config.MaxBackoff
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// runPrune removes instances finished longer than retention ago
+func (w *Workflows) runPrune(ctx context.Context) {
+	ticker := time.NewTicker(workflowPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.prune()
+		}
+	}
+}
+
+func (w *Workflows) prune() {
+	w.mu.Lock()
+	now := time.Now()
+	var pruned []string
+	for id, instance := range w.instances {
+		if instance.Status.isFinished() && instance.Status != WorkflowFailed && now.Sub(instance.UpdatedAt) > w.config.Retention {
+			pruned = append(pruned, id)
+		}
+	}
+	w.mu.Unlock()
+	for _, id := range pruned {
+		if err := w.replicate(id, nil); err != nil && !errors.Is(err, errWorkflowTakenOver) {
+			w.logger.Error(fmt.Sprintf("unable to remove replicated workflow instance [%s]", id), zap.Error(err))
+			continue
+		}
+		w.forget(id)
+	}
+}
+
+// TriggerTakeOver claims instances of nodes gone without waiting for the next interval
+func (w *Workflows) TriggerTakeOver() {
+	select {
+	case w.takeOver <- struct{}{}:
+	default:
+	}
+}
+
+// runTakeOver claims instances replicated by nodes no longer alive, until ctx is done
+func (w *Workflows) runTakeOver(ctx context.Context) {
+	ticker := time.NewTicker(workflowTakeOverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.takeOver:
+		}
+		w.claim(ctx)
+	}
+}
+
+// claim swaps owner of instances replicated by nodes no longer alive to local node, survivors race for each
+// instance and only one of them wins. Instances loaded by local node but owned by another one are forgotten. Unfinished instances are resumed from their last replicated checkpoint, their
+// interrupted step is called again with the same idempotency key.
+func (w *Workflows) claim(ctx context.Context) {
+	for key, b := range w.replica.entries(workflowReplicaPrefix) {
+		instance := &WorkflowInstance{}
+		if err := json.Unmarshal(b, instance); err != nil {
+			w.logger.Error(fmt.Sprintf("unable to decode replicated workflow instance %s", key), zap.Error(err))
+			continue
+		}
+		if instance.NodeName == w.replica.nodeName {
+			continue
+		}
+		if w.replica.isAlive(instance.NodeName) {
+			// loaded on restart but taken over while local node was gone
+			w.mu.Lock()
+			_, isLoaded := w.instances[instance.ID]
+			_, isReplicated := w.replicated[instance.ID]
+			isRunning := w.running[instance.ID]
+			w.mu.Unlock()
+			if isLoaded && !isReplicated && !isRunning {
+				w.forget(instance.ID)
+			}
+			continue
+		}
+		previous := instance.NodeName
+		instance.NodeName = w.replica.nodeName
+		if instance.Results == nil {
+			instance.Results = map[string]json.RawMessage{}
+		}
+		claimed, err := json.Marshal(instance)
+		if err != nil {
+			continue
+		}
+		applyCtx, cancel := context.WithTimeout(ctx, workflowReplicateTimeout)
+		res, err := w.replica.apply(applyCtx, &coreConsensus.Command{
+			Op:       coreConsensus.OpCAS,
+			Key:      key,
+			Expected: b,
+			Value:    claimed,
+		})
+		cancel()
+		if err != nil {
+			w.logger.Warn("unable to take over workflow instances", zap.Error(err))
+			return
+		}
+		if !res.Swapped {
+			continue
+		}
+
+		w.mu.Lock()
+		w.instances[instance.ID] = instance
+		w.replicated[instance.ID] = claimed
+		w.mu.Unlock()
+		if err := w.write(instance.ID, claimed); err != nil {
+			w.logger.Error(fmt.Sprintf("unable to persist workflow instance [%s]", instance.ID), zap.Error(err))
+		}
+		w.logger.Info(fmt.Sprintf("took over workflow [%s] '%s' %s from %s", instance.ID, instance.Name, instance.Status, previous))
+		if !instance.Status.isFinished() {
+			if err := w.queue.Put([]byte(instance.ID)); err != nil {
+				w.logger.Error(fmt.Sprintf("unable to queue workflow instance [%s]", instance.ID), zap.Error(err))
+			}
+		}
+	}
+}
+
+// describe instances of local node, newest first
+func (w *Workflows) describe() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	instances := make([]*WorkflowInstance, 0, len(w.instances))
+	for _, instance := range w.instances {
+		instances = append(instances, instance)
+	}
+	if len(instances) == 0 {
+		return "no workflow instances"
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].CreatedAt.After(instances[j].CreatedAt)
+	})
+	lines := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		line := fmt.Sprintf("[%s] %s: %s step=%d/%d attempt=%d updated=%s",
+			instance.ID, instance.Name, instance.Status, instance.Step, len(instance.Steps), instance.Attempt,
+			instance.UpdatedAt.Format(time.RFC3339))
+		if instance.Error != "" {
+			line += " error=" + instance.Error
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeInstance every field of instance
+func (w *Workflows) describeInstance(id string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	instance, ok := w.instances[id]
+	if !ok {
+		return "", fmt.Errorf("workflow instance \"%s\" not found", id)
+	}
+	b, err := json.MarshalIndent(instance, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+type luaWorkflowEnv struct {
+	server *Server
+}
+
+func (env *luaWorkflowEnv) Start(ctx context.Context, name, id string, input []byte) (string, error) {
+	return env.server.workflows.StartInstance(name, id, input)
+}
+
+func (env *luaWorkflowEnv) Status(ctx context.Context, id string) (*coreWorkflow.Instance, error) {
+	return env.server.workflows.Status(id), nil
+}
+
+func (env *luaWorkflowEnv) Build() *coreWorkflow.Env {
+	return &coreWorkflow.Env{
+		Define: env.server.workflows.Define,
+		Start:  env.Start,
+		Status: env.Status,
+	}
+}
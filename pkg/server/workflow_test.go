@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	coreConsensus "github.com/joesonw/drlee/pkg/core/consensus"
+	coreRPC "github.com/joesonw/drlee/pkg/core/rpc"
+	coreWorkflow "github.com/joesonw/drlee/pkg/core/workflow"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+// workflowCalls records calls of steps, replies are made by handlers of methods
+type workflowCalls struct {
+	mu       *sync.Mutex
+	calls    []*coreRPC.Request
+	handlers map[string]func(attempt int) ([]byte, error)
+}
+
+func newWorkflowCalls() *workflowCalls {
+	return &workflowCalls{
+		mu:       &sync.Mutex{},
+		handlers: map[string]func(attempt int) ([]byte, error){},
+	}
+}
+
+func (c *workflowCalls) call(ctx context.Context, req *coreRPC.Request) ([]byte, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, req)
+	attempt := 0
+	for _, call := range c.calls {
+		if call.Name == req.Name {
+			attempt++
+		}
+	}
+	handler, ok := c.handlers[req.Name]
+	c.mu.Unlock()
+	if !ok {
+		return []byte("null"), nil
+	}
+	return handler(attempt)
+}
+
+// methods names of methods called so far in order
+func (c *workflowCalls) methods() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	methods := make([]string, 0, len(c.calls))
+	for _, call := range c.calls {
+		methods = append(methods, call.Name)
+	}
+	return methods
+}
+
+func (c *workflowCalls) keys(method string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for _, call := range c.calls {
+		if call.Name == method {
+			keys = append(keys, call.IdempotencyKey)
+		}
+	}
+	return keys
+}
+
+var _ = Describe("Workflows", func() {
+	var dir string
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var calls *workflowCalls
+	var workflows *Workflows
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "drlee-workflows")
+		Expect(err).To(BeNil())
+		ctx, cancel = context.WithCancel(context.Background())
+		calls = newWorkflowCalls()
+		workflows = newWorkflows(WorkflowConfig{Backoff: time.Millisecond, CompensationRetries: 2}, dir, newMemoryQueue, calls.call, zap.NewNop())
+		Expect(workflows.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(dir)
+	})
+
+	status := func(id string) func() string {
+		return func() string {
+			return workflows.Status(id).Status
+		}
+	}
+
+	It("should keep idempotency key of step until an error is replied", func() {
+		calls.handlers["reserve"] = func(attempt int) ([]byte, error) {
+			switch attempt {
+			case 1:
+				return nil, context.DeadlineExceeded
+			case 2:
+				return nil, &errorReply{message: "out of stock"}
+			}
+			return []byte("1"), nil
+		}
+		workflows.Define(&coreWorkflow.Definition{Name: "order", Steps: []*coreWorkflow.Step{
+			{Name: "reserve", Method: "reserve", Retries: 3},
+		}})
+		id, err := workflows.StartInstance("order", "", []byte("{}"))
+		Expect(err).To(BeNil())
+
+		Eventually(status(id)).Should(Equal(string(WorkflowCompleted)))
+		keys := calls.keys("reserve")
+		Expect(keys).To(HaveLen(3))
+		Expect(keys[1]).To(Equal(keys[0]))
+		Expect(keys[2]).NotTo(Equal(keys[1]))
+	})
+	Describe("compensation", func() {
+		BeforeEach(func() {
+			calls.handlers["charge"] = func(int) ([]byte, error) {
+				return nil, &errorReply{message: "card declined"}
+			}
+			workflows.Define(&coreWorkflow.Definition{Name: "order", Steps: []*coreWorkflow.Step{
+				{Name: "reserve", Method: "reserve", Compensate: "release"},
+				{Name: "ship", Method: "ship", Compensate: "cancel"},
+				{Name: "charge", Method: "charge", Compensate: "refund"},
+			}})
+		})
+
+		It("should compensate completed steps in reverse order", func() {
+			id, err := workflows.StartInstance("order", "", []byte("{}"))
+			Expect(err).To(BeNil())
+
+			Eventually(status(id)).Should(Equal(string(WorkflowCompensated)))
+			Expect(calls.methods()).To(Equal([]string{"reserve", "ship", "charge", "cancel", "release"}))
+			instance := workflows.Status(id)
+			Expect(instance.Error).To(ContainSubstring("card declined"))
+			Expect(instance.Results).To(BeEmpty())
+		})
+
+		It("should retry failed compensations", func() {
+			calls.handlers["cancel"] = func(attempt int) ([]byte, error) {
+				if attempt < 3 {
+					return nil, &errorReply{message: "carrier unavailable"}
+				}
+				return []byte("null"), nil
+			}
+			id, err := workflows.StartInstance("order", "", []byte("{}"))
+			Expect(err).To(BeNil())
+
+			Eventually(status(id)).Should(Equal(string(WorkflowCompensated)))
+			Expect(calls.methods()).To(Equal([]string{"reserve", "ship", "charge", "cancel", "cancel", "cancel", "release"}))
+			keys := calls.keys("cancel")
+			Expect(keys[1]).NotTo(Equal(keys[0]))
+			Expect(keys[2]).NotTo(Equal(keys[1]))
+		})
+
+		It("should fail instance once compensation runs out of retries, until it's resumed", func() {
+			isDown := true
+			calls.handlers["cancel"] = func(int) ([]byte, error) {
+				calls.mu.Lock()
+				defer calls.mu.Unlock()
+				if isDown {
+					return nil, &errorReply{message: "carrier unavailable"}
+				}
+				return []byte("null"), nil
+			}
+			id, err := workflows.StartInstance("order", "", []byte("{}"))
+			Expect(err).To(BeNil())
+
+			Eventually(status(id)).Should(Equal(string(WorkflowFailed)))
+			Expect(calls.methods()).To(Equal([]string{"reserve", "ship", "charge", "cancel", "cancel", "cancel"}))
+			instance := workflows.Status(id)
+			Expect(instance.Error).To(ContainSubstring("compensate \"ship\": carrier unavailable"))
+			Expect(instance.Results).To(HaveKey("reserve"))
+			Expect(instance.Results).To(HaveKey("ship"))
+
+			calls.mu.Lock()
+			isDown = false
+			calls.mu.Unlock()
+			Expect(workflows.Resume(id)).To(Succeed())
+			Eventually(status(id)).Should(Equal(string(WorkflowCompensated)))
+			Expect(calls.methods()[6:]).To(Equal([]string{"cancel", "release"}))
+		})
+	})
+	Describe("replication", func() {
+		var state *coreConsensus.State
+		var aliveMu *sync.Mutex
+		var alive map[string]bool
+
+		newReplicated := func(ctx context.Context, nodeName string, calls *workflowCalls) *Workflows {
+			w := newWorkflows(WorkflowConfig{Backoff: time.Millisecond, Retention: time.Millisecond}, filepath.Join(dir, nodeName), newMemoryQueue, calls.call, zap.NewNop())
+			w.replica = &workflowReplica{
+				nodeName: nodeName,
+				apply: func(ctx context.Context, cmd *coreConsensus.Command) (*coreConsensus.Result, error) {
+					return state.Apply(cmd)
+				},
+				entries: state.Entries,
+				isAlive: func(nodeName string) bool {
+					aliveMu.Lock()
+					defer aliveMu.Unlock()
+					return alive[nodeName]
+				},
+			}
+			w.Define(&coreWorkflow.Definition{Name: "order", Steps: []*coreWorkflow.Step{
+				{Name: "reserve", Method: "reserve"},
+				{Name: "ship", Method: "ship"},
+			}})
+			Expect(w.Start(ctx)).To(Succeed())
+			return w
+		}
+
+		BeforeEach(func() {
+			state = coreConsensus.NewState()
+			aliveMu = &sync.Mutex{}
+			alive = map[string]bool{"a": true, "b": true}
+		})
+
+		It("should have instances of nodes gone taken over by survivors", func() {
+			release := make(chan struct{})
+			callsA := newWorkflowCalls()
+			callsA.handlers["ship"] = func(int) ([]byte, error) {
+				<-release
+				return []byte("1"), nil
+			}
+			callsB := newWorkflowCalls()
+			a := newReplicated(ctx, "a", callsA)
+			b := newReplicated(ctx, "b", callsB)
+
+			id, err := a.StartInstance("order", "", []byte("{}"))
+			Expect(err).To(BeNil())
+			Eventually(callsA.methods).Should(Equal([]string{"reserve", "ship"}))
+			Expect(workflowOwner(state.Entries(workflowReplicaPrefix)[workflowReplicaPrefix+id])).To(Equal("a"))
+
+			b.claim(ctx)
+			Expect(b.Status(id)).To(BeNil())
+
+			aliveMu.Lock()
+			alive["a"] = false
+			aliveMu.Unlock()
+			b.claim(ctx)
+			Eventually(func() string {
+				return b.Status(id).Status
+			}).Should(Equal(string(WorkflowCompleted)))
+			Expect(callsB.methods()).To(Equal([]string{"ship"}))
+			Expect(callsB.keys("ship")).To(Equal(callsA.keys("ship")))
+			Expect(workflowOwner(state.Entries(workflowReplicaPrefix)[workflowReplicaPrefix+id])).To(Equal("b"))
+
+			close(release)
+			Eventually(func() *coreWorkflow.Instance {
+				return a.Status(id)
+			}).Should(BeNil())
+			Expect(a.StartInstance("order", id, []byte("{}"))).To(Equal(id))
+			Expect(a.Status(id)).To(BeNil())
+
+			b.prune()
+			Expect(b.Status(id)).To(BeNil())
+			Expect(state.Entries(workflowReplicaPrefix)).To(BeEmpty())
+		})
+	})
+})